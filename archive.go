@@ -0,0 +1,202 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// contentArchiveExtensions are the extensions of the archives of content
+// files accepted by CONTENT_ARCHIVE
+var contentArchiveExtensions = []string{".zip", ".tar", ".tar.gz", ".tgz"}
+
+// isContentArchive tells whether a file is an archive of content files,
+// by its extension
+func isContentArchive(archivePath string) bool {
+	lower := strings.ToLower(archivePath)
+	for _, extension := range contentArchiveExtensions {
+		if strings.HasSuffix(lower, extension) {
+			return true
+		}
+	}
+	return false
+}
+
+// walkArchiveChunks reads the content files of an archive in memory, without
+// the ones ignored by the ignore patterns (matched against their path in the
+// archive), and calls fn with the path in the archive and the chunks of each
+// file. The chunks are sourced at the path of their file in the archive, the
+// archive being their content file, and keep its modification time. The
+// expired chunks are left out.
+func walkArchiveChunks(archivePath string, patterns []string, delimiter string, fn func(name string, chunks []SnippetRecord)) error {
+	info, err := os.Stat(archivePath)
+	if err != nil {
+		return err
+	}
+	modifiedAt := info.ModTime()
+	ignored := newIgnoreMatcher(patterns)
+	now := time.Now()
+
+	return walkArchiveFiles(archivePath, func(name string) bool {
+		_, ok := contentFileConverters[strings.ToLower(path.Ext(name))]
+		return ok && !isIgnoredArchiveFile(ignored, name)
+	}, func(name string, content []byte) error {
+		chunks, err := archiveFileChunks(archivePath, name, content, modifiedAt, config.DelimiterFor(name, delimiter))
+		if err != nil {
+			return fmt.Errorf("failed to read %s in %s: %w", name, archivePath, err)
+		}
+		// The expired chunks are not embedded again after the sweep removed them
+		fn(name, slices.DeleteFunc(chunks, func(chunk SnippetRecord) bool { return isExpired(chunk, now) }))
+		return nil
+	})
+}
+
+// archiveFileChunks chunks the content of a file of an archive like the
+// content of a file of a content directory
+func archiveFileChunks(archivePath string, name string, content []byte, modifiedAt time.Time, delimiter string) ([]SnippetRecord, error) {
+	if isJSONLFile(name) {
+		return scanJSONLChunks(bytes.NewReader(content), name, archivePath, modifiedAt, delimiter)
+	}
+	var chunks []SnippetRecord
+	if convert := contentFileConverters[strings.ToLower(path.Ext(name))]; convert == nil {
+		chunks = chunkContent(string(content), name, delimiter)
+	} else {
+		chunks = withoutPositions(chunkContent(convert(string(content)), name, delimiter))
+	}
+	for idx := range chunks {
+		chunks[idx].ContentFile = archivePath
+		chunks[idx].ModifiedAt = &modifiedAt
+	}
+	return chunks, nil
+}
+
+// isIgnoredArchiveFile tells whether a file of an archive, or one of its
+// directories, is ignored
+func isIgnoredArchiveFile(ignored ignoreMatcher, name string) bool {
+	segments := strings.Split(name, "/")
+	for idx := 1; idx < len(segments); idx++ {
+		if ignored.Match(strings.Join(segments[:idx], "/"), true) {
+			return true
+		}
+	}
+	return ignored.Match(name, false)
+}
+
+// walkArchiveFiles calls fn with the path and the content of each regular
+// file of a zip or (gzipped) tar archive selected by keep, which is called
+// with the path of the file before its content is read. The files larger
+// than MAX_ARCHIVE_ENTRY_BYTES are skipped.
+func walkArchiveFiles(archivePath string, keep func(name string) bool, fn func(name string, content []byte) error) error {
+	if strings.HasSuffix(strings.ToLower(archivePath), ".zip") {
+		archive, err := zip.OpenReader(archivePath)
+		if err != nil {
+			return err
+		}
+		defer archive.Close()
+		for _, file := range archive.File {
+			name := archiveFileName(file.Name)
+			if !file.Mode().IsRegular() || !keep(name) {
+				continue
+			}
+			content, ok, err := readZipFile(archivePath, name, file)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+			if err := fn(name, content); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	var reader io.Reader = file
+	if lower := strings.ToLower(archivePath); strings.HasSuffix(lower, ".gz") || strings.HasSuffix(lower, ".tgz") {
+		gzipReader, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer gzipReader.Close()
+		reader = gzipReader
+	}
+	archive := tar.NewReader(reader)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		name := archiveFileName(header.Name)
+		if header.Typeflag != tar.TypeReg || !keep(name) {
+			continue
+		}
+		content, ok, err := readArchiveEntry(archivePath, name, header.Size, archive)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		if err := fn(name, content); err != nil {
+			return err
+		}
+	}
+}
+
+// readZipFile reads the content of a file of a zip archive like readArchiveEntry
+func readZipFile(archivePath string, name string, file *zip.File) ([]byte, bool, error) {
+	size := int64(file.UncompressedSize64)
+	if file.UncompressedSize64 > math.MaxInt64 {
+		size = math.MaxInt64
+	}
+	reader, err := file.Open()
+	if err != nil {
+		return nil, false, err
+	}
+	defer reader.Close()
+	return readArchiveEntry(archivePath, name, size, reader)
+}
+
+// readArchiveEntry reads the content of a file of an archive, of the given
+// size, up to MAX_ARCHIVE_ENTRY_BYTES: a larger file (whatever the size its
+// header claims) is skipped with a warning, and reported as not read
+func readArchiveEntry(archivePath string, name string, size int64, reader io.Reader) ([]byte, bool, error) {
+	if size <= config.MaxArchiveEntryBytes {
+		content, err := io.ReadAll(io.LimitReader(reader, config.MaxArchiveEntryBytes+1))
+		if err != nil {
+			return nil, false, err
+		}
+		if int64(len(content)) <= config.MaxArchiveEntryBytes {
+			return content, true, nil
+		}
+	}
+	slog.Warn("🔶 Archive file larger than MAX_ARCHIVE_ENTRY_BYTES skipped", "archive", archivePath, "name", name,
+		"size", size, "max_archive_entry_bytes", config.MaxArchiveEntryBytes)
+	return nil, false, nil
+}
+
+// archiveFileName cleans the path of a file of an archive, like docs/intro.md
+// for ./docs/intro.md
+func archiveFileName(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(name)), "/")
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// archiveFiles are the files of the test archives: the large one exceeds
+// the MAX_ARCHIVE_ENTRY_BYTES of the test
+var archiveFiles = map[string]string{
+	"docs/intro.md": "# Intro\n",
+	"docs/large.md": "# Large\n" + strings.Repeat("x", 100),
+}
+
+// writeZipArchive writes archiveFiles to a zip archive
+func writeZipArchive(t *testing.T, archivePath string) {
+	t.Helper()
+	file, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	archive := zip.NewWriter(file)
+	for name, content := range archiveFiles {
+		writer, err := archive.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(writer, content)
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeTarArchive writes archiveFiles to a gzipped tar archive
+func writeTarArchive(t *testing.T, archivePath string) {
+	t.Helper()
+	file, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	gzipWriter := gzip.NewWriter(file)
+	archive := tar.NewWriter(gzipWriter)
+	for name, content := range archiveFiles {
+		if err := archive.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(archive, content)
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gzipWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWalkArchiveFilesSkipsLargeFiles(t *testing.T) {
+	setupServer(t, nil, map[string]string{"MAX_ARCHIVE_ENTRY_BYTES": "64"})
+	archives := map[string]func(t *testing.T, archivePath string){
+		"docs.zip":    writeZipArchive,
+		"docs.tar.gz": writeTarArchive,
+	}
+	for name, write := range archives {
+		t.Run(name, func(t *testing.T) {
+			archivePath := filepath.Join(t.TempDir(), name)
+			write(t, archivePath)
+			read := map[string]string{}
+			err := walkArchiveFiles(archivePath, func(string) bool { return true }, func(name string, content []byte) error {
+				read[name] = string(content)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("walkArchiveFiles failed: %v", err)
+			}
+			if names := slices.Sorted(maps.Keys(read)); !slices.Equal(names, []string{"docs/intro.md"}) {
+				t.Errorf("the files read are %q, want only docs/intro.md", names)
+			}
+			if read["docs/intro.md"] != archiveFiles["docs/intro.md"] {
+				t.Errorf("docs/intro.md = %q, want %q", read["docs/intro.md"], archiveFiles["docs/intro.md"])
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// delimiterDetector finds the most frequent horizontal rule of a text
+// (a line made of a run of "-", "=" or "*"), ignoring the fenced code blocks,
+// to split the text on it with CHUNK_STRATEGY=autodelimiter
+type delimiterDetector struct {
+	minLength int
+	fence     fenceState
+	counts    map[string]int
+	// rules lists the rules in the order they were first found
+	rules []string
+}
+
+func newDelimiterDetector(minLength int) *delimiterDetector {
+	return &delimiterDetector{minLength: minLength, counts: map[string]int{}}
+}
+
+// addLine counts the next line of the text, when it is a horizontal rule
+func (d *delimiterDetector) addLine(line string) {
+	inFence := d.fence.open
+	_, d.fence = scanFences(line, d.fence)
+	if inFence || d.fence.open {
+		return
+	}
+	rule := strings.TrimSuffix(line, "\n")
+	if len(rule) < d.minLength || !strings.ContainsRune("-=*", rune(rule[0])) ||
+		strings.Trim(rule, rule[:1]) != "" {
+		return
+	}
+	if d.counts[rule] == 0 {
+		d.rules = append(d.rules, rule)
+	}
+	d.counts[rule]++
+}
+
+// delimiter returns the most frequent rule, the first found on a tie,
+// surrounded by newlines so only whole lines match it, or fallback when the
+// text has no rule
+func (d *delimiterDetector) delimiter(source string, fallback string) string {
+	best := ""
+	for _, rule := range d.rules {
+		if best == "" || d.counts[rule] > d.counts[best] {
+			best = rule
+		}
+	}
+	if best == "" {
+		slog.Debug("✂️ No delimiter detected, splitting at DELIMITER", "source", source, "delimiter", fallback)
+		return fallback
+	}
+	slog.Debug("✂️ Delimiter detected", "source", source, "delimiter", best, "occurrences", d.counts[best])
+	return "\n" + best + "\n"
+}
+
+// detectDelimiter returns the delimiter of the content of a source with
+// CHUNK_STRATEGY=autodelimiter, or fallback when it has no horizontal rule
+func detectDelimiter(content string, source string, fallback string) string {
+	detector := newDelimiterDetector(config.AutoDelimiterMinLength)
+	for _, line := range strings.SplitAfter(content, "\n") {
+		if line != "" {
+			detector.addLine(line)
+		}
+	}
+	return detector.delimiter(source, fallback)
+}
+
+// detectFileDelimiter returns the delimiter of a content file like
+// detectDelimiter, reading the file a line at a time after its frontmatter
+func detectFileDelimiter(path string, fallback string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	if _, err := file.Seek(int64(readFrontmatter(file, path).length), io.SeekStart); err != nil {
+		return "", err
+	}
+
+	detector := newDelimiterDetector(config.AutoDelimiterMinLength)
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+		if line != "" {
+			detector.addLine(line)
+		}
+		if err == io.EOF {
+			return detector.delimiter(path, fallback), nil
+		}
+	}
+}
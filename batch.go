@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// chunkIndexer indexes chunks by batches of size: the embeddings of a batch
+// are created by a single request, then the chunks are saved in order.
+// When the request of a batch fails, or misses some embeddings, the chunks
+// concerned are embedded one by one, so a failing chunk only fails itself.
+type chunkIndexer struct {
+	ctx  context.Context
+	size int
+	// done is called for each chunk once it is indexed, or failed
+	done func(idx int, chunk SnippetRecord, saved bool, err error)
+	// save saves an embedded chunk, saveChunk unless replaced
+	save    func(ctx context.Context, idx int, chunk SnippetRecord, embeddingVector []float64) (bool, error)
+	pending []SnippetRecord
+	// next is the index of the next chunk added
+	next int
+}
+
+func newChunkIndexer(ctx context.Context, size int, done func(idx int, chunk SnippetRecord, saved bool, err error)) *chunkIndexer {
+	return &chunkIndexer{ctx: ctx, size: max(size, 1), done: done, save: saveChunk}
+}
+
+// add queues a chunk, and indexes the batch once it is full
+func (b *chunkIndexer) add(chunk SnippetRecord) {
+	b.pending = append(b.pending, chunk)
+	b.next++
+	if len(b.pending) >= b.size {
+		b.flush()
+	}
+}
+
+// flush indexes the queued chunks
+func (b *chunkIndexer) flush() {
+	if len(b.pending) == 0 {
+		return
+	}
+	first := b.next - len(b.pending)
+	batch := b.pending
+	b.pending = nil
+
+	if b.size == 1 {
+		saved, err := b.indexChunk(first, batch[0])
+		b.done(first, batch[0], saved, err)
+		return
+	}
+
+	contents := make([]string, len(batch))
+	for idx, chunk := range batch {
+		contents[idx] = config.DocumentPrefix + chunk.Prompt
+	}
+	slog.Debug("🔶 Embedding chunks", "first_chunk_index", first, "chunks", len(batch))
+	var vectors [][]float64
+	err := embeddingLimiter.WaitIndex(b.ctx)
+	if err == nil {
+		vectors, err = withRetries(b.ctx, config.IndexRetryPolicy(), func() ([][]float64, error) {
+			start := time.Now()
+			vectors, err := embedder.GenerateEmbeddingVectors(b.ctx, contents)
+			observeEmbedding(phaseIndex, start, err)
+			return vectors, err
+		})
+	}
+	if err != nil {
+		slog.Warn("🔶 Unable to embed the batch of chunks, embedding them one by one",
+			"first_chunk_index", first, "chunks", len(batch), "error", err)
+	}
+
+	for offset, chunk := range batch {
+		idx := first + offset
+		var saved bool
+		var err error
+		if offset < len(vectors) && len(vectors[offset]) > 0 {
+			saved, err = b.save(b.ctx, idx, chunk, vectors[offset])
+		} else {
+			saved, err = b.indexChunk(idx, chunk)
+		}
+		b.done(idx, chunk, saved, err)
+	}
+}
+
+// indexChunk embeds a chunk alone and saves it
+func (b *chunkIndexer) indexChunk(idx int, chunk SnippetRecord) (bool, error) {
+	embeddingVector, err := embedChunk(b.ctx, idx, chunk)
+	if err != nil {
+		return false, err
+	}
+	return b.save(b.ctx, idx, chunk, embeddingVector)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// sourceBoost multiplies the cosine similarity of the records whose source
+// matches a glob of SOURCE_BOOSTS
+type sourceBoost struct {
+	glob       string
+	matches    RecordFilter
+	multiplier float64
+}
+
+// getSourceBoosts parses a comma-separated list of glob=multiplier source
+// boosts, the globs being matched like the source_filter of search_snippet,
+// with the given content directories
+func (st *settings) getSourceBoosts(name string, contentDirs []string) []sourceBoost {
+	boosts := []sourceBoost{}
+	for _, item := range splitList(st.get(name, "")) {
+		separator := strings.LastIndex(item, "=")
+		if separator < 0 {
+			st.problems = append(st.problems, fmt.Errorf("%s: %q is not a glob=multiplier boost", name, item))
+			continue
+		}
+		glob := strings.TrimSpace(item[:separator])
+		multiplier, err := strconv.ParseFloat(strings.TrimSpace(item[separator+1:]), 64)
+		if err != nil || !(multiplier > 0) || math.IsInf(multiplier, 0) {
+			st.problems = append(st.problems, fmt.Errorf("%s: the multiplier of %q must be a positive number", name, item))
+			continue
+		}
+		matches, err := sourceFilter(glob, contentDirs)
+		if glob == "" || err != nil {
+			st.problems = append(st.problems, fmt.Errorf("%s: %q has no valid source glob", name, item))
+			continue
+		}
+		boosts = append(boosts, sourceBoost{glob: glob, matches: matches, multiplier: multiplier})
+	}
+	return boosts
+}
+
+// sourceBoostOf returns the multiplier of the first boost glob matching the
+// source of a record, 1 when no glob matches
+func sourceBoostOf(boosts []sourceBoost, record SnippetRecord) float64 {
+	for _, boost := range boosts {
+		if boost.matches(record) {
+			return boost.multiplier
+		}
+	}
+	return 1
+}
+
+// rankingScore returns the score the search results are ranked by: the
+// cosine similarity of a record multiplied by its source boost. The results
+// show, and the similarity threshold compares, the similarity alone.
+func rankingScore(record SnippetRecord) float64 {
+	if record.SourceBoost == 0 {
+		return record.CosineSimilarity
+	}
+	return record.CosineSimilarity * record.SourceBoost
+}
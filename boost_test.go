@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"testing"
+
+	"github.com/micro-agent/micro-agent-go/agent/rag"
+)
+
+// vectorAt returns a 2D vector whose cosine similarity with (1, 0) is similarity
+func vectorAt(similarity float64) []float64 {
+	return []float64{similarity, math.Sqrt(1 - similarity*similarity)}
+}
+
+func TestSourceBoostsRankWithoutChangingScores(t *testing.T) {
+	snippetStore := setupServer(t, func(context.Context, string) ([]float64, error) {
+		return []float64{1, 0}, nil
+	}, map[string]string{"SOURCE_BOOSTS": "official/**=1.5", "LIMIT": "0.5", "MAX_RESULTS": "5"})
+	snippetStore.Save(testRecord("community", "community/go.md", "community chunk", vectorAt(0.9)...))
+	snippetStore.Save(testRecord("official", "official/go.md", "official chunk", vectorAt(0.7)...))
+	snippetStore.Save(testRecord("exact", "official/exact.md", "exact chunk", vectorAt(1)...))
+	// Boosted above the threshold, but not similar enough
+	snippetStore.Save(testRecord("dissimilar", "official/other.md", "dissimilar chunk", vectorAt(0.4)...))
+
+	result, err := searchInDocHandler(context.Background(), toolRequest("search_snippet", map[string]any{
+		"topic": "go", "format": "json", "verbose": true,
+	}))
+	if err != nil {
+		t.Fatalf("searchInDocHandler() failed: %v", err)
+	}
+	var response struct {
+		Results []struct {
+			ID             string  `json:"id"`
+			Score          float64 `json:"score"`
+			BelowThreshold bool    `json:"below_threshold"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal([]byte(resultText(t, result)), &response); err != nil {
+		t.Fatal(err)
+	}
+	ids := []string{}
+	for _, found := range response.Results {
+		ids = append(ids, found.ID)
+		if found.Score > 1 || found.BelowThreshold {
+			t.Errorf("%s has the score %v, below the threshold: %t, want its similarity above the threshold", found.ID, found.Score, found.BelowThreshold)
+		}
+	}
+	// 0.7 × 1.5 ranks before 0.9
+	if want := []string{"exact", "official", "community"}; !slices.Equal(ids, want) {
+		t.Fatalf("the search returned %v, want %v", ids, want)
+	}
+	if score := response.Results[1].Score; math.Abs(score-0.7) > 1e-9 {
+		t.Errorf("the boosted snippet has the score %v, want its similarity 0.7", score)
+	}
+}
+
+func TestSourceBoostsRankMoreANNNeighbors(t *testing.T) {
+	setupServer(t, nil, map[string]string{"SOURCE_BOOSTS": "official/**=2"})
+	exact := NewSnippetStore(false, false, false, quantizationNone)
+	approximate := NewSnippetStore(false, false, false, quantizationNone)
+	approximate.EnableANN(hnswParams{M: 16, EfConstruction: 100, EfSearch: 64}, 0)
+	// More than EfSearch unboosted neighbors are more similar than the boosted record
+	for idx := range 200 {
+		record := testRecord(fmt.Sprintf("community-%03d", idx), "community/go.md", "chunk", vectorAt(0.99-float64(idx)*0.001)...)
+		exact.Save(record)
+		approximate.Save(record)
+	}
+	boosted := testRecord("official", "official/go.md", "chunk", vectorAt(0.6)...)
+	exact.Save(boosted)
+	approximate.Save(boosted)
+
+	question := rag.VectorRecord{Embedding: []float64{1, 0}}
+	for name, snippetStore := range map[string]*SnippetStore{"exact": exact, "ANN": approximate} {
+		results, err := snippetStore.SearchTopNSimilarities(context.Background(), question, 0, 3, config.SourceBoosts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ids := resultIDs(results); len(ids) != 3 || ids[0] != "official" {
+			t.Errorf("the %s search returned %v, want the boosted record first", name, ids)
+		}
+		if results[0].CosineSimilarity != cosineSimilarityWithNorms(question.Embedding, boosted.Embedding, 1, vectorNorm(boosted.Embedding)) {
+			t.Errorf("the %s search changed the similarity of the boosted record to %v", name, results[0].CosineSimilarity)
+		}
+	}
+}
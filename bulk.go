@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// addedContentFile is the content file of the chunks of the documents added
+// with add_snippets_bulk, which are not files: the reindex keeps them
+const addedContentFile = "add_snippets_bulk"
+
+// bulkDocument is a document of an add_snippets_bulk call
+type bulkDocument struct {
+	content string
+	source  string
+	tags    []string
+}
+
+// addSnippetsBulkHandler returns the handler of the add_snippets_bulk tool:
+// the documents are chunked and their chunks embedded by batches of
+// EMBEDDING_BATCH_SIZE, replacing the chunks of the documents previously added
+// with the same sources, then the store is persisted once. It returns the
+// number of chunks added per document and in total.
+func addSnippetsBulkHandler(s *server.MCPServer) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		documents, err := parseBulkDocuments(request.GetArguments()["documents"])
+		if err != nil {
+			return nil, fmt.Errorf("parameter 'documents': %w", err)
+		}
+
+		if !isStoreReady() {
+			return nil, fmt.Errorf("the vector store is not ready yet, please retry later")
+		}
+
+		slog.Info("📥 Adding documents", "documents", len(documents))
+		sources := make(map[string]bool, len(documents))
+		for _, document := range documents {
+			sources[document.source] = true
+		}
+		// Replace the chunks of the documents added before with the same sources
+		for _, record := range store.Records() {
+			if record.ContentFile == addedContentFile && sources[record.Source] {
+				if err := store.Delete(record.Id); err != nil {
+					return nil, fmt.Errorf("failed to remove the previously added chunks: %w", err)
+				}
+			}
+		}
+
+		// chunkDocuments maps the index of each chunk to the index of its document
+		var chunkDocuments []int
+		added := make([]int, len(documents))
+		failed := 0
+		indexer := newChunkIndexer(ctx, config.EmbeddingBatchSize, func(idx int, chunk SnippetRecord, saved bool, err error) {
+			if err != nil {
+				slog.Error("😡 Error indexing the chunk", "chunk_index", idx, "source", chunk.Source, "error", err)
+				failed++
+			}
+			if saved {
+				added[chunkDocuments[idx]]++
+			}
+		})
+		addedAt := time.Now()
+		for docIdx, document := range documents {
+			for _, chunk := range chunkContent(document.content, document.source, config.DelimiterFor(document.source, config.Delimiter)) {
+				if strings.TrimSpace(chunk.Prompt) == "" {
+					continue
+				}
+				chunk.Tags = document.tags
+				chunk.ContentFile = addedContentFile
+				chunk.ModifiedAt = &addedAt
+				chunkDocuments = append(chunkDocuments, docIdx)
+				indexer.add(chunk)
+			}
+		}
+		indexer.flush()
+
+		flushStore(config.StoreFilePath())
+		registerSnippetResources(s)
+		if err := ctx.Err(); err != nil {
+			return nil, fmt.Errorf("adding the documents was cancelled: %w", err)
+		}
+
+		total := 0
+		var summary strings.Builder
+		for docIdx, document := range documents {
+			total += added[docIdx]
+			fmt.Fprintf(&summary, "- %s: %d chunks\n", document.source, added[docIdx])
+		}
+		slog.Info("✅ Documents added", "documents", len(documents), "chunks", total, "failed", failed)
+		result := fmt.Sprintf("Added %d chunks from %d documents:\n%s", total, len(documents), summary.String())
+		if failed > 0 {
+			result += fmt.Sprintf("%d chunks failed to be embedded, see the server logs\n", failed)
+		}
+		return mcp.NewToolResultText(result), nil
+	}
+}
+
+// parseBulkDocuments reads the documents argument of add_snippets_bulk,
+// an array of objects with a content, a source and optional tags
+func parseBulkDocuments(argument any) ([]bulkDocument, error) {
+	items, ok := argument.([]any)
+	if !ok || len(items) == 0 {
+		return nil, fmt.Errorf("a non-empty array of documents is required")
+	}
+	documents := make([]bulkDocument, 0, len(items))
+	for idx, item := range items {
+		fields, ok := item.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("the document %d must be an object", idx)
+		}
+		content, _ := fields["content"].(string)
+		if strings.TrimSpace(content) == "" {
+			return nil, fmt.Errorf("the document %d has no content", idx)
+		}
+		source, _ := fields["source"].(string)
+		if strings.TrimSpace(source) == "" {
+			return nil, fmt.Errorf("the document %d has no source", idx)
+		}
+		document := bulkDocument{content: content, source: source}
+		if rawTags, ok := fields["tags"]; ok && rawTags != nil {
+			tags, ok := rawTags.([]any)
+			if !ok {
+				return nil, fmt.Errorf("the tags of the document %d must be an array of strings", idx)
+			}
+			for _, rawTag := range tags {
+				tag, ok := rawTag.(string)
+				if !ok {
+					return nil, fmt.Errorf("the tags of the document %d must be an array of strings", idx)
+				}
+				document.tags = append(document.tags, tag)
+			}
+		}
+		documents = append(documents, document)
+	}
+	return documents, nil
+}
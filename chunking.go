@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/micro-agent/micro-agent-go/agent/rag"
+)
+
+// maxTitleChars is the maximum length of a title made from the first line of a chunk
+const maxTitleChars = 80
+
+// chunkContent splits the content of a source into records, without their
+// embeddings, titled after their nearest markdown heading and located by their
+// byte offsets and line numbers in the content. The content is split at the
+// delimiter (the most frequent horizontal rule of the content with
+// CHUNK_STRATEGY=autodelimiter), or by the recursive splitter with
+// CHUNK_STRATEGY=recursive, never inside a fenced code block, and
+// the boundaries are snapped to sentence ends with SENTENCE_SNAP_CHARS.
+// The YAML frontmatter of the content is not chunked.
+func chunkContent(content string, source string, delimiter string) []SnippetRecord {
+	front := readFrontmatter(strings.NewReader(content), source)
+	content = content[front.length:]
+	var parts []textSpan
+	switch config.ChunkStrategy {
+	case chunkStrategyRecursive:
+		parts = splitRecursive(content, config.ChunkSize, config.ChunkOverlap)
+	case chunkStrategyAutoDelimiter:
+		parts = splitDelimited(content, detectDelimiter(content, source, delimiter))
+	default:
+		parts = splitDelimited(content, delimiter)
+	}
+	records := make([]SnippetRecord, 0, len(parts))
+	recorder := chunkRecorder{source: source, expiresAt: front.expiresAt, offset: front.length, lines: front.lines}
+	emit := snapSentences(func(part textSpan) {
+		records = append(records, recorder.record(part))
+	})
+	for _, part := range parts {
+		emit.add(part)
+	}
+	emit.flush()
+	return records
+}
+
+// chunkRecorder turns the consecutive chunks of a source into records,
+// titled after their nearest markdown heading, expiring at the expires_at
+// date of the frontmatter of the source. The chunks are split after the
+// frontmatter, which spans offset bytes and lines of the source.
+type chunkRecorder struct {
+	source           string
+	expiresAt        *time.Time
+	modifiedAt       *time.Time
+	offset           int
+	lines            int
+	index            int
+	precedingHeading string
+}
+
+// record returns the record of the next chunk of the source
+func (r *chunkRecorder) record(part textSpan) SnippetRecord {
+	record := SnippetRecord{
+		VectorRecord: rag.VectorRecord{Prompt: part.text},
+		Source:       r.source,
+		Title:        chunkTitle(part.text, r.precedingHeading, r.source, r.index),
+		StartOffset:  r.offset + part.start,
+		EndOffset:    r.offset + part.end(),
+		StartLine:    r.lines + part.line,
+		EndLine:      r.lines + part.line + strings.Count(strings.TrimRight(part.text, "\n"), "\n"),
+		ExpiresAt:    r.expiresAt,
+		ModifiedAt:   r.modifiedAt,
+	}
+	r.index++
+	if heading := lastHeading(part.text); heading != "" {
+		r.precedingHeading = heading
+	}
+	return record
+}
+
+// withoutPositions removes the offsets and line numbers of records whose
+// content was converted, since they don't match the source file
+func withoutPositions(records []SnippetRecord) []SnippetRecord {
+	for idx := range records {
+		records[idx].StartOffset, records[idx].EndOffset = 0, 0
+		records[idx].StartLine, records[idx].EndLine = 0, 0
+	}
+	return records
+}
+
+// recordLocation returns where a record comes from, like "docs/http.md lines 40-58",
+// or "" for the records without line numbers
+func recordLocation(record SnippetRecord) string {
+	if record.StartLine == 0 {
+		return ""
+	}
+	if record.EndLine <= record.StartLine {
+		return fmt.Sprintf("%s line %d", record.Source, record.StartLine)
+	}
+	return fmt.Sprintf("%s lines %d-%d", record.Source, record.StartLine, record.EndLine)
+}
+
+// chunkTitle returns the first markdown heading of a chunk, or the nearest
+// heading preceding it in its source, or its first line of text, or the name
+// of its source file and its index
+func chunkTitle(text string, precedingHeading string, source string, chunkIndex int) string {
+	if heading := firstHeading(text); heading != "" {
+		return heading
+	}
+	if precedingHeading != "" {
+		return precedingHeading
+	}
+	if line := firstTextLine(text); line != "" {
+		return line
+	}
+	return filepath.Base(source) + " #" + strconv.Itoa(chunkIndex+1)
+}
+
+// recordTitle returns the title of a record, computing it for the records
+// indexed before titles were stored
+func recordTitle(record SnippetRecord) string {
+	if record.Title != "" {
+		return record.Title
+	}
+	if heading := firstHeading(record.Prompt); heading != "" {
+		return heading
+	}
+	if line := firstTextLine(record.Prompt); line != "" {
+		return line
+	}
+	if record.Source != "" {
+		return filepath.Base(record.Source)
+	}
+	return record.Id
+}
+
+// firstHeading returns the text of the first markdown heading of a chunk
+func firstHeading(text string) string {
+	for _, line := range strings.Split(text, "\n") {
+		if heading := markdownHeading(line); heading != "" {
+			return heading
+		}
+	}
+	return ""
+}
+
+// lastHeading returns the text of the last markdown heading of a chunk
+func lastHeading(text string) string {
+	lines := strings.Split(text, "\n")
+	for idx := len(lines) - 1; idx >= 0; idx-- {
+		if heading := markdownHeading(lines[idx]); heading != "" {
+			return heading
+		}
+	}
+	return ""
+}
+
+// markdownHeading returns the text of a markdown heading line, or ""
+func markdownHeading(line string) string {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "#") {
+		return ""
+	}
+	heading := strings.TrimLeft(line, "#")
+	// "#hashtag" is not a heading
+	if heading != "" && heading[0] != ' ' && heading[0] != '\t' {
+		return ""
+	}
+	return strings.TrimSpace(heading)
+}
+
+// firstTextLine returns the first non-empty line of a chunk which is not a
+// code fence, truncated to maxTitleChars
+func firstTextLine(text string) string {
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "```") || strings.HasPrefix(line, "~~~") {
+			continue
+		}
+		if runes := []rune(line); len(runes) > maxTitleChars {
+			return string(runes[:maxTitleChars]) + "…"
+		}
+		return line
+	}
+	return ""
+}
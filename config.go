@@ -0,0 +1,614 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultConfigFile is loaded, when it exists, if CONFIG_FILE is not set
+const defaultConfigFile = "config.yaml"
+
+// Config holds the settings of the server
+type Config struct {
+	// ConfigFile is the path of the loaded config file, "" when there is none
+	ConfigFile string
+
+	ModelRunnerBaseURL      string
+	EmbeddingProvider       string
+	EmbeddingModel          string
+	FallbackEmbeddingModels []string
+	EmbeddingHeaders        map[string]string
+	EmbeddingTimeout        time.Duration
+	EmbeddingBatchSize      int
+	EmbeddingMaxRPS         float64
+	EmbeddingBurst          int
+	EmbeddingQueueTimeout   time.Duration
+	IndexEmbeddingRetries   int
+	IndexEmbeddingBackoff   time.Duration
+	QueryEmbeddingRetries   int
+	QueryEmbeddingBackoff   time.Duration
+	QueryPrefix             string
+	DocumentPrefix          string
+	WarmupEmbedding         bool
+	StoreBackend            string
+	JSONStoreFilePath       string
+	CompressStore           bool
+	StoreBackup             bool
+	StorePretty             bool
+	VectorQuantization      string
+	SQLiteFilePath          string
+	ANNEnabled              bool
+	ANNMinRecords           int
+	ANNM                    int
+	ANNEfConstruction       int
+	ANNEfSearch             int
+	ContentDirs             []string
+	ContentArchives         []string
+	IgnorePatterns          []string
+	DefaultTags             []string
+	Delimiter               string
+	ExtensionDelimiters     map[string]string
+	ChunkStrategy           string
+	ChunkSize               int
+	ChunkOverlap            int
+	AutoDelimiterMinLength  int
+	SentenceSnapChars       int
+	DedupThreshold          float64
+	DedupFiles              bool
+	StreamingThresholdBytes int64
+	MaxArchiveEntryBytes    int64
+	OnModelMismatch         string
+	MinContentFiles         int
+	OnTooFewContentFiles    string
+	ForceReindex            bool
+	AllowReset              bool
+	ReadOnly                bool
+	PersistInterval         time.Duration
+	ExpirySweepInterval     time.Duration
+	ProgressInterval        time.Duration
+	DryRun                  bool
+
+	HTTPPort           string
+	AuthToken          string
+	CORSAllowedOrigins []string
+	TLSCertFile        string
+	TLSKeyFile         string
+
+	ImportTimeout  time.Duration
+	ImportMaxBytes int64
+	MaxSourceBytes int64
+
+	Limit           float64
+	MaxResults      int
+	MinResults      int
+	MaxChunkChars   int
+	MaxQueryChars   int
+	OnLongQuery     string
+	MaxResultChars  int
+	ScorePrecision  int
+	QueryCacheSize  int
+	ResultCacheSize int
+	ResultCacheTTL  time.Duration
+	HighlightTerms  bool
+	CombinedResults bool
+	MergeResults    bool
+	ResultTemplate  string
+	QueryLogPath    string
+	FeedbackLogPath string
+
+	RerankEnabled          bool
+	RerankModel            string
+	RerankCandidatesFactor int
+
+	RecencyWeight   float64
+	RecencyHalfLife time.Duration
+
+	SourceBoosts []sourceBoost
+
+	QueryExpansion         bool
+	QueryExpansionModel    string
+	QueryExpansionVariants int
+
+	LogLevel  string
+	LogFormat string
+}
+
+// commandLineFlags maps the command-line flags to the environment
+// variables of the settings they override
+var commandLineFlags = []struct {
+	name  string
+	env   string
+	usage string
+}{
+	{"config", "CONFIG_FILE", "path of the YAML configuration file"},
+	{"port", "MCP_HTTP_PORT", "HTTP server port"},
+	{"model", "EMBEDDING_MODEL", "embedding model name"},
+	{"store", "JSON_STORE_FILE_PATH", "vector store file path of the json backend"},
+	{"sqlite-store", "SQLITE_STORE_FILE_PATH", "database file path of the sqlite backend"},
+	{"content-dir", "CONTENT_DIR", "directory of the content files to index"},
+	{"limit", "LIMIT", "similarity threshold, between 0 and 1"},
+	{"max-results", "MAX_RESULTS", "maximum number of search results"},
+}
+
+// parseFlags parses the command-line arguments and returns the values of
+// the flags that were passed, keyed by the environment variable they override
+func parseFlags(arguments []string) (map[string]string, error) {
+	flagSet := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	values := make(map[string]*string, len(commandLineFlags))
+	for _, commandLineFlag := range commandLineFlags {
+		values[commandLineFlag.name] = flagSet.String(commandLineFlag.name, "",
+			fmt.Sprintf("%s (overrides %s)", commandLineFlag.usage, commandLineFlag.env))
+	}
+	if err := flagSet.Parse(arguments); err != nil {
+		return nil, err
+	}
+
+	flags := map[string]string{}
+	flagSet.Visit(func(f *flag.Flag) {
+		for _, commandLineFlag := range commandLineFlags {
+			if commandLineFlag.name == f.Name {
+				flags[commandLineFlag.env] = *values[f.Name]
+			}
+		}
+	})
+	return flags, nil
+}
+
+// settings resolves the value of a setting: the command-line flag first,
+// then the environment variable, then the config file, where the key is the
+// lowercased variable name (e.g. max_results for MAX_RESULTS), and the
+// default value last. It collects the values that can't be parsed.
+type settings struct {
+	flags    map[string]string
+	file     map[string]string
+	problems []error
+}
+
+func (st *settings) get(name string, defaultValue string) string {
+	if value, ok := st.flags[name]; ok {
+		return value
+	}
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	if value, ok := st.file[strings.ToLower(name)]; ok && value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func (st *settings) getDuration(name string, defaultValue string) time.Duration {
+	value := st.get(name, defaultValue)
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		st.problems = append(st.problems, fmt.Errorf("%s: %q is not a duration (e.g. 30s, 5m)", name, value))
+	}
+	return duration
+}
+
+func (st *settings) getBool(name string, defaultValue string) bool {
+	value := st.get(name, defaultValue)
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		st.problems = append(st.problems, fmt.Errorf("%s: %q is not a boolean", name, value))
+	}
+	return enabled
+}
+
+func (st *settings) getInt(name string, defaultValue string) int {
+	value := st.get(name, defaultValue)
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		st.problems = append(st.problems, fmt.Errorf("%s: %q is not an integer", name, value))
+	}
+	return number
+}
+
+func (st *settings) getFloat(name string, defaultValue string) float64 {
+	value := st.get(name, defaultValue)
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		st.problems = append(st.problems, fmt.Errorf("%s: %q is not a number", name, value))
+	}
+	return number
+}
+
+// headerStart matches the start of a "Key: Value" header, its name made of
+// the token characters of RFC 9110 followed by a colon
+var headerStart = regexp.MustCompile("^[-!#$%&'*+.^_`|~0-9A-Za-z]+[ \t]*:")
+
+// getHeaders parses a comma-separated list of "Key: Value" HTTP headers.
+// A comma only separates two headers when the next one starts with its name
+// and a colon, so a value may hold commas (e.g. "Accept: text/html, */*").
+func (st *settings) getHeaders(name string) map[string]string {
+	items := []string{}
+	for _, part := range strings.Split(st.get(name, ""), ",") {
+		switch last := len(items) - 1; {
+		case strings.TrimSpace(part) == "":
+		case last >= 0 && !headerStart.MatchString(strings.TrimSpace(part)):
+			items[last] += "," + part
+		default:
+			items = append(items, strings.TrimSpace(part))
+		}
+	}
+
+	headers := map[string]string{}
+	for _, item := range items {
+		key, value, found := strings.Cut(item, ":")
+		key = strings.TrimSpace(key)
+		if !found || key == "" || strings.ContainsAny(key, " \t") {
+			st.problems = append(st.problems, fmt.Errorf("%s: %q is not a \"Key: Value\" header", name, item))
+			continue
+		}
+		headers[key] = strings.TrimSpace(value)
+	}
+	return headers
+}
+
+// loadConfig reads the optional YAML config file (-config or CONFIG_FILE,
+// or config.yaml when it exists) and builds the configuration, command-line
+// flags overriding environment variables, which override the values of the
+// file. It returns all the invalid settings found, joined in the error.
+func loadConfig(arguments []string) (*Config, error) {
+	flags, err := parseFlags(arguments)
+	if err != nil {
+		return nil, err
+	}
+	st := &settings{flags: flags}
+	configFile, file, err := readConfigFile(st.get("CONFIG_FILE", ""))
+	if err != nil {
+		return nil, err
+	}
+	st.file = file
+
+	config := &Config{
+		ConfigFile: configFile,
+
+		ModelRunnerBaseURL:     st.get("MODEL_RUNNER_BASE_URL", "http://localhost:12434/engines/llama.cpp/v1/"),
+		EmbeddingProvider:      st.get("EMBEDDING_PROVIDER", embeddingProviderOpenAI),
+		EmbeddingModel:         st.get("EMBEDDING_MODEL", "ai/mxbai-embed-large:latest"),
+		EmbeddingHeaders:       st.getHeaders("EMBEDDING_HEADERS"),
+		EmbeddingBatchSize:     st.getInt("EMBEDDING_BATCH_SIZE", "1"),
+		EmbeddingMaxRPS:        st.getFloat("EMBEDDING_MAX_RPS", "0"),
+		EmbeddingBurst:         st.getInt("EMBEDDING_BURST", "1"),
+		IndexEmbeddingRetries:  st.getInt("INDEX_EMBEDDING_RETRIES", "2"),
+		QueryEmbeddingRetries:  st.getInt("QUERY_EMBEDDING_RETRIES", "2"),
+		QueryPrefix:            st.get("QUERY_PREFIX", ""),
+		DocumentPrefix:         st.get("DOCUMENT_PREFIX", ""),
+		WarmupEmbedding:        st.getBool("WARMUP_EMBEDDING", "false"),
+		StoreBackend:           st.get("STORE_BACKEND", storeBackendJSON),
+		JSONStoreFilePath:      st.get("JSON_STORE_FILE_PATH", "rag-memory-store.json"),
+		CompressStore:          st.getBool("COMPRESS_STORE", "false"),
+		StoreBackup:            st.getBool("STORE_BACKUP", "true"),
+		StorePretty:            st.getBool("STORE_PRETTY", "false"),
+		VectorQuantization:     st.get("VECTOR_QUANTIZATION", quantizationNone),
+		SQLiteFilePath:         st.get("SQLITE_STORE_FILE_PATH", "rag-memory-store.db"),
+		ANNEnabled:             st.getBool("ANN_ENABLED", "false"),
+		ANNMinRecords:          st.getInt("ANN_MIN_RECORDS", "10000"),
+		ANNM:                   st.getInt("ANN_M", "16"),
+		ANNEfConstruction:      st.getInt("ANN_EF_CONSTRUCTION", "100"),
+		ANNEfSearch:            st.getInt("ANN_EF_SEARCH", "64"),
+		ContentDirs:            splitList(st.get("CONTENT_DIR", ".")),
+		IgnorePatterns:         splitList(st.get("IGNORE_PATTERNS", "")),
+		DefaultTags:            splitList(st.get("DEFAULT_TAGS", "")),
+		Delimiter:              st.get("DELIMITER", "----------"),
+		ChunkStrategy:          st.get("CHUNK_STRATEGY", chunkStrategyDelimiter),
+		ChunkSize:              st.getInt("CHUNK_SIZE", "1000"),
+		ChunkOverlap:           st.getInt("CHUNK_OVERLAP", "0"),
+		AutoDelimiterMinLength: st.getInt("AUTO_DELIMITER_MIN_LENGTH", "3"),
+		SentenceSnapChars:      st.getInt("SENTENCE_SNAP_CHARS", "0"),
+		DedupThreshold:         st.getFloat("DEDUP_THRESHOLD", "0"),
+		DedupFiles:             st.getBool("DEDUP_FILES", "true"),
+		OnModelMismatch:        st.get("ON_MODEL_MISMATCH", onModelMismatchFail),
+		MinContentFiles:        st.getInt("MIN_CONTENT_FILES", "1"),
+		OnTooFewContentFiles:   st.get("ON_TOO_FEW_CONTENT_FILES", onTooFewContentFilesWarn),
+		ForceReindex:           st.getBool("FORCE_REINDEX", "false"),
+		AllowReset:             st.getBool("ALLOW_RESET", "false"),
+		ReadOnly:               st.getBool("READ_ONLY", "false"),
+		DryRun:                 st.getBool("DRY_RUN", "false"),
+
+		HTTPPort:           st.get("MCP_HTTP_PORT", "9090"),
+		AuthToken:          st.get("MCP_AUTH_TOKEN", ""),
+		CORSAllowedOrigins: splitList(st.get("CORS_ALLOWED_ORIGINS", "")),
+		TLSCertFile:        st.get("TLS_CERT_FILE", ""),
+		TLSKeyFile:         st.get("TLS_KEY_FILE", ""),
+
+		Limit:           st.getFloat("LIMIT", "0.6"),
+		MaxResults:      st.getInt("MAX_RESULTS", "2"),
+		MinResults:      st.getInt("MIN_RESULTS", "0"),
+		MaxChunkChars:   st.getInt("MAX_CHUNK_CHARS", "0"),
+		MaxQueryChars:   st.getInt("MAX_QUERY_CHARS", "0"),
+		OnLongQuery:     st.get("ON_LONG_QUERY", onLongQueryTruncate),
+		MaxResultChars:  st.getInt("MAX_RESULT_CHARS", "0"),
+		ScorePrecision:  st.getInt("SCORE_PRECISION", "3"),
+		QueryCacheSize:  st.getInt("QUERY_CACHE_SIZE", "256"),
+		ResultCacheSize: st.getInt("RESULT_CACHE_SIZE", "128"),
+		HighlightTerms:  st.getBool("HIGHLIGHT_TERMS", "false"),
+		CombinedResults: st.getBool("COMBINED_RESULTS", "false"),
+		MergeResults:    st.getBool("MERGE_RESULTS", "false"),
+		ResultTemplate:  st.get("RESULT_TEMPLATE", defaultResultTemplate),
+		QueryLogPath:    st.get("QUERY_LOG_PATH", ""),
+		FeedbackLogPath: st.get("FEEDBACK_LOG_PATH", ""),
+
+		RerankEnabled:          st.getBool("RERANK_ENABLED", "false"),
+		RerankModel:            st.get("RERANK_MODEL", "ai/qwen2.5:latest"),
+		RerankCandidatesFactor: st.getInt("RERANK_CANDIDATES_FACTOR", "3"),
+
+		RecencyWeight: st.getFloat("RECENCY_WEIGHT", "0"),
+
+		QueryExpansion:         st.getBool("QUERY_EXPANSION", "false"),
+		QueryExpansionModel:    st.get("QUERY_EXPANSION_MODEL", "ai/qwen2.5:latest"),
+		QueryExpansionVariants: st.getInt("QUERY_EXPANSION_VARIANTS", "3"),
+
+		LogLevel:  st.get("LOG_LEVEL", "info"),
+		LogFormat: st.get("LOG_FORMAT", "text"),
+	}
+
+	config.EmbeddingTimeout = st.getDuration("EMBEDDING_TIMEOUT", "30s")
+	config.EmbeddingQueueTimeout = st.getDuration("EMBEDDING_QUEUE_TIMEOUT", "5s")
+	config.IndexEmbeddingBackoff = st.getDuration("INDEX_EMBEDDING_BACKOFF", "500ms")
+	config.QueryEmbeddingBackoff = st.getDuration("QUERY_EMBEDDING_BACKOFF", "500ms")
+	config.PersistInterval = st.getDuration("PERSIST_INTERVAL", "0")
+	config.ExpirySweepInterval = st.getDuration("EXPIRY_SWEEP_INTERVAL", "1m")
+	config.RecencyHalfLife = st.getDuration("RECENCY_HALF_LIFE", "720h")
+	config.ResultCacheTTL = st.getDuration("RESULT_CACHE_TTL", "0")
+	config.ProgressInterval = st.getDuration("PROGRESS_INTERVAL", "10s")
+	config.ImportTimeout = st.getDuration("IMPORT_TIMEOUT", "30s")
+	config.ImportMaxBytes = int64(st.getInt("IMPORT_MAX_BYTES", "5242880"))
+	config.MaxSourceBytes = int64(st.getInt("MAX_SOURCE_BYTES", "1048576"))
+	config.StreamingThresholdBytes = int64(st.getInt("STREAMING_THRESHOLD_BYTES", "10485760"))
+	config.MaxArchiveEntryBytes = int64(st.getInt("MAX_ARCHIVE_ENTRY_BYTES", "10485760"))
+	// The first model of EMBEDDING_MODEL indexes, the next ones are fallbacks
+	if models := splitList(config.EmbeddingModel); len(models) > 0 {
+		config.EmbeddingModel, config.FallbackEmbeddingModels = models[0], models[1:]
+	}
+	config.ContentArchives = splitList(st.get("CONTENT_ARCHIVE", ""))
+	// The archives are the only content unless CONTENT_DIR is set too
+	if len(config.ContentArchives) > 0 && st.get("CONTENT_DIR", "") == "" {
+		config.ContentDirs = nil
+	}
+	// The globs of the boosts match the sources relative to the content directories
+	config.SourceBoosts = st.getSourceBoosts("SOURCE_BOOSTS", config.ContentDirs)
+	config.ExtensionDelimiters = map[string]string{}
+	for extension := range contentFileConverters {
+		name := "DELIMITER_" + strings.ToUpper(strings.TrimPrefix(extension, "."))
+		if delimiter := st.get(name, ""); delimiter != "" {
+			config.ExtensionDelimiters[extension] = delimiter
+		}
+	}
+
+	problems := append(st.problems, config.validate()...)
+	return config, errors.Join(problems...)
+}
+
+// validate checks the consistency of the parsed settings
+func (config *Config) validate() []error {
+	problems := []error{}
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			problems = append(problems, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(config.Limit >= 0 && config.Limit <= 1, "LIMIT: %g must be between 0 and 1", config.Limit)
+	check(config.ChunkStrategy == chunkStrategyDelimiter || config.ChunkStrategy == chunkStrategyAutoDelimiter ||
+		config.ChunkStrategy == chunkStrategyRecursive,
+		"CHUNK_STRATEGY: %q must be delimiter, autodelimiter or recursive", config.ChunkStrategy)
+	check(config.EmbeddingProvider == embeddingProviderOpenAI || config.EmbeddingProvider == embeddingProviderOllama,
+		"EMBEDDING_PROVIDER: %q must be openai or ollama", config.EmbeddingProvider)
+	check(config.EmbeddingModel != "", "EMBEDDING_MODEL: a model is required")
+	check(!slices.Contains(config.FallbackEmbeddingModels, config.EmbeddingModel),
+		"EMBEDDING_MODEL: the model %q can't be its own fallback", config.EmbeddingModel)
+	check(config.EmbeddingMaxRPS >= 0, "EMBEDDING_MAX_RPS: %g must not be negative", config.EmbeddingMaxRPS)
+	check(config.EmbeddingBurst > 0, "EMBEDDING_BURST: %d must be positive", config.EmbeddingBurst)
+	check(config.EmbeddingQueueTimeout >= 0, "EMBEDDING_QUEUE_TIMEOUT: %s must not be negative", config.EmbeddingQueueTimeout)
+	check(config.IndexEmbeddingRetries >= 0, "INDEX_EMBEDDING_RETRIES: %d must not be negative", config.IndexEmbeddingRetries)
+	check(config.IndexEmbeddingBackoff >= 0, "INDEX_EMBEDDING_BACKOFF: %s must not be negative", config.IndexEmbeddingBackoff)
+	check(config.QueryEmbeddingRetries >= 0, "QUERY_EMBEDDING_RETRIES: %d must not be negative", config.QueryEmbeddingRetries)
+	check(config.QueryEmbeddingBackoff >= 0, "QUERY_EMBEDDING_BACKOFF: %s must not be negative", config.QueryEmbeddingBackoff)
+	check(config.EmbeddingBatchSize > 0, "EMBEDDING_BATCH_SIZE: %d must be positive", config.EmbeddingBatchSize)
+	check(config.ChunkSize > 0, "CHUNK_SIZE: %d must be positive", config.ChunkSize)
+	check(config.ChunkOverlap >= 0 && config.ChunkOverlap < config.ChunkSize,
+		"CHUNK_OVERLAP: %d must not be negative and must be lower than CHUNK_SIZE", config.ChunkOverlap)
+	check(config.AutoDelimiterMinLength > 0, "AUTO_DELIMITER_MIN_LENGTH: %d must be positive", config.AutoDelimiterMinLength)
+	check(config.SentenceSnapChars >= 0, "SENTENCE_SNAP_CHARS: %d must not be negative", config.SentenceSnapChars)
+	check(config.StreamingThresholdBytes >= 0, "STREAMING_THRESHOLD_BYTES: %d must not be negative", config.StreamingThresholdBytes)
+	check(config.MaxArchiveEntryBytes > 0, "MAX_ARCHIVE_ENTRY_BYTES: %d must be positive", config.MaxArchiveEntryBytes)
+	check(config.DedupThreshold >= 0 && config.DedupThreshold <= 1, "DEDUP_THRESHOLD: %g must be between 0 and 1", config.DedupThreshold)
+	check(config.MaxResults > 0, "MAX_RESULTS: %d must be positive", config.MaxResults)
+	check(config.MinResults >= 0 && config.MinResults <= config.MaxResults,
+		"MIN_RESULTS: %d must not be negative and must not exceed MAX_RESULTS", config.MinResults)
+	check(config.MaxChunkChars >= 0, "MAX_CHUNK_CHARS: %d must not be negative", config.MaxChunkChars)
+	check(config.MaxQueryChars >= 0, "MAX_QUERY_CHARS: %d must not be negative", config.MaxQueryChars)
+	_, _, templateErr := resultTemplateParts(config.ResultTemplate)
+	check(templateErr == nil, "RESULT_TEMPLATE: %q is not a valid template: %v", config.ResultTemplate, templateErr)
+	check(config.OnLongQuery == onLongQueryTruncate || config.OnLongQuery == onLongQueryFail,
+		"ON_LONG_QUERY: %q must be truncate or fail", config.OnLongQuery)
+	check(config.MaxResultChars >= 0, "MAX_RESULT_CHARS: %d must not be negative", config.MaxResultChars)
+	check(config.ScorePrecision >= 0 && config.ScorePrecision <= 15, "SCORE_PRECISION: %d must be between 0 and 15", config.ScorePrecision)
+	check(config.QueryCacheSize >= 0, "QUERY_CACHE_SIZE: %d must not be negative", config.QueryCacheSize)
+	check(config.ResultCacheSize > 0, "RESULT_CACHE_SIZE: %d must be positive", config.ResultCacheSize)
+	check(config.ResultCacheTTL >= 0, "RESULT_CACHE_TTL: %s must not be negative", config.ResultCacheTTL)
+	check(config.RerankCandidatesFactor > 0, "RERANK_CANDIDATES_FACTOR: %d must be positive", config.RerankCandidatesFactor)
+	check(config.RecencyWeight >= 0 && config.RecencyWeight <= 1, "RECENCY_WEIGHT: %g must be between 0 and 1", config.RecencyWeight)
+	check(config.RecencyHalfLife > 0, "RECENCY_HALF_LIFE: %s must be positive", config.RecencyHalfLife)
+	check(config.QueryExpansionVariants > 0, "QUERY_EXPANSION_VARIANTS: %d must be positive", config.QueryExpansionVariants)
+	check(config.EmbeddingTimeout >= 0, "EMBEDDING_TIMEOUT: %s must not be negative", config.EmbeddingTimeout)
+	check(config.ProgressInterval >= 0, "PROGRESS_INTERVAL: %s must not be negative", config.ProgressInterval)
+	check(config.PersistInterval >= 0, "PERSIST_INTERVAL: %s must not be negative", config.PersistInterval)
+	check(config.ExpirySweepInterval >= 0, "EXPIRY_SWEEP_INTERVAL: %s must not be negative", config.ExpirySweepInterval)
+	check(config.StoreBackend == storeBackendJSON || config.StoreBackend == storeBackendSQLite,
+		"STORE_BACKEND: %q must be json or sqlite", config.StoreBackend)
+	check(!config.ANNEnabled || config.StoreBackend == storeBackendJSON, "ANN_ENABLED: the ANN index requires the json STORE_BACKEND")
+	check(config.ANNMinRecords >= 0, "ANN_MIN_RECORDS: %d must not be negative", config.ANNMinRecords)
+	check(config.ANNM >= 2, "ANN_M: %d must be at least 2", config.ANNM)
+	check(config.ANNEfConstruction > 0, "ANN_EF_CONSTRUCTION: %d must be positive", config.ANNEfConstruction)
+	check(config.ANNEfSearch > 0, "ANN_EF_SEARCH: %d must be positive", config.ANNEfSearch)
+	check(config.ImportTimeout >= 0, "IMPORT_TIMEOUT: %s must not be negative", config.ImportTimeout)
+	check(config.ImportMaxBytes > 0, "IMPORT_MAX_BYTES: %d must be positive", config.ImportMaxBytes)
+	check(config.MaxSourceBytes > 0, "MAX_SOURCE_BYTES: %d must be positive", config.MaxSourceBytes)
+	check(config.OnModelMismatch == onModelMismatchFail || config.OnModelMismatch == onModelMismatchReindex,
+		"ON_MODEL_MISMATCH: %q must be fail or reindex", config.OnModelMismatch)
+	check(!config.ReadOnly || !config.ForceReindex, "FORCE_REINDEX: the vector store can't be rebuilt with READ_ONLY")
+	check(!config.ReadOnly || !config.AllowReset, "ALLOW_RESET: the reset_store tool can't be enabled with READ_ONLY")
+	check(!config.ReadOnly || config.OnModelMismatch != onModelMismatchReindex,
+		"ON_MODEL_MISMATCH: the vector store can't be reindexed with READ_ONLY, use fail")
+	check(slices.Contains([]string{quantizationNone, quantizationFloat16, quantizationInt8}, config.VectorQuantization),
+		"VECTOR_QUANTIZATION: %q must be none, float16 or int8", config.VectorQuantization)
+	check(config.MinContentFiles >= 0, "MIN_CONTENT_FILES: %d must not be negative", config.MinContentFiles)
+	check(config.OnTooFewContentFiles == onTooFewContentFilesWarn || config.OnTooFewContentFiles == onTooFewContentFilesFail,
+		"ON_TOO_FEW_CONTENT_FILES: %q must be warn or fail", config.OnTooFewContentFiles)
+	check(slices.Contains([]string{"debug", "info", "warn", "warning", "error"}, strings.ToLower(config.LogLevel)),
+		"LOG_LEVEL: %q must be debug, info, warn or error", config.LogLevel)
+	check(slices.Contains([]string{"text", "json"}, strings.ToLower(config.LogFormat)),
+		"LOG_FORMAT: %q must be text or json", config.LogFormat)
+	check((config.TLSCertFile == "") == (config.TLSKeyFile == ""), "TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+
+	check(len(config.ContentDirs) > 0 || len(config.ContentArchives) > 0, "CONTENT_DIR: at least one directory (or a CONTENT_ARCHIVE) is required")
+	for idx, contentDir := range config.ContentDirs {
+		info, err := os.Stat(contentDir)
+		check(err == nil && info.IsDir(), "CONTENT_DIR: %q doesn't exist or is not a directory", contentDir)
+		if err == nil && info.IsDir() {
+			readErr := checkDirReadable(contentDir)
+			check(readErr == nil, "CONTENT_DIR: %q is not readable: %v", contentDir, readErr)
+		}
+		// The files of nested directories would be indexed twice
+		for _, other := range config.ContentDirs[:idx] {
+			check(!isNestedDir(contentDir, other) && !isNestedDir(other, contentDir),
+				"CONTENT_DIR: %q and %q overlap, one contains the other", other, contentDir)
+		}
+	}
+	for _, archivePath := range config.ContentArchives {
+		check(isContentArchive(archivePath), "CONTENT_ARCHIVE: %q must be a .zip, .tar, .tar.gz or .tgz file", archivePath)
+		info, err := os.Stat(archivePath)
+		check(err == nil && info.Mode().IsRegular(), "CONTENT_ARCHIVE: %q doesn't exist or is not a file", archivePath)
+	}
+
+	return problems
+}
+
+// StoreModel returns the embedding model recorded in the store: the
+// embedding model, with the DOCUMENT_PREFIX when there is one, since the
+// prefix changes the vectors of the stored chunks
+func (config *Config) StoreModel() string {
+	if config.DocumentPrefix == "" {
+		return config.EmbeddingModel
+	}
+	return fmt.Sprintf("%s (document prefix %q)", config.EmbeddingModel, config.DocumentPrefix)
+}
+
+// IndexRetryPolicy returns how the embedding calls of the indexing are retried
+func (config *Config) IndexRetryPolicy() retryPolicy {
+	return retryPolicy{phase: phaseIndex, retries: config.IndexEmbeddingRetries, backoff: config.IndexEmbeddingBackoff}
+}
+
+// QueryRetryPolicy returns how the embedding calls of the searches are retried
+func (config *Config) QueryRetryPolicy() retryPolicy {
+	return retryPolicy{phase: phaseQuery, retries: config.QueryEmbeddingRetries, backoff: config.QueryEmbeddingBackoff}
+}
+
+// DelimiterFor returns the delimiter of a content file: the DELIMITER_<EXT>
+// of its extension when it is set, or else delimiter
+func (config *Config) DelimiterFor(path string, delimiter string) string {
+	if extensionDelimiter, ok := config.ExtensionDelimiters[strings.ToLower(filepath.Ext(path))]; ok {
+		return extensionDelimiter
+	}
+	return delimiter
+}
+
+// StoreFilePath returns the path of the store file of the selected backend
+func (config *Config) StoreFilePath() string {
+	if config.StoreBackend == storeBackendSQLite {
+		return config.SQLiteFilePath
+	}
+	return config.JSONStoreFilePath
+}
+
+// isNestedDir tells whether dir is parent or one of its subdirectories
+func isNestedDir(dir string, parent string) bool {
+	absoluteDir, err := filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+	absoluteParent, err := filepath.Abs(parent)
+	if err != nil {
+		return false
+	}
+	relative, err := filepath.Rel(absoluteParent, absoluteDir)
+	return err == nil && relative != ".." && !strings.HasPrefix(relative, ".."+string(filepath.Separator))
+}
+
+// splitList returns the non-empty items of a comma-separated list
+func splitList(csv string) []string {
+	items := []string{}
+	for _, item := range strings.Split(csv, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// readConfigFile returns the path and the settings (as strings) of the YAML
+// config file, or no settings when the default config file doesn't exist
+func readConfigFile(path string) (string, map[string]string, error) {
+	explicit := path != ""
+	if !explicit {
+		path = defaultConfigFile
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) && !explicit {
+			return "", map[string]string{}, nil
+		}
+		return "", nil, fmt.Errorf("unable to read the config file: %w", err)
+	}
+
+	var values map[string]any
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return "", nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+
+	file := make(map[string]string, len(values))
+	for key, value := range values {
+		switch typed := value.(type) {
+		case nil:
+			continue
+		case []any:
+			// lists, like the CORS origins, are comma-separated in the environment
+			items := make([]string, 0, len(typed))
+			for _, item := range typed {
+				items = append(items, fmt.Sprint(item))
+			}
+			file[strings.ToLower(key)] = strings.Join(items, ",")
+		default:
+			file[strings.ToLower(key)] = fmt.Sprint(typed)
+		}
+	}
+	return path, file, nil
+}
+
+// checkDirReadable checks that the entries of a directory can be listed
+func checkDirReadable(dir string) error {
+	file, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err := file.Readdirnames(1); err != nil && err != io.EOF {
+		return err
+	}
+	return nil
+}
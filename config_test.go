@@ -0,0 +1,97 @@
+package main
+
+import (
+	"maps"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfigValidatesLogSettings(t *testing.T) {
+	tests := []struct {
+		name      string
+		logLevel  string
+		logFormat string
+		problem   string
+	}{
+		{name: "defaults"},
+		{name: "valid values", logLevel: "debug", logFormat: "json"},
+		{name: "case-insensitive", logLevel: "WARNING", logFormat: "JSON"},
+		{name: "level typo", logLevel: "inof", problem: `LOG_LEVEL: "inof"`},
+		{name: "format typo", logFormat: "jsno", problem: `LOG_FORMAT: "jsno"`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("CONTENT_DIR", t.TempDir())
+			t.Setenv("LOG_LEVEL", test.logLevel)
+			t.Setenv("LOG_FORMAT", test.logFormat)
+
+			_, err := loadConfig(nil)
+			if test.problem == "" {
+				if err != nil {
+					t.Fatalf("loadConfig() failed: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.problem) {
+				t.Fatalf("loadConfig() error = %v, want a problem containing %s", err, test.problem)
+			}
+		})
+	}
+}
+
+func TestGetHeaders(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		headers map[string]string
+		problem bool
+	}{
+		{name: "empty", value: "", headers: map[string]string{}},
+		{name: "single", value: "X-Tenant: acme", headers: map[string]string{"X-Tenant": "acme"}},
+		{
+			name:    "several",
+			value:   "X-Tenant: acme, X-Gateway-Token: secret",
+			headers: map[string]string{"X-Tenant": "acme", "X-Gateway-Token": "secret"},
+		},
+		{
+			name:    "comma in a value",
+			value:   "Accept: text/html, application/json;q=0.9,*/*, X-Tenant: acme",
+			headers: map[string]string{"Accept": "text/html, application/json;q=0.9,*/*", "X-Tenant": "acme"},
+		},
+		{
+			name:    "colon in a value",
+			value:   "X-Callback: https://example.com:8443/hook, Cache-Control: no-cache, no-store",
+			headers: map[string]string{"X-Callback": "https://example.com:8443/hook", "Cache-Control": "no-cache, no-store"},
+		},
+		{name: "trailing comma", value: "X-Tenant: acme,", headers: map[string]string{"X-Tenant": "acme"}},
+		{name: "no colon", value: "X-Tenant", headers: map[string]string{}, problem: true},
+		{name: "space in the name", value: "X Tenant: acme", headers: map[string]string{}, problem: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			st := &settings{flags: map[string]string{"EMBEDDING_HEADERS": test.value}}
+			headers := st.getHeaders("EMBEDDING_HEADERS")
+			if !maps.Equal(headers, test.headers) {
+				t.Errorf("getHeaders(%q) = %q, want %q", test.value, headers, test.headers)
+			}
+			if problem := len(st.problems) > 0; problem != test.problem {
+				t.Errorf("getHeaders(%q) problems = %v, want a problem: %t", test.value, st.problems, test.problem)
+			}
+		})
+	}
+}
+
+func TestStoreFlagsSetThePathOfTheirBackend(t *testing.T) {
+	t.Setenv("CONTENT_DIR", t.TempDir())
+	for _, backend := range []string{storeBackendJSON, storeBackendSQLite} {
+		t.Setenv("STORE_BACKEND", backend)
+		loaded, err := loadConfig([]string{"-store", "flag.json", "-sqlite-store", "flag.db"})
+		if err != nil {
+			t.Fatalf("loadConfig failed: %v", err)
+		}
+		want := map[string]string{storeBackendJSON: "flag.json", storeBackendSQLite: "flag.db"}[backend]
+		if path := loaded.StoreFilePath(); path != want {
+			t.Errorf("the %s store path is %q, want %q", backend, path, want)
+		}
+	}
+}
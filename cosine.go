@@ -0,0 +1,127 @@
+package main
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// errInvalidEmbedding is the error of a vector whose cosine similarities are
+// undefined, which would corrupt the ranking of the results
+var errInvalidEmbedding = errors.New("invalid embedding vector")
+
+// checkEmbedding fails when a vector is empty, all zeros or has a NaN or
+// infinite component, as some embedding backends return for empty or garbage input
+func checkEmbedding(vector []float64) error {
+	if len(vector) == 0 {
+		return fmt.Errorf("%w: the vector is empty", errInvalidEmbedding)
+	}
+	zero := true
+	for idx, value := range vector {
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return fmt.Errorf("%w: the component %d is %g", errInvalidEmbedding, idx, value)
+		}
+		if value != 0 {
+			zero = false
+		}
+	}
+	if zero {
+		return fmt.Errorf("%w: the vector has a zero magnitude", errInvalidEmbedding)
+	}
+	return nil
+}
+
+// getTopNRecords returns the top N records sorted by highest ranking score
+// (see rankingScore). The ties are sorted by ID, so the same search always returns the same order
+// whatever the order of the records.
+func getTopNRecords(records []SnippetRecord, max int) []SnippetRecord {
+	sort.Slice(records, func(i, j int) bool {
+		return ranksBefore(records[i], records[j])
+	})
+
+	if len(records) < max {
+		return records
+	}
+	return records[:max]
+}
+
+// ranksBefore tells whether a record ranks before another in the results:
+// it has a higher ranking score, or the same one and a lower ID
+func ranksBefore(a SnippetRecord, b SnippetRecord) bool {
+	if scoreA, scoreB := rankingScore(a), rankingScore(b); scoreA != scoreB {
+		return scoreA > scoreB
+	}
+	return a.Id < b.Id
+}
+
+// topNRecords keeps the max best ranked records added during a scan, in a
+// bounded min-heap whose root is the worst kept record, so the scan keeps
+// max records instead of sorting all the scored ones. It implements
+// heap.Interface.
+type topNRecords struct {
+	max     int
+	records []SnippetRecord
+}
+
+// newTopNRecords creates a heap keeping the max best ranked records
+func newTopNRecords(max int) *topNRecords {
+	// A large max is rarely reached: the heap grows as needed
+	capacity := min(max, 64)
+	if capacity < 0 {
+		capacity = 0
+	}
+	return &topNRecords{max: max, records: make([]SnippetRecord, 0, capacity)}
+}
+
+func (t *topNRecords) Len() int           { return len(t.records) }
+func (t *topNRecords) Less(i, j int) bool { return ranksBefore(t.records[j], t.records[i]) }
+func (t *topNRecords) Swap(i, j int)      { t.records[i], t.records[j] = t.records[j], t.records[i] }
+func (t *topNRecords) Push(record any)    { t.records = append(t.records, record.(SnippetRecord)) }
+func (t *topNRecords) Pop() any {
+	last := t.records[len(t.records)-1]
+	t.records = t.records[:len(t.records)-1]
+	return last
+}
+
+// add keeps a record when it ranks among the max best records added so far
+func (t *topNRecords) add(record SnippetRecord) {
+	switch {
+	case len(t.records) < t.max:
+		heap.Push(t, record)
+	case t.max > 0 && ranksBefore(record, t.records[0]):
+		t.records[0] = record
+		heap.Fix(t, 0)
+	}
+}
+
+// sorted returns the kept records, from the best to the worst ranked, in
+// the order of getTopNRecords
+func (t *topNRecords) sorted() []SnippetRecord {
+	return getTopNRecords(t.records, t.max)
+}
+
+// dotProduct calculates the dot product of two equal-length vectors
+func dotProduct(v1 []float64, v2 []float64) float64 {
+	sum := 0.0
+	for i := range v1 {
+		sum += v1[i] * v2[i]
+	}
+	return sum
+}
+
+// vectorNorm calculates the L2 norm of a vector
+func vectorNorm(v []float64) float64 {
+	return math.Sqrt(dotProduct(v, v))
+}
+
+// cosineSimilarityWithNorms calculates the cosine similarity between two
+// vectors whose norms are already known, e.g. cached with the stored vectors
+func cosineSimilarityWithNorms(v1, v2 []float64, norm1, norm2 float64) float64 {
+	if norm1 <= 0.0 || norm2 <= 0.0 {
+		// Handle potential division by zero
+		return 0.0
+	}
+	return dotProduct(v1, v2) / (norm1 * norm2)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"testing"
+
+	"github.com/micro-agent/micro-agent-go/agent/rag"
+)
+
+func TestSearchSortsTiedScoresByID(t *testing.T) {
+	// Duplicated chunks have the same embedding, hence tied scores
+	tied := []string{}
+	for idx := range 30 {
+		tied = append(tied, fmt.Sprintf("tied-%02d", idx))
+	}
+	setupServer(t, nil, nil)
+	question := rag.VectorRecord{Embedding: []float64{1, 0}}
+
+	for _, ann := range []bool{false, true} {
+		t.Run(fmt.Sprintf("ANN %t", ann), func(t *testing.T) {
+			random := rand.New(rand.NewPCG(3, 5))
+			var previous []string
+			for range 5 {
+				// Each store saves the records in another order
+				snippetStore := NewSnippetStore(false, false, false, quantizationNone)
+				if ann {
+					snippetStore.EnableANN(hnswParams{M: 16, EfConstruction: 100, EfSearch: 64}, 0)
+				}
+				snippetStore.Save(testRecord("best", "snippets/go.md", "best chunk", 1, 0))
+				snippetStore.Save(testRecord("worst", "snippets/go.md", "worst chunk", 0, 1))
+				for _, idx := range random.Perm(len(tied)) {
+					snippetStore.Save(testRecord(tied[idx], "snippets/go.md", "duplicated chunk", 1, 1))
+				}
+
+				results, err := snippetStore.SearchTopNSimilarities(context.Background(), question, -1, 11, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				ids := resultIDs(results)
+				want := append([]string{"best"}, tied[:10]...)
+				if !slices.Equal(ids, want) {
+					t.Fatalf("the search returned %v, want %v", ids, want)
+				}
+				if previous != nil && !slices.Equal(ids, previous) {
+					t.Fatalf("the same search returned %v, then %v", previous, ids)
+				}
+				previous = ids
+			}
+		})
+	}
+}
+
+func TestInvalidEmbeddingsRejected(t *testing.T) {
+	invalid := map[string][]float64{
+		"empty":    {},
+		"zero":     {0, 0, 0},
+		"NaN":      {1, math.NaN(), 0},
+		"infinite": {1, math.Inf(-1), 0},
+	}
+	for name, vector := range invalid {
+		t.Run(name, func(t *testing.T) {
+			if err := checkEmbedding(vector); !errors.Is(err, errInvalidEmbedding) {
+				t.Errorf("checkEmbedding(%v) = %v, want errInvalidEmbedding", vector, err)
+			}
+
+			// At indexing, the chunk is skipped
+			snippetStore := setupServer(t, func(context.Context, string) ([]float64, error) {
+				return vector, nil
+			}, nil)
+			saved, err := indexChunk(context.Background(), 0, testRecord("invalid", "snippets/go.md", "chunk"))
+			if err != nil || saved || snippetStore.Count() != 0 {
+				t.Errorf("indexChunk() = %t, %v, the store holds %d records, want the chunk skipped", saved, err, snippetStore.Count())
+			}
+
+			// At query time, the search fails
+			snippetStore.Save(testRecord("valid", "snippets/go.md", "chunk", 1, 0, 0))
+			if _, err := searchInDocHandler(context.Background(), toolRequest("search_snippet", map[string]any{"topic": "hello"})); !errors.Is(err, errInvalidEmbedding) {
+				t.Errorf("searchInDocHandler() error = %v, want errInvalidEmbedding", err)
+			}
+			if _, err := searchByVectorHandler(context.Background(), toolRequest("search_by_vector", map[string]any{"vector": vector})); !errors.Is(err, errInvalidEmbedding) {
+				t.Errorf("searchByVectorHandler() error = %v, want errInvalidEmbedding", err)
+			}
+		})
+	}
+
+	if err := checkEmbedding([]float64{0, -0.5, 1e-300}); err != nil {
+		t.Errorf("checkEmbedding() of a valid vector failed: %v", err)
+	}
+}
+
+func TestTopNRecordsMatchesFullSort(t *testing.T) {
+	random := rand.New(rand.NewPCG(13, 17))
+	for trial := range 200 {
+		count := random.IntN(300)
+		records := make([]SnippetRecord, count)
+		for idx := range records {
+			records[idx] = testRecord(fmt.Sprintf("record-%03d", random.IntN(1000)), "snippets/go.md", "chunk")
+			// Few distinct scores, so many ties
+			records[idx].CosineSimilarity = float64(random.IntN(10)) / 10
+		}
+		for _, max := range []int{0, 1, 5, count / 2, count, count + 3} {
+			top := newTopNRecords(max)
+			for _, record := range records {
+				top.add(record)
+			}
+			got := top.sorted()
+			want := getTopNRecords(slices.Clone(records), max)
+			if !slices.EqualFunc(got, want, func(a, b SnippetRecord) bool {
+				return a.Id == b.Id && a.CosineSimilarity == b.CosineSimilarity
+			}) {
+				t.Fatalf("trial %d, top %d of %d records: the heap kept %v, the full sort %v", trial, max, count, resultIDs(got), resultIDs(want))
+			}
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// dryRunBuckets are the upper bounds, in characters, of the buckets of the
+// chunk size histograms; the last bucket holds the larger chunks
+var dryRunBuckets = []int{128, 256, 512, 1024, 2048, 4096}
+
+// chunkSizes summarizes the sizes, in characters, of chunks
+type chunkSizes struct {
+	chunks  int
+	total   int
+	min     int
+	max     int
+	buckets []int
+}
+
+func newChunkSizes() *chunkSizes {
+	return &chunkSizes{buckets: make([]int, len(dryRunBuckets)+1)}
+}
+
+// add counts a chunk
+func (s *chunkSizes) add(chunk SnippetRecord) {
+	size := utf8.RuneCountInString(chunk.Prompt)
+	if s.chunks == 0 || size < s.min {
+		s.min = size
+	}
+	s.max = max(s.max, size)
+	s.chunks++
+	s.total += size
+	bucket := 0
+	for bucket < len(dryRunBuckets) && size >= dryRunBuckets[bucket] {
+		bucket++
+	}
+	s.buckets[bucket]++
+}
+
+// write prints the counts and the histogram of the sizes
+func (s *chunkSizes) write(w io.Writer, name string) {
+	if s.chunks == 0 {
+		fmt.Fprintf(w, "%s: 0 chunks\n", name)
+		return
+	}
+	fmt.Fprintf(w, "%s: %d chunks, %d to %d chars (average %d)\n", name, s.chunks, s.min, s.max, s.total/s.chunks)
+	for bucket, count := range s.buckets {
+		if count == 0 {
+			continue
+		}
+		label := fmt.Sprintf("%d+", dryRunBuckets[len(dryRunBuckets)-1])
+		if bucket < len(dryRunBuckets) {
+			label = fmt.Sprintf("< %d", dryRunBuckets[bucket])
+		}
+		bar := strings.Repeat("#", max(1, count*40/s.chunks))
+		fmt.Fprintf(w, "  %-7s %6d %s\n", label, count, bar)
+	}
+}
+
+// dryRun chunks the content files like buildStore, and prints to w the number
+// of chunks and the histogram of their sizes per file and for all the files,
+// without creating the embeddings nor saving the store (DRY_RUN)
+func dryRun(w io.Writer, delimiter string) error {
+	fmt.Fprintf(w, "Dry run: CHUNK_STRATEGY=%s CHUNK_SIZE=%d CHUNK_OVERLAP=%d DELIMITER=%q",
+		config.ChunkStrategy, config.ChunkSize, config.ChunkOverlap, delimiter)
+	extensions := slices.Sorted(maps.Keys(config.ExtensionDelimiters))
+	for _, extension := range extensions {
+		fmt.Fprintf(w, " DELIMITER_%s=%q", strings.ToUpper(strings.TrimPrefix(extension, ".")), config.ExtensionDelimiters[extension])
+	}
+	fmt.Fprint(w, "\n\n")
+	files := 0
+	all := newChunkSizes()
+	duplicates := newFileDeduplicator(config.DedupFiles)
+	err := walkContentDirs(config.ContentDirs, config.IgnorePatterns, func(contentDir string, path string) error {
+		convert, ok := contentFileConverters[strings.ToLower(filepath.Ext(path))]
+		if !ok {
+			return nil
+		}
+		if duplicate, err := duplicates.check(path); err != nil || duplicate {
+			return err
+		}
+		files++
+		sizes := newChunkSizes()
+		count := func(chunk SnippetRecord) {
+			sizes.add(chunk)
+			all.add(chunk)
+		}
+		delimiter := config.DelimiterFor(path, delimiter)
+		if convert == nil && isStreamed(path, delimiter) {
+			if err := streamContentChunks(path, delimiter, count); err != nil {
+				return err
+			}
+		} else {
+			chunks, err := readContentChunks(path, convert, delimiter)
+			if err != nil {
+				return err
+			}
+			for _, chunk := range chunks {
+				count(chunk)
+			}
+		}
+		sizes.write(w, path)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to chunk the content files: %w", err)
+	}
+	for _, archivePath := range config.ContentArchives {
+		err := walkArchiveChunks(archivePath, config.IgnorePatterns, delimiter, func(name string, chunks []SnippetRecord) {
+			files++
+			sizes := newChunkSizes()
+			for _, chunk := range chunks {
+				sizes.add(chunk)
+				all.add(chunk)
+			}
+			sizes.write(w, fmt.Sprintf("%s (%s)", name, archivePath))
+		})
+		if err != nil {
+			return fmt.Errorf("failed to chunk the content archive %s: %w", archivePath, err)
+		}
+	}
+	fmt.Fprintln(w)
+	all.write(w, fmt.Sprintf("Total (%d files)", files))
+	return nil
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/micro-agent/micro-agent-go/agent/mu"
+	"github.com/openai/openai-go/v2"
+)
+
+// Embedding providers, the APIs of the embedding backend
+const (
+	embeddingProviderOpenAI = "openai"
+	embeddingProviderOllama = "ollama"
+)
+
+// Embedder creates the embedding vector of a text. The indexing and the
+// search only depend on it, each EMBEDDING_PROVIDER implementing it for the
+// API of its backend.
+type Embedder interface {
+	GenerateEmbeddingVector(ctx context.Context, content string) ([]float64, error)
+}
+
+// batchEmbedder is an Embedder which can also create the embeddings of
+// several texts with a single request
+type batchEmbedder interface {
+	Embedder
+	GenerateEmbeddingVectors(ctx context.Context, contents []string) ([][]float64, error)
+}
+
+// embeddingModel is the Embedder of an embedding model, with the name of
+// the model and the factory of the embedders of the other models of its
+// provider, for the searches with another model
+type embeddingModel struct {
+	Embedder
+	model       string
+	newEmbedder func(model string) Embedder
+	// fallbacks embed the search queries, in order, when the model fails
+	fallbacks []*embeddingModel
+}
+
+// newEmbeddingModel creates the embedder of a model with the factory of
+// its provider
+func newEmbeddingModel(model string, newEmbedder func(model string) Embedder) *embeddingModel {
+	return &embeddingModel{
+		Embedder:    newEmbedder(model),
+		model:       model,
+		newEmbedder: newEmbedder,
+	}
+}
+
+// withFallbacks sets the models embedding the search queries when the model
+// fails (never the indexed chunks, whose vectors must all come from the same model)
+func (e *embeddingModel) withFallbacks(models []string) *embeddingModel {
+	for _, model := range models {
+		e.fallbacks = append(e.fallbacks, newEmbeddingModel(model, e.newEmbedder))
+	}
+	return e
+}
+
+// GenerateEmbeddingVectors creates the embeddings of several contents, in
+// their order, with a single request when the provider supports it, or else
+// with a request per content
+func (e *embeddingModel) GenerateEmbeddingVectors(ctx context.Context, contents []string) ([][]float64, error) {
+	if batch, ok := e.Embedder.(batchEmbedder); ok {
+		return batch.GenerateEmbeddingVectors(ctx, contents)
+	}
+	vectors := make([][]float64, 0, len(contents))
+	for _, content := range contents {
+		vector, err := e.GenerateEmbeddingVector(ctx, content)
+		if err != nil {
+			return nil, err
+		}
+		vectors = append(vectors, vector)
+	}
+	return vectors, nil
+}
+
+// embedderFactory returns the factory of the embedders of a provider:
+// the OpenAI-compatible API through client, or the Ollama API at baseURL
+func embedderFactory(provider string, client openai.Client, baseURL string, headers map[string]string, timeout time.Duration) func(model string) Embedder {
+	if provider == embeddingProviderOllama {
+		return func(model string) Embedder {
+			return newOllamaEmbedder(baseURL, headers, model, timeout)
+		}
+	}
+	return func(model string) Embedder {
+		return newOpenAIEmbedder(client, model, timeout)
+	}
+}
+
+// openAIEmbedder generates embedding vectors through an OpenAI-compatible API,
+// with a micro-agent
+type openAIEmbedder struct {
+	client  openai.Client
+	model   string
+	timeout time.Duration
+}
+
+// newOpenAIEmbedder creates an embedder for the given model;
+// a timeout of 0 means the embedding calls have no deadline.
+func newOpenAIEmbedder(client openai.Client, model string, timeout time.Duration) *openAIEmbedder {
+	return &openAIEmbedder{
+		client:  client,
+		model:   model,
+		timeout: timeout,
+	}
+}
+
+// GenerateEmbeddingVector creates the embedding of content. The call is
+// cancelled when ctx is done or when the embedder timeout is exceeded.
+func (e *openAIEmbedder) GenerateEmbeddingVector(ctx context.Context, content string) ([]float64, error) {
+	if e.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.timeout)
+		defer cancel()
+	}
+
+	// The agent is bound to ctx for its whole life, so create one per call
+	embeddingAgent, err := mu.NewAgent(ctx, "vector-agent",
+		mu.WithClient(e.client),
+		mu.WithEmbeddingParams(
+			openai.EmbeddingNewParams{
+				Model: e.model,
+			},
+		),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return embeddingAgent.GenerateEmbeddingVector(content)
+}
+
+// GenerateEmbeddingVectors creates the embeddings of several contents with a
+// single request, in the order of the contents. The embedding of a content
+// missing from the response is nil.
+func (e *openAIEmbedder) GenerateEmbeddingVectors(ctx context.Context, contents []string) ([][]float64, error) {
+	if e.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.timeout)
+		defer cancel()
+	}
+
+	response, err := e.client.Embeddings.New(ctx, openai.EmbeddingNewParams{
+		Model: e.model,
+		Input: openai.EmbeddingNewParamsInputUnion{OfArrayOfStrings: contents},
+	})
+	if err != nil {
+		return nil, err
+	}
+	vectors := make([][]float64, len(contents))
+	for _, data := range response.Data {
+		if data.Index < 0 || int(data.Index) >= len(contents) {
+			return nil, fmt.Errorf("unexpected embedding index %d in a batch of %d", data.Index, len(contents))
+		}
+		vectors[data.Index] = data.Embedding
+	}
+	return vectors, nil
+}
+
+// modelEmbedders caches the embedders of the models requested per search,
+// once they successfully created an embedding
+var modelEmbedders sync.Map
+
+// embedderFor returns the embedder of a model, the default embedder when
+// model is empty or the configured embedding model
+func embedderFor(model string) *embeddingModel {
+	if model == "" || model == embedder.model {
+		return embedder
+	}
+	if cached, ok := modelEmbedders.Load(model); ok {
+		return cached.(*embeddingModel)
+	}
+	return newEmbeddingModel(model, embedder.newEmbedder)
+}
+
+// warmUpEmbedding embeds a short text, so a lazily loaded model is loaded
+// before the store is reported ready and the first search is served
+func warmUpEmbedding(ctx context.Context) {
+	slog.Info("🔥 Warming up the embedding model", "model", embedder.model)
+	start := time.Now()
+	_, err := embedder.GenerateEmbeddingVector(ctx, "warm-up")
+	if err != nil {
+		slog.Warn("🔶 Embedding model warm-up failed", "model", embedder.model, "duration", time.Since(start), "error", err)
+		return
+	}
+	slog.Info("🔥 Embedding model warmed up", "model", embedder.model, "duration", time.Since(start))
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/micro-agent/micro-agent-go/agent/mu"
+	"github.com/openai/openai-go/v2"
+)
+
+const expansionSystemInstructions = `You rewrite search queries for a code snippets search engine.
+Given a query, write %d different paraphrases of it, using other words,
+synonyms or related technical terms, keeping its meaning.
+Answer with one paraphrase per line, without numbering nor explanations.`
+
+// expansionListMarker matches the numbering or the bullet of a list item
+var expansionListMarker = regexp.MustCompile(`^\s*(\d+[.)]|[-*•])\s*`)
+
+// llmQueryExpander generates paraphrases of the search queries with a chat
+// model, so chunks worded differently from the query are found too
+type llmQueryExpander struct {
+	client   openai.Client
+	model    string
+	timeout  time.Duration
+	variants int
+}
+
+// newLLMQueryExpander creates an expander generating variants paraphrases
+// with the given chat model; a timeout of 0 means the calls have no deadline.
+func newLLMQueryExpander(client openai.Client, model string, timeout time.Duration, variants int) *llmQueryExpander {
+	return &llmQueryExpander{
+		client:   client,
+		model:    model,
+		timeout:  timeout,
+		variants: variants,
+	}
+}
+
+// Expand returns up to variants paraphrases of the query, distinct from it.
+// A failing model returns no paraphrase, so the search degrades to the query alone.
+func (e *llmQueryExpander) Expand(ctx context.Context, query string) []string {
+	answer, err := e.generate(ctx, query)
+	if err != nil {
+		slog.Warn("🔶 Unable to expand the query, searching it alone", "topic", query, "error", err)
+		return nil
+	}
+
+	seen := map[string]bool{strings.ToLower(strings.TrimSpace(query)): true}
+	paraphrases := []string{}
+	for _, line := range strings.Split(answer, "\n") {
+		paraphrase := strings.Trim(expansionListMarker.ReplaceAllString(line, ""), " \t\"")
+		key := strings.ToLower(paraphrase)
+		if paraphrase == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		paraphrases = append(paraphrases, paraphrase)
+		if len(paraphrases) == e.variants {
+			break
+		}
+	}
+	slog.Debug("🔀 Paraphrases generated", "topic", query, "paraphrases", paraphrases)
+	return paraphrases
+}
+
+// generate asks the chat model for the paraphrases of the query
+func (e *llmQueryExpander) generate(ctx context.Context, query string) (string, error) {
+	if e.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.timeout)
+		defer cancel()
+	}
+
+	expansionAgent, err := mu.NewAgent(ctx, "expansion-agent",
+		mu.WithClient(e.client),
+		mu.WithParams(openai.ChatCompletionNewParams{
+			Model:       e.model,
+			Temperature: openai.Opt(0.7),
+		}),
+	)
+	if err != nil {
+		return "", err
+	}
+
+	return expansionAgent.Run([]openai.ChatCompletionMessageParamUnion{
+		openai.SystemMessage(fmt.Sprintf(expansionSystemInstructions, e.variants)),
+		openai.UserMessage(query),
+	})
+}
+
+// mergeByMaxScore merges the results of the searches of a query and of its
+// paraphrases: a record found by several searches keeps its best ranking score.
+// It returns the max most similar records.
+func mergeByMaxScore(results [][]SnippetRecord, max int) []SnippetRecord {
+	if len(results) == 1 {
+		return results[0]
+	}
+	best := map[string]SnippetRecord{}
+	for _, similarities := range results {
+		for _, similarity := range similarities {
+			if found, ok := best[similarity.Id]; !ok || rankingScore(similarity) > rankingScore(found) {
+				best[similarity.Id] = similarity
+			}
+		}
+	}
+	merged := make([]SnippetRecord, 0, len(best))
+	for _, similarity := range best {
+		merged = append(merged, similarity)
+	}
+	return getTopNRecords(merged, max)
+}
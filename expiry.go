@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/server"
+	"gopkg.in/yaml.v3"
+)
+
+// maxFrontmatterLines bounds the lines read to find the end of a frontmatter
+const maxFrontmatterLines = 100
+
+// isExpired tells whether a record has an expiration date which is past
+func isExpired(record SnippetRecord, now time.Time) bool {
+	return record.ExpiresAt != nil && !now.Before(*record.ExpiresAt)
+}
+
+// parseExpiry parses an expiration date, an RFC 3339 timestamp
+// (2025-06-30T18:00:00Z) or a date (2025-06-30, at midnight UTC)
+func parseExpiry(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if expiresAt, err := time.Parse(time.RFC3339, value); err == nil {
+		return expiresAt, nil
+	}
+	expiresAt, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid expiration date %q, expected 2006-01-02 or 2006-01-02T15:04:05Z07:00", value)
+	}
+	return expiresAt, nil
+}
+
+// frontmatter is the YAML frontmatter starting a content, between two "---"
+// lines: its expires_at date (nil when there is none), and the bytes and the
+// lines it spans, up to its closing line included
+type frontmatter struct {
+	expiresAt *time.Time
+	length    int
+	lines     int
+}
+
+// readFrontmatter reads the YAML frontmatter starting a content. A content
+// without frontmatter, or starting with a block which isn't YAML fields, has
+// a zero frontmatter. An invalid date is logged and ignored.
+func readFrontmatter(content io.Reader, source string) frontmatter {
+	reader := bufio.NewReader(content)
+	line, _ := reader.ReadString('\n')
+	if strings.TrimRight(line, " \r\n") != "---" {
+		return frontmatter{}
+	}
+	found := frontmatter{length: len(line), lines: 1}
+	var text strings.Builder
+	closed := false
+	for range maxFrontmatterLines {
+		line, err := reader.ReadString('\n')
+		found.length += len(line)
+		found.lines++
+		if end := strings.TrimRight(line, " \r\n"); end == "---" || end == "..." {
+			closed = true
+			break
+		}
+		if err != nil {
+			break
+		}
+		text.WriteString(line)
+	}
+	if !closed {
+		// The frontmatter is not closed: the content only starts with a rule
+		return frontmatter{}
+	}
+
+	var fields struct {
+		ExpiresAt string `yaml:"expires_at"`
+	}
+	if err := yaml.Unmarshal([]byte(text.String()), &fields); err != nil {
+		return frontmatter{}
+	}
+	if fields.ExpiresAt == "" {
+		return found
+	}
+	expiresAt, err := parseExpiry(fields.ExpiresAt)
+	if err != nil {
+		slog.Warn("🔶 Ignoring the expires_at of the frontmatter", "source", source, "error", err)
+		return found
+	}
+	found.expiresAt = &expiresAt
+	return found
+}
+
+// isExpiredFile tells whether the frontmatter of a content file has an
+// expiration date which is past, so its chunks are not indexed
+func isExpiredFile(path string, now time.Time) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+	expiresAt := readFrontmatter(file, path).expiresAt
+	return expiresAt != nil && !now.Before(*expiresAt), nil
+}
+
+// startExpirySweep removes the expired records from the store every interval,
+// then persists it to storeFilePath. It returns when ctx is done.
+func startExpirySweep(ctx context.Context, s *server.MCPServer, storeFilePath string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			sweepExpiredRecords(s, storeFilePath)
+		}
+	}
+}
+
+// sweepExpiredRecords removes the expired records from the store and from
+// the snippet resources, and the cached search results, and persists the
+// store when it changed
+func sweepExpiredRecords(s *server.MCPServer, storeFilePath string) {
+	if !isStoreReady() {
+		return
+	}
+	now := time.Now()
+	expired, removed := 0, 0
+	for _, record := range store.Records() {
+		if !isExpired(record, now) {
+			continue
+		}
+		expired++
+		if err := store.Delete(record.Id); err != nil {
+			slog.Error("😡 Error removing the expired record", "id", record.Id, "source", record.Source, "error", err)
+			continue
+		}
+		removed++
+	}
+	if expired > 0 {
+		// The cached results may hold the expired records, even the ones
+		// which couldn't be removed
+		searchResults.Clear()
+	}
+	if removed == 0 {
+		return
+	}
+	slog.Info("⌛ Expired records removed", "removed", removed, "records", store.Count())
+	flushStore(storeFilePath)
+	registerSnippetResources(s)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// frontmatterDocument is a content file starting with a frontmatter
+const frontmatterDocument = "---\nexpires_at: 2099-06-30\ntags: [go]\n---\n" +
+	"# Go\nfmt.Println(\"hello\")\n\n----------\n\n# Rust\nprintln!(\"hello\");\n"
+
+func TestChunkingSkipsFrontmatter(t *testing.T) {
+	strategies := map[string]map[string]string{
+		"delimiter":     {"CHUNK_STRATEGY": "delimiter"},
+		"autodelimiter": {"CHUNK_STRATEGY": "autodelimiter"},
+		"recursive":     {"CHUNK_STRATEGY": "recursive", "CHUNK_SIZE": "30"},
+	}
+	for name, env := range strategies {
+		t.Run(name, func(t *testing.T) {
+			setupServer(t, nil, env)
+			path := filepath.Join(config.ContentDirs[0], "go.md")
+			if err := os.WriteFile(path, []byte(frontmatterDocument), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			chunks := chunkContent(frontmatterDocument, path, config.Delimiter)
+			streamed := []SnippetRecord{}
+			if err := streamContentChunks(path, config.Delimiter, func(record SnippetRecord) { streamed = append(streamed, record) }); err != nil {
+				t.Fatalf("streamContentChunks failed: %v", err)
+			}
+			if len(chunks) < 2 || len(streamed) != len(chunks) {
+				t.Fatalf("%d chunks and %d streamed chunks, want the same number, at least 2", len(chunks), len(streamed))
+			}
+			if chunks[0].StartLine != 5 {
+				t.Errorf("the first chunk starts at line %d, want 5", chunks[0].StartLine)
+			}
+			for idx, chunk := range chunks {
+				if strings.Contains(chunk.Prompt, "expires_at") {
+					t.Errorf("the frontmatter was chunked: %q", chunk.Prompt)
+				}
+				if chunk.Prompt != frontmatterDocument[chunk.StartOffset:chunk.EndOffset] {
+					t.Errorf("the chunk at %d doesn't match its offsets: %q", chunk.StartOffset, chunk.Prompt)
+				}
+				if chunk.ExpiresAt == nil || chunk.ExpiresAt.Year() != 2099 {
+					t.Errorf("the chunk %d expires at %v, want 2099-06-30", idx, chunk.ExpiresAt)
+				}
+				other := streamed[idx]
+				if other.Prompt != chunk.Prompt || other.StartOffset != chunk.StartOffset || other.StartLine != chunk.StartLine {
+					t.Errorf("the streamed chunk %d is %q at %d (line %d), want %q at %d (line %d)", idx,
+						other.Prompt, other.StartOffset, other.StartLine, chunk.Prompt, chunk.StartOffset, chunk.StartLine)
+				}
+			}
+		})
+	}
+}
+
+func TestReindexSkipsExpiredFiles(t *testing.T) {
+	snippetStore := setupServer(t, func(ctx context.Context, content string) ([]float64, error) {
+		return []float64{1, 0}, nil
+	}, nil)
+	contentDir := config.ContentDirs[0]
+	files := map[string]string{
+		"current.md": "# Current API\n",
+		"beta.md":    "---\nexpires_at: 2020-01-01\n---\n# Beta API\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(contentDir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := server.NewMCPServer("test", "1.0.0")
+	storeFilePath := filepath.Join(t.TempDir(), "store.json")
+
+	for round, want := range []reindexSummary{{Added: 1, Expired: 1}, {Unchanged: 1, Expired: 1}} {
+		summary, err := reindexContent(context.Background(), s, storeFilePath, config.Delimiter, nil)
+		if err != nil {
+			t.Fatalf("reindex %d failed: %v", round, err)
+		}
+		if summary != want {
+			t.Errorf("reindex %d: summary = %+v, want %+v", round, summary, want)
+		}
+		for _, record := range snippetStore.Records() {
+			if record.Source != filepath.Join(contentDir, "current.md") {
+				t.Errorf("reindex %d indexed %s", round, record.Source)
+			}
+		}
+	}
+}
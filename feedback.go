@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// feedbackEntry is a line of the feedback log: whether a snippet returned
+// for a query was helpful, with the context of the snippet
+type feedbackEntry struct {
+	Time      time.Time `json:"time"`
+	Query     string    `json:"query"`
+	SnippetID string    `json:"snippet_id"`
+	Helpful   bool      `json:"helpful"`
+	Score     *float64  `json:"score,omitempty"`
+	Source    string    `json:"source,omitempty"`
+	Title     string    `json:"title,omitempty"`
+}
+
+// feedbackLog appends the feedback on the search results to a JSONL file.
+// The feedback is only recorded, it doesn't change the search results.
+type feedbackLog struct {
+	mutex sync.Mutex
+	path  string
+}
+
+// newFeedbackLog creates the log of the feedback appended to path,
+// or nil when path is empty
+func newFeedbackLog(path string) *feedbackLog {
+	if path == "" {
+		return nil
+	}
+	return &feedbackLog{path: path}
+}
+
+// Record appends a feedback entry to the log
+func (l *feedbackLog) Record(entry feedbackEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	file, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.Write(append(line, '\n'))
+	return err
+}
+
+// rateResultHandler records whether a snippet returned for a query was helpful
+func rateResultHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	query, err := request.RequireString("query")
+	if err != nil {
+		return nil, fmt.Errorf("missing required parameter 'query'")
+	}
+	snippetID, err := request.RequireString("snippet_id")
+	if err != nil {
+		return nil, fmt.Errorf("missing required parameter 'snippet_id'")
+	}
+	helpful, err := request.RequireBool("helpful")
+	if err != nil {
+		return nil, fmt.Errorf("missing required parameter 'helpful'")
+	}
+
+	entry := feedbackEntry{Time: time.Now().UTC(), Query: query, SnippetID: snippetID, Helpful: helpful}
+	if _, ok := request.GetArguments()["score"]; ok {
+		score := request.GetFloat("score", 0)
+		if score < 0 || score > 1 {
+			return nil, fmt.Errorf("parameter 'score' must be between 0 and 1")
+		}
+		entry.Score = &score
+	}
+	record, ok := store.Get(snippetID)
+	if !ok {
+		return nil, fmt.Errorf("snippet %q not found", snippetID)
+	}
+	entry.Source = record.Source
+	entry.Title = recordTitle(record)
+
+	if err := feedback.Record(entry); err != nil {
+		slog.Error("😡 Error writing the feedback log", "path", feedback.path, "error", err)
+		return nil, fmt.Errorf("failed to record the feedback: %w", err)
+	}
+	slog.Info("📝 Feedback recorded", "query", query, "snippet_id", snippetID, "helpful", helpful)
+	return mcp.NewToolResultText(fmt.Sprintf("Feedback recorded for the snippet %s", snippetID)), nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import "strings"
+
+// fenceState tells whether a position of a text is inside a fenced code
+// block, and the fence which opened it
+type fenceState struct {
+	open   bool
+	marker byte
+	length int
+}
+
+// fenceRegion is a fenced code block, from the start of its opening line
+// to the end of its closing line
+type fenceRegion struct {
+	start int
+	end   int
+}
+
+// scanFences returns the fenced code blocks of text, whose start is in the
+// given fence state, and the fence state at its end
+func scanFences(text string, state fenceState) ([]fenceRegion, fenceState) {
+	regions := []fenceRegion{}
+	regionStart := 0
+	for lineStart := 0; lineStart < len(text); {
+		lineEnd := len(text)
+		if idx := strings.IndexByte(text[lineStart:], '\n'); idx >= 0 {
+			lineEnd = lineStart + idx + 1
+		}
+		marker, length, info := fenceMarker(text[lineStart:lineEnd])
+		switch {
+		case !state.open && length > 0:
+			state = fenceState{open: true, marker: marker, length: length}
+			regionStart = lineStart
+		case state.open && marker == state.marker && length >= state.length && info == "":
+			regions = append(regions, fenceRegion{start: regionStart, end: lineEnd})
+			state = fenceState{}
+		}
+		lineStart = lineEnd
+	}
+	if state.open {
+		regions = append(regions, fenceRegion{start: regionStart, end: len(text)})
+	}
+	return regions, state
+}
+
+// fenceMarker returns the character, the length and the info string (e.g.
+// the language) of the fence of a line starting with ``` or ~~~, or a length of 0
+func fenceMarker(line string) (byte, int, string) {
+	line = strings.TrimLeft(line, " \t")
+	if !strings.HasPrefix(line, "```") && !strings.HasPrefix(line, "~~~") {
+		return 0, 0, ""
+	}
+	length := 0
+	for length < len(line) && line[length] == line[0] {
+		length++
+	}
+	return line[0], length, strings.TrimSpace(line[length:])
+}
+
+// insideFence tells whether the byte offset i is strictly inside a fenced region
+func insideFence(regions []fenceRegion, i int) bool {
+	for _, region := range regions {
+		if region.start < i && i < region.end {
+			return true
+		}
+	}
+	return false
+}
+
+// isFenceEdge tells whether the byte offset i starts or ends a fenced region
+func isFenceEdge(regions []fenceRegion, i int) bool {
+	for _, region := range regions {
+		if region.start == i || region.end == i {
+			return true
+		}
+	}
+	return false
+}
+
+// fenceTracker follows the fence state of a text written piece by piece,
+// as scanFences does for the whole text
+type fenceTracker struct {
+	state fenceState
+	// line is the end of the text, after its last newline
+	line string
+}
+
+// write appends text to the tracked text
+func (t *fenceTracker) write(text string) {
+	text = t.line + text
+	last := strings.LastIndexByte(text, '\n')
+	_, t.state = scanFences(text[:last+1], t.state)
+	t.line = text[last+1:]
+}
+
+// open tells whether the end of the tracked text is inside a fenced code block
+func (t *fenceTracker) open() bool {
+	_, state := scanFences(t.line, t.state)
+	return state.open
+}
+
+// glueFencedPieces joins the consecutive pieces of a span (which doesn't
+// start inside a fenced code block) split inside a fenced code block,
+// so each fenced code block stays whole
+func glueFencedPieces(span textSpan, pieces []textSpan) []textSpan {
+	regions, _ := scanFences(span.text, fenceState{})
+	if len(regions) == 0 {
+		return pieces
+	}
+	glued := make([]textSpan, 0, len(pieces))
+	for _, piece := range pieces {
+		if last := len(glued) - 1; last >= 0 && insideFence(regions, piece.start-span.start) {
+			glued[last].text = span.text[glued[last].start-span.start : piece.end()-span.start]
+			continue
+		}
+		glued = append(glued, piece)
+	}
+	return glued
+}
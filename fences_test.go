@@ -0,0 +1,147 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestScanFences(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		// fenced are the fenced code blocks, as texts
+		fenced []string
+		open   bool
+	}{
+		{
+			name: "no fence",
+			text: "# Title\nsome text\n",
+		},
+		{
+			name:   "go fence",
+			text:   "before\n```go\nfmt.Println()\n```\nafter\n",
+			fenced: []string{"```go\nfmt.Println()\n```\n"},
+		},
+		{
+			name:   "tilde fence",
+			text:   "~~~python\nprint()\n~~~\n",
+			fenced: []string{"~~~python\nprint()\n~~~\n"},
+		},
+		{
+			name:   "shorter fence nested in a longer one",
+			text:   "````markdown\n```go\nfmt.Println()\n```\n````\nafter\n",
+			fenced: []string{"````markdown\n```go\nfmt.Println()\n```\n````\n"},
+		},
+		{
+			name:   "backticks nested in tildes",
+			text:   "~~~\n```\n~~~\n",
+			fenced: []string{"~~~\n```\n~~~\n"},
+		},
+		{
+			name:   "fence with an info string doesn't close",
+			text:   "```\ncode\n```go\nmore code\n```\n",
+			fenced: []string{"```\ncode\n```go\nmore code\n```\n"},
+		},
+		{
+			name:   "indented fences",
+			text:   "- item\n  ```sh\n  ls\n  ```\n",
+			fenced: []string{"  ```sh\n  ls\n  ```\n"},
+		},
+		{
+			name:   "consecutive fences",
+			text:   "```go\na\n```\n```rust\nb\n```",
+			fenced: []string{"```go\na\n```\n", "```rust\nb\n```"},
+		},
+		{
+			name:   "unterminated fence",
+			text:   "text\n```go\nfunc main() {\n",
+			fenced: []string{"```go\nfunc main() {\n"},
+			open:   true,
+		},
+		{
+			name:   "unterminated longer fence closed by a shorter one",
+			text:   "````\ncode\n```\n",
+			fenced: []string{"````\ncode\n```\n"},
+			open:   true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			regions, state := scanFences(test.text, fenceState{})
+			fenced := []string{}
+			for _, region := range regions {
+				fenced = append(fenced, test.text[region.start:region.end])
+			}
+			if strings.Join(fenced, "|") != strings.Join(test.fenced, "|") {
+				t.Errorf("scanFences() fenced %q, want %q", fenced, test.fenced)
+			}
+			if state.open != test.open {
+				t.Errorf("scanFences() ends open = %t, want %t", state.open, test.open)
+			}
+
+			// Tracking the text line by line ends in the same state
+			tracker := fenceTracker{}
+			for _, line := range strings.SplitAfter(test.text, "\n") {
+				tracker.write(line)
+			}
+			if tracker.open() != test.open {
+				t.Errorf("fenceTracker ends open = %t, want %t", tracker.open(), test.open)
+			}
+		})
+	}
+}
+
+// fencedDocument holds fences which look nested, with delimiters and blank
+// lines inside them, followed by an unterminated fence
+const fencedDocument = "# Nested fences\n\nThe inner fence of a markdown example is not closing it.\n\n" +
+	"````markdown\nExample:\n\n```go\nfmt.Println(\"inner\")\n```\n\n----------\n\nThe example goes on.\n````\n\n" +
+	"----------\n\n" +
+	"~~~python\nprint(\"tilde\")\n\n```\nnot a closing fence\n```\n~~~\n\n" +
+	"Some text between the fences. It has sentences.\n\n" +
+	"```rust\nfn main() {\n\n    println!(\"unterminated\");\n\n----------\n}\n"
+
+// fencedBlocks are the fenced code blocks of fencedDocument
+var fencedBlocks = []string{
+	"````markdown\nExample:\n\n```go\nfmt.Println(\"inner\")\n```\n\n----------\n\nThe example goes on.\n````\n",
+	"~~~python\nprint(\"tilde\")\n\n```\nnot a closing fence\n```\n~~~\n",
+	"```rust\nfn main() {\n\n    println!(\"unterminated\");\n\n----------\n}\n",
+}
+
+func TestChunkingKeepsFencesWhole(t *testing.T) {
+	strategies := []struct {
+		name string
+		env  map[string]string
+	}{
+		{"delimiter", map[string]string{"CHUNK_STRATEGY": "delimiter"}},
+		{"autodelimiter", map[string]string{"CHUNK_STRATEGY": "autodelimiter"}},
+		{"recursive", map[string]string{"CHUNK_STRATEGY": "recursive", "CHUNK_SIZE": "40", "CHUNK_OVERLAP": "10"}},
+		{"recursive without overlap", map[string]string{"CHUNK_STRATEGY": "recursive", "CHUNK_SIZE": "20"}},
+		{"snapped to sentences", map[string]string{"CHUNK_STRATEGY": "recursive", "CHUNK_SIZE": "60", "SENTENCE_SNAP_CHARS": "40"}},
+	}
+	for _, strategy := range strategies {
+		t.Run(strategy.name, func(t *testing.T) {
+			setupServer(t, nil, strategy.env)
+			chunks := []textSpan{}
+			for _, record := range chunkContent(fencedDocument, "snippets/fences.md", config.Delimiter) {
+				chunks = append(chunks, textSpan{text: record.Prompt, start: record.StartOffset, line: record.StartLine})
+			}
+			if len(chunks) < 2 {
+				t.Fatalf("the document was not split: %q", chunks)
+			}
+			for _, block := range fencedBlocks {
+				whole := false
+				for _, chunk := range chunks {
+					if strings.Contains(chunk.text, block) {
+						whole = true
+					}
+					if chunk.text != fencedDocument[chunk.start:chunk.end()] {
+						t.Fatalf("the chunk at %d doesn't match its offsets: %q", chunk.start, chunk.text)
+					}
+				}
+				if !whole {
+					t.Errorf("the fenced block %q was split: %q", block, chunks)
+				}
+			}
+		})
+	}
+}
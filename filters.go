@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// RecordFilter tells whether a record is a candidate of a search
+type RecordFilter func(record SnippetRecord) bool
+
+// matchesFilters tells whether a record is a candidate of a search:
+// it is not disabled, it has not expired at now (the time the search
+// started) and it passes all the filters
+func matchesFilters(record SnippetRecord, now time.Time, filters []RecordFilter) bool {
+	if record.Disabled || isExpired(record, now) {
+		return false
+	}
+	for _, filter := range filters {
+		if !filter(record) {
+			return false
+		}
+	}
+	return true
+}
+
+// sourceFilter returns a filter keeping the records whose source matches a
+// glob. A glob containing a slash is matched against the whole source path,
+// or against the path relative to one of the content directories, **
+// matching any number of directories; otherwise it is matched against the
+// file name.
+func sourceFilter(glob string, contentDirs []string) (RecordFilter, error) {
+	glob = filepath.ToSlash(glob)
+	if _, err := path.Match(glob, ""); err != nil {
+		return nil, fmt.Errorf("invalid source glob %q: %w", glob, err)
+	}
+	patterns := strings.Split(glob, "/")
+	return func(record SnippetRecord) bool {
+		source := filepath.ToSlash(record.Source)
+		if !strings.Contains(glob, "/") {
+			matched, _ := path.Match(glob, path.Base(source))
+			return matched
+		}
+		if matchSegments(patterns, strings.Split(source, "/")) {
+			return true
+		}
+		for _, contentDir := range contentDirs {
+			relative, err := filepath.Rel(contentDir, record.Source)
+			if err != nil || strings.HasPrefix(relative, "..") {
+				continue
+			}
+			if matchSegments(patterns, strings.Split(filepath.ToSlash(relative), "/")) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// excludeSourcesFilter returns a filter dropping the records whose source
+// matches any of the globs, matched like the globs of sourceFilter
+func excludeSourcesFilter(globs []string, contentDirs []string) (RecordFilter, error) {
+	excluded := make([]RecordFilter, 0, len(globs))
+	for _, glob := range globs {
+		filter, err := sourceFilter(glob, contentDirs)
+		if err != nil {
+			return nil, err
+		}
+		excluded = append(excluded, filter)
+	}
+	return func(record SnippetRecord) bool {
+		for _, filter := range excluded {
+			if filter(record) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+// lengthFilter returns a filter keeping the records whose text has between
+// minLength and maxLength characters, a bound of 0 being no bound
+func lengthFilter(minLength int, maxLength int) RecordFilter {
+	return func(record SnippetRecord) bool {
+		length := utf8.RuneCountInString(record.Prompt)
+		return length >= minLength && (maxLength == 0 || length <= maxLength)
+	}
+}
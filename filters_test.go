@@ -0,0 +1,47 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSourceFilterMatchesRelativeToContentDirs(t *testing.T) {
+	contentDir := t.TempDir()
+	filter, err := sourceFilter("guides/*.md", []string{contentDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sources := map[string]bool{
+		filepath.Join(contentDir, "guides", "intro.md"):        true,
+		filepath.Join(contentDir, "api", "guides", "intro.md"): false,
+		filepath.Join(t.TempDir(), "guides", "intro.md"):       false,
+		"guides/intro.md": true,
+	}
+	for source, want := range sources {
+		if matched := filter(testRecord("id", source, "chunk")); matched != want {
+			t.Errorf("sourceFilter(%q) matched %s: %t, want %t", "guides/*.md", source, matched, want)
+		}
+	}
+}
+
+func TestSourceBoostsMatchTheConfiguredContentDirs(t *testing.T) {
+	// The boosts are parsed while the configuration of the content directories is loaded
+	setupServer(t, nil, map[string]string{"SOURCE_BOOSTS": "official/**=2"})
+	record := testRecord("official", filepath.Join(config.ContentDirs[0], "official", "go.md"), "chunk")
+	if boost := sourceBoostOf(config.SourceBoosts, record); boost != 2 {
+		t.Errorf("the boost of %s is %g, want 2", record.Source, boost)
+	}
+}
+
+func TestMatchesFiltersAtTheSearchTime(t *testing.T) {
+	expiresAt := time.Date(2025, 6, 30, 0, 0, 0, 0, time.UTC)
+	record := testRecord("beta", "snippets/beta.md", "chunk")
+	record.ExpiresAt = &expiresAt
+	if !matchesFilters(record, expiresAt.Add(-time.Second), nil) {
+		t.Error("the record was skipped before its expiration")
+	}
+	if matchesFilters(record, expiresAt, nil) {
+		t.Error("the record was kept at its expiration")
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+)
+
+// defaultResultTemplate is the default RESULT_TEMPLATE
+const defaultResultTemplate = "Documents:\n{{.Results}}"
+
+// resultsPlaceholder stands for the results when RESULT_TEMPLATE is rendered,
+// to split it into the texts before and after them
+const resultsPlaceholder = "\x00results\x00"
+
+// resultTemplateParts renders a RESULT_TEMPLATE, a Go text/template where
+// {{.Results}} stands for the snippets, and returns the texts before and
+// after the snippets. It fails when the template is invalid or has no
+// {{.Results}}.
+func resultTemplateParts(text string) (string, string, error) {
+	resultTemplate, err := template.New("result").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", "", err
+	}
+	var rendered strings.Builder
+	if err := resultTemplate.Execute(&rendered, struct{ Results string }{resultsPlaceholder}); err != nil {
+		return "", "", err
+	}
+	before, after, found := strings.Cut(rendered.String(), resultsPlaceholder)
+	if !found {
+		return "", "", fmt.Errorf("the template has no {{.Results}} placeholder")
+	}
+	return before, after, nil
+}
+
+// resultPreamble returns the texts before and after the snippets of the
+// search responses, from RESULT_TEMPLATE (validated at startup)
+func resultPreamble() (string, string) {
+	before, after, err := resultTemplateParts(config.ResultTemplate)
+	if err != nil {
+		before, after, _ = resultTemplateParts(defaultResultTemplate)
+	}
+	return before, after
+}
+
+// formatDocuments concatenates the found snippets, formatted by formatSnippets,
+// into the tool response, framed by RESULT_TEMPLATE. When the response would
+// exceed MAX_RESULT_CHARS an omission note follows the snippets.
+func formatDocuments(topic string, similarities []SnippetRecord, byKeywords bool) string {
+	snippets, omitted := formatSnippets(topic, similarities, byKeywords)
+	before, after := resultPreamble()
+	documentsContent := before + strings.Join(snippets, "") + "\n"
+	if omitted > 0 {
+		documentsContent += omittedSnippetsNote(omitted)
+	}
+	return documentsContent + after
+}
+
+// formatSnippets formats the found snippets, each preceded by its title,
+// its location in its source, its tags and its similarity rounded to SCORE_PRECISION
+// decimals. With HIGHLIGHT_TERMS, the significant terms of the
+// topic are highlighted in the text of the snippets, not in their headers,
+// before the response size is checked. The snippets added by MIN_RESULTS
+// are annotated as below the similarity threshold. The snippets found
+// byKeywords have neither similarity nor annotation.
+// Snippets longer than MAX_CHUNK_CHARS are truncated, and when the response
+// would exceed MAX_RESULT_CHARS the lowest scored snippets are dropped first:
+// the formatted snippets are the ones of the first similarities, followed
+// by the number of omitted snippets.
+// The similarities are expected to be sorted from the best to the worst.
+func formatSnippets(topic string, similarities []SnippetRecord, byKeywords bool) ([]string, int) {
+	maxChunkChars := config.MaxChunkChars
+	maxResultChars := config.MaxResultChars
+
+	var highlight func(text string) string
+	if config.HighlightTerms {
+		highlight = termsHighlighter(topic)
+	}
+	prompts := make([]string, 0, len(similarities))
+	for _, similarity := range similarities {
+		slog.Debug("✅ Similarity found", "score", roundScore(similarity.CosineSimilarity), "chunk", similarity.Prompt)
+		header := "\nTitle: " + recordTitle(similarity) + "\n"
+		if location := recordLocation(similarity); location != "" {
+			header += "Location: " + location + "\n"
+		}
+		if len(similarity.Tags) > 0 {
+			header += "Tags: " + strings.Join(similarity.Tags, ", ") + "\n"
+		}
+		if !byKeywords {
+			header += "Similarity: " + formatScore(similarity.CosineSimilarity) + "\n"
+		}
+		if feedback != nil {
+			// The ID lets the client rate the snippet
+			header += "ID: " + similarity.Id + "\n"
+		}
+		if !byKeywords && isBelowThreshold(similarity) {
+			header += fmt.Sprintf("Below threshold: under the similarity threshold of %g, this snippet may be irrelevant\n", config.Limit)
+		}
+		text := truncateText(strings.TrimLeft(similarity.Prompt, "\n"), maxChunkChars)
+		if highlight != nil {
+			text = highlight(text)
+		}
+		prompts = append(prompts, header+text)
+	}
+
+	omitted := 0
+	if maxResultChars > 0 {
+		for len(prompts) > 1 && totalChars(prompts) > maxResultChars {
+			prompts = prompts[:len(prompts)-1]
+			omitted++
+		}
+		if len(prompts) == 1 {
+			prompts[0] = truncateText(prompts[0], maxResultChars)
+		}
+	}
+	if omitted > 0 {
+		slog.Info("✂️ Results omitted to fit MAX_RESULT_CHARS", "omitted", omitted, "max_result_chars", maxResultChars)
+	}
+	return prompts, omitted
+}
+
+// omittedSnippetsNote explains that snippets were dropped to fit MAX_RESULT_CHARS
+func omittedSnippetsNote(omitted int) string {
+	return fmt.Sprintf("… (%d lower scored snippets omitted to fit the response size limit)\n", omitted)
+}
+
+// searchMetadata returns the header of the search responses, naming the
+// embedding model which embedded the topic (the configured model when model
+// is empty) and the dimension of its vectors, the one of the stored vectors
+func searchMetadata(model string) string {
+	return fmt.Sprintf("Embedding model: %s\nEmbedding dimension: %d\n\n", embedderFor(model).model, store.Dimension())
+}
+
+// roundScore rounds a similarity score to SCORE_PRECISION decimals,
+// for the responses, the logs and the logged JSON
+func roundScore(score float64) float64 {
+	scale := math.Pow10(config.ScorePrecision)
+	return math.Round(score*scale) / scale
+}
+
+// formatScore formats a similarity score with SCORE_PRECISION decimals
+func formatScore(score float64) string {
+	return strconv.FormatFloat(score, 'f', config.ScorePrecision, 64)
+}
+
+// keywordFallbackNote returns the header of the search responses found by
+// keywords, because the topic couldn't be embedded
+func keywordFallbackNote(embeddingErr error) string {
+	return fmt.Sprintf("Semantic search unavailable (%v), the snippets were searched by keywords instead and may be less relevant.\n\n", embeddingErr)
+}
+
+// noSnippetsFoundMessage explains that no snippet is similar enough to the topic
+func noSnippetsFoundMessage(threshold float64) string {
+	message := fmt.Sprintf("No snippets found matching the topic above the similarity threshold of %g.", threshold)
+	if threshold > 0 {
+		message += " Try rephrasing the topic, or lower the threshold (LIMIT) of the server."
+	}
+	return message + "\n"
+}
+
+// truncateText cuts text after maxChars characters and appends an ellipsis
+// note; a maxChars of 0 (or less) means no limit
+func truncateText(text string, maxChars int) string {
+	if maxChars <= 0 || utf8.RuneCountInString(text) <= maxChars {
+		return text
+	}
+	runes := []rune(text)
+	return string(runes[:maxChars]) + "\n… (snippet truncated)\n"
+}
+
+// totalChars returns the number of characters of all the texts
+func totalChars(texts []string) int {
+	total := 0
+	for _, text := range texts {
+		total += utf8.RuneCountInString(text)
+	}
+	return total
+}
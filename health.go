@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+)
+
+// Readiness states of the vector store
+const (
+	stateInitializing = "initializing"
+	stateReady        = "ready"
+	stateFailed       = "failed"
+)
+
+var storeState atomic.Value
+
+func init() {
+	storeState.Store(stateInitializing)
+}
+
+// setStoreState updates the readiness state reported by /readyz and /health
+func setStoreState(state string) {
+	storeState.Store(state)
+}
+
+// isStoreReady reports whether the store is loaded and can serve searches
+func isStoreReady() bool {
+	return storeState.Load().(string) == stateReady
+}
+
+// livenessHandler reports that the process is up, whatever the store state
+func livenessHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]any{
+		"status": "alive",
+	})
+}
+
+// healthCheckHandler is the readiness check: it returns 503 until the
+// vector store is loaded (or indexed) and contains records. A store with
+// chunks which couldn't be indexed stays ready, but is reported as incomplete.
+func healthCheckHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	state := storeState.Load().(string)
+	if state != stateReady {
+		slog.Debug("🩺 Readiness check: store not ready", "state", state)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		response := map[string]any{
+			"status": state,
+			"reason": "vector store not ready",
+		}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	// Check if vector store is initialized and has records
+	records := store.Count()
+	if records == 0 {
+		slog.Warn("🩺 Readiness check: vector store is empty")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		response := map[string]any{
+			"status": "unhealthy",
+			"reason": "vector store not initialized",
+		}
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	failures := store.Failures()
+	w.WriteHeader(http.StatusOK)
+	response := map[string]any{
+		"status":           "healthy",
+		"records":          records,
+		"embeddings_model": config.EmbeddingModel,
+		"index_complete":   failures.complete(),
+		"failed_chunks":    failures.Count,
+	}
+	json.NewEncoder(w).Encode(response)
+}
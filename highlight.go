@@ -0,0 +1,154 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// stopwords are the common English words never highlighted
+var stopwords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true, "be": true, "by": true,
+	"can": true, "do": true, "does": true, "for": true, "from": true, "how": true, "i": true,
+	"in": true, "is": true, "it": true, "me": true, "my": true, "of": true, "on": true, "or": true,
+	"show": true, "that": true, "the": true, "this": true, "to": true, "use": true, "what": true,
+	"when": true, "where": true, "which": true, "who": true, "why": true, "with": true, "you": true,
+}
+
+// queryTerms returns the significant terms of a query: its words (lowercased
+// and without their accents), without the stopwords and the single characters
+func queryTerms(query string) []string {
+	seen := map[string]bool{}
+	terms := []string{}
+	for _, word := range textWords(query) {
+		if len([]rune(word)) < 2 || stopwords[word] || seen[word] {
+			continue
+		}
+		seen[word] = true
+		terms = append(terms, word)
+	}
+	return terms
+}
+
+// accentedLetters are the lowercase accented letters of the Latin scripts by
+// the letters they are folded to
+var accentedLetters = map[string]string{
+	"a": "àáâãäåāăą", "c": "çćĉċč", "d": "ďđð", "e": "èéêëēĕėęě", "g": "ĝğġģ", "h": "ĥħ",
+	"i": "ìíîïĩīĭįı", "j": "ĵ", "k": "ķ", "l": "ĺļľŀł", "n": "ñńņňŉ", "o": "òóôõöøōŏő",
+	"r": "ŕŗř", "s": "śŝşšș", "t": "ţťŧț", "u": "ùúûüũūŭůűų", "w": "ŵ", "y": "ýÿŷ", "z": "źżž",
+	"ae": "æ", "oe": "œ", "ss": "ß", "th": "þ",
+}
+
+// foldedLetters maps each accented letter to the letters it is folded to
+var foldedLetters = func() map[rune]string {
+	folded := map[rune]string{}
+	for letters, accented := range accentedLetters {
+		for _, letter := range accented {
+			folded[letter] = letters
+		}
+	}
+	return folded
+}()
+
+// textWords returns the words of a text, split at the characters which are
+// neither letters nor digits, lowercased and without their accents, so
+// "JSON" matches "json" and "café" matches "cafe"
+func textWords(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !isWordRune(r)
+	})
+	for idx, word := range words {
+		words[idx] = foldAccents(word)
+	}
+	return words
+}
+
+// isWordRune reports whether a character belongs to a word: a letter, a
+// digit, or a combining mark like the accent of a decomposed letter
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r)
+}
+
+// foldAccents removes the accents of a lowercase word: the accented letters
+// are replaced by their letters, and the combining marks are dropped
+func foldAccents(word string) string {
+	var folded strings.Builder
+	for _, r := range word {
+		if letters, ok := foldedLetters[r]; ok {
+			folded.WriteString(letters)
+		} else if !unicode.Is(unicode.Mn, r) {
+			folded.WriteRune(r)
+		}
+	}
+	return folded.String()
+}
+
+// termsHighlighter returns a function wrapping the occurrences of the
+// significant terms of a query in **, case and accent-insensitively, or nil
+// when the query has no significant term
+func termsHighlighter(query string) func(text string) string {
+	terms := queryTerms(query)
+	if len(terms) == 0 {
+		return nil
+	}
+	// The longest terms first, so a term is preferred to its prefixes
+	sort.Slice(terms, func(i, j int) bool { return len(terms[i]) > len(terms[j]) })
+	for idx, term := range terms {
+		terms[idx] = accentedPattern(term)
+	}
+	pattern := regexp.MustCompile(`(?i)` + strings.Join(terms, "|"))
+	return func(text string) string {
+		var highlighted strings.Builder
+		last := 0
+		for _, match := range pattern.FindAllStringIndex(text, -1) {
+			// Only the whole words, \b not knowing the non-ASCII letters
+			if !isWordBoundary(text, match[0]) || !isWordBoundary(text, match[1]) {
+				continue
+			}
+			highlighted.WriteString(text[last:match[0]])
+			highlighted.WriteString("**" + text[match[0]:match[1]] + "**")
+			last = match[1]
+		}
+		highlighted.WriteString(text[last:])
+		return highlighted.String()
+	}
+}
+
+// accentedPattern returns a regular expression matching a folded term with or
+// without the accents of its letters, precomposed or combining. The letters
+// a ligature is folded to also match the ligature, e.g. "ss" matches "ß".
+func accentedPattern(term string) string {
+	letters := []rune(term)
+	var pattern strings.Builder
+	for idx := 0; idx < len(letters); idx++ {
+		if idx+1 < len(letters) {
+			if ligature, ok := accentedLetters[string(letters[idx:idx+2])]; ok {
+				pattern.WriteString("(?:" + accentedLetter(letters[idx]) + accentedLetter(letters[idx+1]) +
+					"|[" + ligature + `]\p{Mn}*)`)
+				idx++
+				continue
+			}
+		}
+		pattern.WriteString(accentedLetter(letters[idx]))
+	}
+	return pattern.String()
+}
+
+// accentedLetter returns a regular expression matching a folded letter with
+// or without its accents
+func accentedLetter(r rune) string {
+	letter := regexp.QuoteMeta(string(r))
+	if accented, ok := accentedLetters[string(r)]; ok {
+		letter = "[" + letter + accented + "]"
+	}
+	return letter + `\p{Mn}*`
+}
+
+// isWordBoundary reports whether an offset of a text is not inside a word
+func isWordBoundary(text string, offset int) bool {
+	before, _ := utf8.DecodeLastRuneInString(text[:offset])
+	after, _ := utf8.DecodeRuneInString(text[offset:])
+	return !isWordRune(before) || !isWordRune(after)
+}
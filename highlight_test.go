@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestTextWords(t *testing.T) {
+	tests := []struct {
+		text  string
+		words []string
+	}{
+		{"JSON Café", []string{"json", "cafe"}},
+		{"naïve-approach, v2", []string{"naive", "approach", "v2"}},
+		// A decomposed accent is a combining mark of the word
+		{"cafe\u0301 au lait", []string{"cafe", "au", "lait"}},
+		{"Straße STRASSE", []string{"strasse", "strasse"}},
+		{"Æon Œuvre Þorn", []string{"aeon", "oeuvre", "thorn"}},
+		{"Łódź, İstanbul", []string{"lodz", "istanbul"}},
+		{"", []string{}},
+	}
+	for _, test := range tests {
+		if words := textWords(test.text); !slices.Equal(words, test.words) {
+			t.Errorf("textWords(%q) = %q, want %q", test.text, words, test.words)
+		}
+	}
+}
+
+func TestQueryTerms(t *testing.T) {
+	tests := []struct {
+		query string
+		terms []string
+	}{
+		{"How to use the JSON API?", []string{"json", "api"}},
+		{"Café cafe CAFÉ cafe\u0301", []string{"cafe"}},
+		{"a b c in Go", []string{"go"}},
+		{"Größe", []string{"grosse"}},
+		{"the of to", []string{}},
+	}
+	for _, test := range tests {
+		if terms := queryTerms(test.query); !slices.Equal(terms, test.terms) {
+			t.Errorf("queryTerms(%q) = %q, want %q", test.query, terms, test.terms)
+		}
+	}
+}
+
+func TestTermsHighlighter(t *testing.T) {
+	tests := []struct {
+		name        string
+		query       string
+		text        string
+		highlighted string
+	}{
+		{"case", "json", "JSON, Json and json", "**JSON**, **Json** and **json**"},
+		{"accented text", "cafe", "Un café, un Café", "Un **café**, un **Café**"},
+		{"accented query", "café", "a cafe", "a **cafe**"},
+		{"combining accent", "cafe", "un cafe\u0301 noir", "un **cafe\u0301** noir"},
+		{"whole words only", "json", "jsonify the json, JSONs", "jsonify the **json**, JSONs"},
+		{"non-ASCII word boundary", "cafe", "cafés and éléphant-café", "cafés and éléphant-**café**"},
+		{"longest term first", "go goroutine", "a goroutine in Go", "a **goroutine** in **Go**"},
+		{"sharp s", "strasse", "Straße and STRASSE", "**Straße** and **STRASSE**"},
+		{"sharp s in the query", "Größe", "die Größe, die GROESSE", "die **Größe**, die GROESSE"},
+		{"ligatures", "aeon oeuvre thorn", "Æon, œuvre and Þorn", "**Æon**, **œuvre** and **Þorn**"},
+		{"ligature letters", "æsthetic", "an aesthetic", "an **aesthetic**"},
+		{"stopwords only", "what is the", "what is the", "what is the"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			highlight := termsHighlighter(test.query)
+			highlighted := test.text
+			if highlight != nil {
+				highlighted = highlight(test.text)
+			}
+			if highlighted != test.highlighted {
+				t.Errorf("highlighting %q in %q = %q, want %q", test.query, test.text, highlighted, test.highlighted)
+			}
+		})
+	}
+}
+
+func TestKeywordSearchFoldsCaseAndAccents(t *testing.T) {
+	snippetStore := setupServer(t, nil, nil)
+	snippetStore.Save(testRecord("cafe", "snippets/cafe.md", "Le CAFÉ de la rue", 1, 0))
+	snippetStore.Save(testRecord("strasse", "snippets/strasse.md", "Die Hauptstraße", 1, 0))
+	snippetStore.Save(testRecord("other", "snippets/other.md", "Something else", 1, 0))
+
+	tests := []struct {
+		topic string
+		ids   []string
+	}{
+		{"cafe", []string{"cafe"}},
+		{"Café", []string{"cafe"}},
+		{"hauptstrasse", []string{"strasse"}},
+		{"HAUPTSTRAẞE", []string{"strasse"}},
+		{"nothing", []string{}},
+	}
+	for _, test := range tests {
+		results, err := keywordSearch(context.Background(), test.topic, 5)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ids := resultIDs(results); !slices.Equal(ids, test.ids) {
+			t.Errorf("keywordSearch(%q) = %v, want %v", test.topic, ids, test.ids)
+		}
+	}
+}
+
+func TestFormatSnippetsHighlightsChunkText(t *testing.T) {
+	setupServer(t, nil, map[string]string{"HIGHLIGHT_TERMS": "true", "MAX_RESULT_CHARS": "150"})
+	record := testRecord("json", "snippets/json.md", "Decode the json with json.Unmarshal", 1, 0)
+	record.Title = "Reading json"
+	record.Tags = []string{"json"}
+	record.CosineSimilarity = 0.9
+	second := testRecord("other", "snippets/other.md", "Encode the json", 1, 0)
+	second.CosineSimilarity = 0.8
+
+	prompts, omitted := formatSnippets("json", []SnippetRecord{record, second, second}, false)
+	if !strings.Contains(prompts[0], "Title: Reading json\n") || !strings.Contains(prompts[0], "Tags: json\n") {
+		t.Errorf("the headers were highlighted: %q", prompts[0])
+	}
+	if !strings.Contains(prompts[0], "Decode the **json** with **json**.Unmarshal") {
+		t.Errorf("the text of the snippet was not highlighted: %q", prompts[0])
+	}
+	if total := totalChars(prompts); total > config.MaxResultChars || omitted == 0 {
+		t.Errorf("the highlighted snippets take %d characters with %d omitted, want at most %d", total, omitted, config.MaxResultChars)
+	}
+
+	// A topic without significant terms highlights nothing
+	if prompts, _ := formatSnippets("what is the", []SnippetRecord{second}, false); strings.Contains(prompts[0], "**") {
+		t.Errorf("a topic of stopwords highlighted %q", prompts[0])
+	}
+}
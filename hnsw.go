@@ -0,0 +1,334 @@
+package main
+
+import (
+	"cmp"
+	"container/heap"
+	"math"
+	"math/rand/v2"
+	"slices"
+)
+
+// hnswParams are the settings of the approximate nearest neighbors index
+type hnswParams struct {
+	// M is the number of neighbors of a node on the upper layers,
+	// twice as many on the bottom layer
+	M int
+	// EfConstruction is the number of candidates explored to link a new node
+	EfConstruction int
+	// EfSearch is the number of candidates explored by a search, the
+	// recall/speed knob: higher finds more of the exact neighbors, slower
+	EfSearch int
+}
+
+// hnswNode is a vector of the index, linked to its neighbors on each
+// layer up to its level
+type hnswNode struct {
+	id      string
+	vector  []float64
+	norm    float64
+	friends [][]int
+	deleted bool
+}
+
+// hnswIndex is a Hierarchical Navigable Small World graph of the stored
+// vectors, which finds the most similar vectors to a query by walking the
+// graph from a layer to the next, instead of scoring all of them.
+// The removed vectors stay in the graph to keep it connected, they are
+// only skipped in the results. It is not safe for concurrent use.
+type hnswIndex struct {
+	params    hnswParams
+	nodes     []hnswNode
+	ids       map[string]int
+	entry     int
+	maxLevel  int
+	levelMult float64
+	random    *rand.Rand
+	deleted   int
+}
+
+// hnswResult is a vector found by a search, with its cosine similarity to the query
+type hnswResult struct {
+	id         string
+	similarity float64
+}
+
+// newHNSWIndex creates an empty index
+func newHNSWIndex(params hnswParams) *hnswIndex {
+	return &hnswIndex{
+		params:    params,
+		ids:       map[string]int{},
+		entry:     -1,
+		levelMult: 1 / math.Log(float64(params.M)),
+		// A fixed seed builds the same graph from the same records
+		random: rand.New(rand.NewPCG(1, 2)),
+	}
+}
+
+// len returns the number of vectors of the index, without the removed ones
+func (h *hnswIndex) len() int {
+	return len(h.ids)
+}
+
+// needsRebuild tells whether the removed vectors outnumber the live ones,
+// slowing down the searches
+func (h *hnswIndex) needsRebuild() bool {
+	return h.deleted > len(h.ids)
+}
+
+// similarity returns the cosine similarity of a query to a node
+func (h *hnswIndex) similarity(query []float64, queryNorm float64, node int) float64 {
+	norm := h.nodes[node].norm
+	if queryNorm <= 0.0 || norm <= 0.0 {
+		return 0.0
+	}
+	return dotProduct(query, h.nodes[node].vector) / (queryNorm * norm)
+}
+
+// insert adds the vector of a record, replacing its previous vector
+func (h *hnswIndex) insert(id string, vector []float64) {
+	h.remove(id)
+
+	level := int(-math.Log(1-h.random.Float64()) * h.levelMult)
+	node := len(h.nodes)
+	h.nodes = append(h.nodes, hnswNode{
+		id:      id,
+		vector:  vector,
+		norm:    vectorNorm(vector),
+		friends: make([][]int, level+1),
+	})
+	h.ids[id] = node
+	if h.entry < 0 {
+		h.entry, h.maxLevel = node, level
+		return
+	}
+
+	norm := h.nodes[node].norm
+	entryPoints := []hnswCandidate{{node: h.entry, similarity: h.similarity(vector, norm, h.entry)}}
+	for layer := h.maxLevel; layer > level; layer-- {
+		entryPoints = h.searchLayer(vector, norm, entryPoints, 1, layer)
+	}
+	for layer := min(level, h.maxLevel); layer >= 0; layer-- {
+		candidates := h.searchLayer(vector, norm, entryPoints, h.params.EfConstruction, layer)
+		neighbors := h.selectNeighbors(candidates, h.params.M)
+		for _, neighbor := range neighbors {
+			h.nodes[node].friends[layer] = append(h.nodes[node].friends[layer], neighbor.node)
+			h.link(neighbor.node, node, layer)
+		}
+		entryPoints = candidates
+	}
+	if level > h.maxLevel {
+		h.entry, h.maxLevel = node, level
+	}
+}
+
+// link adds a node to the neighbors of another one on a layer, keeping only
+// the best neighbors when they exceed the maximum of the layer
+func (h *hnswIndex) link(from int, to int, layer int) {
+	friends := append(h.nodes[from].friends[layer], to)
+	maxFriends := h.params.M
+	if layer == 0 {
+		maxFriends *= 2
+	}
+	if len(friends) > maxFriends {
+		vector, norm := h.nodes[from].vector, h.nodes[from].norm
+		candidates := make([]hnswCandidate, 0, len(friends))
+		for _, friend := range friends {
+			candidates = append(candidates, hnswCandidate{node: friend, similarity: h.similarity(vector, norm, friend)})
+		}
+		sortCandidates(candidates)
+		friends = friends[:0]
+		for _, neighbor := range h.selectNeighbors(candidates, maxFriends) {
+			friends = append(friends, neighbor.node)
+		}
+	}
+	h.nodes[from].friends[layer] = friends
+}
+
+// selectNeighbors keeps at most count candidates, sorted from the most
+// similar, preferring the ones closer to the new node than to the already
+// selected neighbors, so the links point in diverse directions
+func (h *hnswIndex) selectNeighbors(candidates []hnswCandidate, count int) []hnswCandidate {
+	if len(candidates) <= count {
+		return candidates
+	}
+	selected := make([]hnswCandidate, 0, count)
+	pruned := []hnswCandidate{}
+	for _, candidate := range candidates {
+		if len(selected) == count {
+			break
+		}
+		diverse := true
+		vector, norm := h.nodes[candidate.node].vector, h.nodes[candidate.node].norm
+		for _, neighbor := range selected {
+			if h.similarity(vector, norm, neighbor.node) > candidate.similarity {
+				diverse = false
+				break
+			}
+		}
+		if diverse {
+			selected = append(selected, candidate)
+		} else {
+			pruned = append(pruned, candidate)
+		}
+	}
+	// The closest pruned candidates fill the remaining links
+	for _, candidate := range pruned {
+		if len(selected) == count {
+			break
+		}
+		selected = append(selected, candidate)
+	}
+	sortCandidates(selected)
+	return selected
+}
+
+// remove marks the vector of a record as removed
+func (h *hnswIndex) remove(id string) {
+	node, ok := h.ids[id]
+	if !ok {
+		return
+	}
+	h.nodes[node].deleted = true
+	delete(h.ids, id)
+	h.deleted++
+}
+
+// search returns up to count vectors the most similar to a query, sorted
+// from the most similar, exploring max(ef, count) candidates
+func (h *hnswIndex) search(query []float64, count int, ef int) []hnswResult {
+	if h.entry < 0 {
+		return nil
+	}
+	norm := vectorNorm(query)
+	entryPoints := []hnswCandidate{{node: h.entry, similarity: h.similarity(query, norm, h.entry)}}
+	for layer := h.maxLevel; layer > 0; layer-- {
+		entryPoints = h.searchLayer(query, norm, entryPoints, 1, layer)
+	}
+	candidates := h.searchLayer(query, norm, entryPoints, max(ef, count), 0)
+
+	results := make([]hnswResult, 0, count)
+	for _, candidate := range candidates {
+		if len(results) == count {
+			break
+		}
+		if !h.nodes[candidate.node].deleted {
+			results = append(results, hnswResult{id: h.nodes[candidate.node].id, similarity: candidate.similarity})
+		}
+	}
+	return results
+}
+
+// searchLayer returns the ef nodes of a layer the most similar to a query
+// found from the entry points, sorted from the most similar
+func (h *hnswIndex) searchLayer(query []float64, norm float64, entryPoints []hnswCandidate, ef int, layer int) []hnswCandidate {
+	visited := make([]uint64, len(h.nodes)/64+1)
+	// candidates pops the most similar node to explore first,
+	// found pops the least similar of the ef best nodes
+	candidates := &candidateHeap{}
+	found := &candidateHeap{worstFirst: true}
+	for _, entryPoint := range entryPoints {
+		visited[entryPoint.node/64] |= 1 << (entryPoint.node % 64)
+		heap.Push(candidates, entryPoint)
+		heap.Push(found, entryPoint)
+		if found.Len() > ef {
+			heap.Pop(found)
+		}
+	}
+
+	for candidates.Len() > 0 {
+		current := heap.Pop(candidates).(hnswCandidate)
+		if found.Len() >= ef && current.similarity < found.items[0].similarity {
+			break
+		}
+		for _, friend := range h.nodes[current.node].friends[layer] {
+			if visited[friend/64]&(1<<(friend%64)) != 0 {
+				continue
+			}
+			visited[friend/64] |= 1 << (friend % 64)
+			similarity := h.similarity(query, norm, friend)
+			if found.Len() < ef || similarity > found.items[0].similarity {
+				heap.Push(candidates, hnswCandidate{node: friend, similarity: similarity})
+				heap.Push(found, hnswCandidate{node: friend, similarity: similarity})
+				if found.Len() > ef {
+					heap.Pop(found)
+				}
+			}
+		}
+	}
+
+	results := slices.Clone(found.items)
+	sortCandidates(results)
+	return results
+}
+
+// estimateRecall measures the fraction of the exact count most similar
+// vectors found by search, using a sample of the indexed vectors as queries
+func (h *hnswIndex) estimateRecall(samples int, count int) float64 {
+	live := make([]int, 0, len(h.ids))
+	for node := range h.nodes {
+		if !h.nodes[node].deleted {
+			live = append(live, node)
+		}
+	}
+	if len(live) == 0 {
+		return 1
+	}
+	step := max(len(live)/samples, 1)
+	found, expected := 0, 0
+	for sample := 0; sample < len(live); sample += step {
+		query := h.nodes[live[sample]].vector
+		norm := h.nodes[live[sample]].norm
+		exact := make([]hnswCandidate, 0, len(live))
+		for _, node := range live {
+			exact = append(exact, hnswCandidate{node: node, similarity: h.similarity(query, norm, node)})
+		}
+		sortCandidates(exact)
+		exact = exact[:min(count, len(exact))]
+		approximate := map[string]bool{}
+		for _, result := range h.search(query, count, h.params.EfSearch) {
+			approximate[result.id] = true
+		}
+		for _, candidate := range exact {
+			if approximate[h.nodes[candidate.node].id] {
+				found++
+			}
+		}
+		expected += len(exact)
+	}
+	return float64(found) / float64(expected)
+}
+
+// hnswCandidate is a node reached by a search, with its similarity to the query
+type hnswCandidate struct {
+	node       int
+	similarity float64
+}
+
+// sortCandidates sorts candidates from the most similar
+func sortCandidates(candidates []hnswCandidate) {
+	slices.SortFunc(candidates, func(a, b hnswCandidate) int {
+		return cmp.Compare(b.similarity, a.similarity)
+	})
+}
+
+// candidateHeap is a heap of candidates popping the most similar first,
+// or the least similar with worstFirst
+type candidateHeap struct {
+	items      []hnswCandidate
+	worstFirst bool
+}
+
+func (c *candidateHeap) Len() int { return len(c.items) }
+func (c *candidateHeap) Less(i, j int) bool {
+	if c.worstFirst {
+		return c.items[i].similarity < c.items[j].similarity
+	}
+	return c.items[i].similarity > c.items[j].similarity
+}
+func (c *candidateHeap) Swap(i, j int) { c.items[i], c.items[j] = c.items[j], c.items[i] }
+func (c *candidateHeap) Push(x any)    { c.items = append(c.items, x.(hnswCandidate)) }
+func (c *candidateHeap) Pop() any {
+	last := c.items[len(c.items)-1]
+	c.items = c.items[:len(c.items)-1]
+	return last
+}
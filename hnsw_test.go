@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/micro-agent/micro-agent-go/agent/rag"
+)
+
+// clusteredVectors returns count random vectors of a dimension, grouped in
+// clusters like the embeddings of related snippets
+func clusteredVectors(random *rand.Rand, count int, dimension int, clusters int) [][]float64 {
+	centers := make([][]float64, clusters)
+	for idx := range centers {
+		centers[idx] = make([]float64, dimension)
+		for component := range centers[idx] {
+			centers[idx][component] = random.NormFloat64()
+		}
+	}
+	vectors := make([][]float64, count)
+	for idx := range vectors {
+		center := centers[random.IntN(clusters)]
+		vectors[idx] = make([]float64, dimension)
+		for component := range vectors[idx] {
+			vectors[idx][component] = center[component] + 0.5*random.NormFloat64()
+		}
+	}
+	return vectors
+}
+
+// resultIDs returns the IDs of search results
+func resultIDs(records []SnippetRecord) []string {
+	ids := make([]string, 0, len(records))
+	for _, record := range records {
+		ids = append(ids, record.Id)
+	}
+	return ids
+}
+
+func TestANNSearchMatchesExactScan(t *testing.T) {
+	const (
+		records = 3000
+		queries = 100
+		topN    = 10
+	)
+	random := rand.New(rand.NewPCG(7, 11))
+	vectors := clusteredVectors(random, records+queries, 32, 30)
+
+	exact := setupServer(t, nil, nil)
+	approximate := NewSnippetStore(false, false, false, quantizationNone)
+	approximate.EnableANN(hnswParams{M: 16, EfConstruction: 100, EfSearch: 64}, 0)
+	for idx, vector := range vectors[:records] {
+		record := testRecord(fmt.Sprintf("record-%04d", idx), "snippets/go.md", "chunk", vector...)
+		exact.Save(record)
+		approximate.Save(record)
+	}
+
+	found, identicalFirst := 0, 0
+	for _, vector := range vectors[records:] {
+		question := rag.VectorRecord{Embedding: vector}
+		exactResults, err := exact.SearchTopNSimilarities(context.Background(), question, -1, topN, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		approximateResults, err := approximate.SearchTopNSimilarities(context.Background(), question, -1, topN, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		approximateIDs := map[string]bool{}
+		for _, id := range resultIDs(approximateResults) {
+			approximateIDs[id] = true
+		}
+		for _, id := range resultIDs(exactResults) {
+			if approximateIDs[id] {
+				found++
+			}
+		}
+		if approximateResults[0].Id == exactResults[0].Id {
+			identicalFirst++
+		}
+	}
+
+	recall := float64(found) / float64(queries*topN)
+	t.Logf("recall@%d = %.3f, identical first result for %d/%d queries", topN, recall, identicalFirst, queries)
+	if recall < 0.95 {
+		t.Errorf("recall@%d of the ANN search = %.3f, want at least 0.95", topN, recall)
+	}
+	if identicalFirst < queries*95/100 {
+		t.Errorf("the ANN search found the most similar record for %d/%d queries only", identicalFirst, queries)
+	}
+}
+
+func TestANNSearchSkipsDeletedRecords(t *testing.T) {
+	setupServer(t, nil, nil)
+	approximate := NewSnippetStore(false, false, false, quantizationNone)
+	approximate.EnableANN(hnswParams{M: 4, EfConstruction: 20, EfSearch: 20}, 0)
+	random := rand.New(rand.NewPCG(3, 5))
+	for idx, vector := range clusteredVectors(random, 200, 8, 5) {
+		approximate.Save(testRecord(fmt.Sprintf("record-%03d", idx), "snippets/go.md", "chunk", vector...))
+	}
+
+	target, _ := approximate.Get("record-042")
+	question := rag.VectorRecord{Embedding: target.Embedding}
+	results, err := approximate.SearchTopNSimilarities(context.Background(), question, -1, 1, nil)
+	if err != nil || len(results) != 1 || results[0].Id != "record-042" {
+		t.Fatalf("search of a stored vector = %v, %v, want record-042", resultIDs(results), err)
+	}
+	approximate.Delete("record-042")
+	results, err = approximate.SearchTopNSimilarities(context.Background(), question, -1, 5, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range resultIDs(results) {
+		if id == "record-042" {
+			t.Fatal("the ANN search returned a deleted record")
+		}
+	}
+}
+
+func TestANNRebuiltWhenResavedRecordsAccumulate(t *testing.T) {
+	setupServer(t, nil, nil)
+	approximate := NewSnippetStore(false, false, false, quantizationNone)
+	approximate.EnableANN(hnswParams{M: 4, EfConstruction: 20, EfSearch: 20}, 0)
+	random := rand.New(rand.NewPCG(13, 17))
+	vectors := clusteredVectors(random, 50, 8, 5)
+	for idx, vector := range vectors {
+		approximate.Save(testRecord(fmt.Sprintf("record-%02d", idx), "snippets/go.md", "chunk", vector...))
+	}
+
+	// Each save of an existing record replaces its vector
+	for round := range 10 {
+		for idx, vector := range vectors {
+			approximate.Save(testRecord(fmt.Sprintf("record-%02d", idx), "snippets/go.md", fmt.Sprintf("chunk %d", round), vector...))
+		}
+	}
+	approximate.mutex.RLock()
+	defer approximate.mutex.RUnlock()
+	if live, deleted := approximate.ann.len(), approximate.ann.deleted; live != len(vectors) || deleted > live {
+		t.Errorf("the ANN index holds %d live and %d replaced vectors, want %d live and at most as many replaced",
+			live, deleted, len(vectors))
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	// htmlIgnoredBlocks matches the elements whose content is not text
+	htmlIgnoredBlocks = regexp.MustCompile(`(?is)<(script|style|noscript|template|svg|head)\b.*?</(script|style|noscript|template|svg|head)>|<!--.*?-->`)
+	// htmlBlockTags matches the tags ending a block of text
+	htmlBlockTags = regexp.MustCompile(`(?i)<(br|/p|/div|/h[1-6]|/li|/tr|/pre|/section|/article|/blockquote)\b[^>]*>`)
+	// htmlTags matches the tags, with their attributes: the text of the links is kept
+	htmlTags   = regexp.MustCompile(`(?s)<[^>]*>`)
+	spaces     = regexp.MustCompile(`[ \t\r\f\v]+`)
+	blankLines = regexp.MustCompile(`\n{3,}`)
+)
+
+// stripHTML returns the text of an HTML page: the tags, scripts and styles are
+// removed, the blocks are separated by line breaks and the whitespace is collapsed
+func stripHTML(page string) string {
+	text := htmlIgnoredBlocks.ReplaceAllString(page, "")
+	text = htmlBlockTags.ReplaceAllString(text, "\n")
+	text = htmlTags.ReplaceAllString(text, "")
+	text = html.UnescapeString(text)
+
+	lines := strings.Split(text, "\n")
+	for idx, line := range lines {
+		lines[idx] = strings.TrimSpace(spaces.ReplaceAllString(line, " "))
+	}
+	text = blankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+	return strings.TrimSpace(text)
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ignoreFileName is the file, at the root of the content directory,
+// listing the gitignore-style patterns of the files not to index
+const ignoreFileName = ".mcpignore"
+
+// ignoreRule is a gitignore-style pattern:
+// a pattern containing a slash is matched against the path relative to the
+// content directory, otherwise against the name of the file or directory at
+// any depth; a trailing slash only matches directories, and ** matches any
+// number of directories
+type ignoreRule struct {
+	pattern  string
+	dirOnly  bool
+	anchored bool
+}
+
+// ignoreMatcher tells whether a content file or directory is excluded from indexing
+type ignoreMatcher []ignoreRule
+
+// loadIgnoreMatcher reads the patterns of the .mcpignore file of the
+// content directory, when it exists, and the IGNORE_PATTERNS setting
+func loadIgnoreMatcher(contentDir string, patterns []string) (ignoreMatcher, error) {
+	data, err := os.ReadFile(filepath.Join(contentDir, ignoreFileName))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return newIgnoreMatcher(append(strings.Split(string(data), "\n"), patterns...)), nil
+}
+
+// newIgnoreMatcher parses gitignore-style patterns, skipping the empty
+// lines and the comments
+func newIgnoreMatcher(patterns []string) ignoreMatcher {
+	matcher := ignoreMatcher{}
+	for _, pattern := range patterns {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" || strings.HasPrefix(pattern, "#") {
+			continue
+		}
+		rule := ignoreRule{}
+		if strings.HasSuffix(pattern, "/") {
+			rule.dirOnly = true
+			pattern = strings.TrimSuffix(pattern, "/")
+		}
+		if strings.Contains(pattern, "/") {
+			rule.anchored = true
+			pattern = strings.TrimPrefix(pattern, "/")
+		}
+		rule.pattern = pattern
+		matcher = append(matcher, rule)
+	}
+	return matcher
+}
+
+// Match tells whether the path, relative to the content directory, is ignored
+func (m ignoreMatcher) Match(relativePath string, isDir bool) bool {
+	relativePath = filepath.ToSlash(relativePath)
+	for _, rule := range m {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		if rule.anchored {
+			if matchSegments(strings.Split(rule.pattern, "/"), strings.Split(relativePath, "/")) {
+				return true
+			}
+		} else if matched, _ := path.Match(rule.pattern, path.Base(relativePath)); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// matchSegments matches path segments against pattern segments, ** matching
+// zero or more segments
+func matchSegments(patterns []string, segments []string) bool {
+	if len(patterns) == 0 {
+		return len(segments) == 0
+	}
+	if patterns[0] == "**" {
+		for skipped := 0; skipped <= len(segments); skipped++ {
+			if matchSegments(patterns[1:], segments[skipped:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(segments) == 0 {
+		return false
+	}
+	if matched, _ := path.Match(patterns[0], segments[0]); !matched {
+		return false
+	}
+	return matchSegments(patterns[1:], segments[1:])
+}
+
+// walkContentDirs walks the content files of each content directory like
+// walkContentFiles, with the ignore patterns of its .mcpignore file and the
+// extra patterns, calling fn with the directory and the path of each file
+func walkContentDirs(contentDirs []string, patterns []string, fn func(contentDir string, path string) error) error {
+	for _, contentDir := range contentDirs {
+		ignored, err := loadIgnoreMatcher(contentDir, patterns)
+		if err != nil {
+			return fmt.Errorf("failed to read the ignore patterns %s: %w", filepath.Join(contentDir, ignoreFileName), err)
+		}
+		err = walkContentFiles(contentDir, ignored, func(path string) error {
+			return fn(contentDir, path)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkContentFiles calls fn with the path of each file of the content
+// directory which is not ignored; ignored directories are not walked
+func walkContentFiles(contentDir string, ignored ignoreMatcher, fn func(path string) error) error {
+	return filepath.WalkDir(contentDir, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		relativePath, err := filepath.Rel(contentDir, filePath)
+		if err != nil || relativePath == "." {
+			return err
+		}
+		if ignored.Match(relativePath, entry.IsDir()) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		return fn(filePath)
+	})
+}
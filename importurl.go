@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// importURLHandler returns the handler of the import_url tool: the content of
+// the URL is chunked, embedded and stored with the URL as source, replacing
+// the chunks of a previous import of the same URL. The chunks expire at the
+// expires_at argument, or else at the expires_at date of the frontmatter.
+func importURLHandler(s *server.MCPServer) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		rawURL, err := request.RequireString("url")
+		if err != nil {
+			return nil, fmt.Errorf("missing required parameter 'url'")
+		}
+		parsedURL, err := url.Parse(rawURL)
+		if err != nil || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") || parsedURL.Host == "" {
+			return nil, fmt.Errorf("parameter 'url' must be an http or https URL")
+		}
+
+		var expiresAt *time.Time
+		if value := request.GetString("expires_at", ""); value != "" {
+			expiry, err := parseExpiry(value)
+			if err != nil {
+				return nil, fmt.Errorf("parameter 'expires_at': %w", err)
+			}
+			expiresAt = &expiry
+		}
+
+		if !isStoreReady() {
+			return nil, fmt.Errorf("the vector store is not ready yet, please retry later")
+		}
+
+		slog.Info("🌐 Importing URL", "url", rawURL)
+		content, converted, err := fetchURL(ctx, rawURL)
+		if err != nil {
+			slog.Error("😡 Error fetching the URL", "url", rawURL, "error", err)
+			return nil, err
+		}
+
+		// Replace the chunks of a previous import
+		for _, record := range store.Records() {
+			if record.Source == rawURL {
+				if err := store.Delete(record.Id); err != nil {
+					return nil, fmt.Errorf("failed to remove the previously imported chunks: %w", err)
+				}
+			}
+		}
+
+		chunks := chunkContent(content, rawURL, config.Delimiter)
+		if converted {
+			chunks = withoutPositions(chunks)
+		}
+		// The content is as recent as its import
+		importedAt := time.Now()
+		for idx := range chunks {
+			chunks[idx].ModifiedAt = &importedAt
+			if expiresAt != nil {
+				chunks[idx].ExpiresAt = expiresAt
+			}
+		}
+		progress := newIndexProgress(len(chunks), mcpProgressNotifier(ctx, request))
+		imported := 0
+		for idx, chunk := range chunks {
+			if strings.TrimSpace(chunk.Prompt) == "" {
+				progress.Increment()
+				continue
+			}
+			saved, err := indexChunk(ctx, idx, chunk)
+			progress.Increment()
+			if err != nil {
+				slog.Error("😡 Error indexing the chunk", "chunk_index", idx, "source", rawURL, "error", err)
+				return nil, fmt.Errorf("failed to import the chunk %d of the URL: %w", idx, err)
+			}
+			if saved {
+				imported++
+			}
+		}
+
+		flushStore(config.StoreFilePath())
+		registerSnippetResources(s)
+
+		slog.Info("✅ URL imported", "url", rawURL, "chunks", imported)
+		return mcp.NewToolResultText(fmt.Sprintf("Imported %d chunks from %s", imported, rawURL)), nil
+	}
+}
+
+// fetchURL returns the text content of a URL, without the tags of an HTML
+// page, and whether it was converted from HTML.
+// The download is bounded by IMPORT_TIMEOUT and IMPORT_MAX_BYTES.
+func fetchURL(ctx context.Context, rawURL string) (string, bool, error) {
+	if config.ImportTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, config.ImportTimeout)
+		defer cancel()
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return "", false, fmt.Errorf("invalid URL: %w", err)
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to fetch the URL: %w", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return "", false, fmt.Errorf("failed to fetch the URL: HTTP status %s", response.Status)
+	}
+	if response.ContentLength > config.ImportMaxBytes {
+		return "", false, fmt.Errorf("the content of the URL exceeds %d bytes", config.ImportMaxBytes)
+	}
+	body, err := io.ReadAll(io.LimitReader(response.Body, config.ImportMaxBytes+1))
+	if err != nil {
+		return "", false, fmt.Errorf("failed to read the content of the URL: %w", err)
+	}
+	if int64(len(body)) > config.ImportMaxBytes {
+		return "", false, fmt.Errorf("the content of the URL exceeds %d bytes", config.ImportMaxBytes)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(response.Header.Get("Content-Type"))
+	if mediaType == "text/html" || mediaType == "application/xhtml+xml" {
+		return stripHTML(string(body)), true, nil
+	}
+	return string(body), false, nil
+}
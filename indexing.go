@@ -0,0 +1,413 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/micro-agent/micro-agent-go/agent/helpers"
+	"github.com/micro-agent/micro-agent-go/agent/rag"
+)
+
+// Behaviours when the stored embeddings don't match the embedding model
+const (
+	onModelMismatchFail    = "fail"
+	onModelMismatchReindex = "reindex"
+)
+
+// Behaviours when the store is built from fewer than MIN_CONTENT_FILES files
+const (
+	onTooFewContentFilesWarn = "warn"
+	onTooFewContentFilesFail = "fail"
+)
+
+// contentFileConverters lists the extensions of the indexed content files,
+// with the conversion of their content to text (nil when it is already text)
+var contentFileConverters = map[string]func(content string) string{
+	".md":    nil,
+	".txt":   nil,
+	".jsonl": nil,
+	".html":  stripHTML,
+	".htm":   stripHTML,
+}
+
+// initializeStore loads the vector store from jsonStoreFilePath, or builds it
+// from the content files when it does not exist yet or FORCE_REINDEX is set,
+// then marks it ready. A read-only server (READ_ONLY) fails instead of
+// building the store.
+func initializeStore(ctx context.Context, jsonStoreFilePath string, delimiter string, onModelMismatch string) {
+	if config.ForceReindex {
+		// The previous store file is replaced (and backed up) when the new store is persisted
+		slog.Warn("🔁 FORCE_REINDEX is set, rebuilding the vector store from the content files", "path", jsonStoreFilePath)
+		store.Reset()
+		buildStore(ctx, jsonStoreFilePath, delimiter)
+		setStoreState(stateReady)
+		return
+	}
+
+	// Load the vector store from a file if it exists
+	err := store.Load(jsonStoreFilePath)
+	// Recovering the backup replaces the store file
+	if err != nil && !os.IsNotExist(err) && config.StoreBackup && config.StoreBackend == storeBackendJSON && !config.ReadOnly {
+		err = loadStoreBackup(jsonStoreFilePath, err)
+	}
+	if err != nil {
+		if os.IsNotExist(err) && config.ReadOnly {
+			failStoreInitialization("😡 No vector store to serve, and READ_ONLY forbids building it", "path", jsonStoreFilePath)
+		}
+		if os.IsNotExist(err) {
+			slog.Info("🚀 No existing vector store found, starting fresh.")
+			buildStore(ctx, jsonStoreFilePath, delimiter)
+		} else {
+			failStoreInitialization("😡 Error loading vector store", "path", jsonStoreFilePath, "error", err)
+		}
+	} else {
+		slog.Info("💾 Vector store loaded successfully", "path", jsonStoreFilePath, "records", store.Count())
+
+		if mismatch := checkModelMismatch(ctx); mismatch != "" {
+			if onModelMismatch != onModelMismatchReindex {
+				failStoreInitialization("😡 The vector store was built with another embedding model, delete it or set ON_MODEL_MISMATCH=reindex",
+					"path", jsonStoreFilePath, "mismatch", mismatch)
+			}
+			slog.Warn("🔶 The vector store was built with another embedding model, reindexing", "mismatch", mismatch)
+			store.Reset()
+			buildStore(ctx, jsonStoreFilePath, delimiter)
+		}
+	}
+	setStoreState(stateReady)
+}
+
+// checkModelMismatch compares the loaded store with the configured embedding
+// model: the model name (and DOCUMENT_PREFIX) when the store recorded it, and the dimension of the
+// stored vectors with the dimension of a freshly embedded probe.
+// It returns a description of the mismatch, or "" when they match.
+func checkModelMismatch(ctx context.Context) string {
+	if model := store.Model(); model != "" && model != config.StoreModel() {
+		return fmt.Sprintf("store model %q, configured model %q", model, config.StoreModel())
+	}
+
+	storeDimension := store.Stats().EmbeddingDimension
+	if storeDimension == 0 {
+		return ""
+	}
+	probe, err := embedder.GenerateEmbeddingVector(ctx, "dimension probe")
+	if err != nil {
+		slog.Warn("🔶 Unable to check the embedding dimension of the vector store", "error", err)
+		return ""
+	}
+	if len(probe) != storeDimension {
+		return fmt.Sprintf("store dimension %d, model dimension %d", storeDimension, len(probe))
+	}
+	return ""
+}
+
+// buildStore chunks the content files, creates the embeddings of the chunks
+// and saves the store to jsonStoreFilePath, with the chunks which couldn't
+// be indexed
+func buildStore(ctx context.Context, jsonStoreFilePath string, delimiter string) {
+	store.SetModel(config.StoreModel())
+
+	// =================================================
+	// CHUNKS:
+	// =================================================
+	chunks := []SnippetRecord{}
+	slog.Info("📝 Processing(Chunking) content files...", "delimiter", delimiter)
+
+	files := 0
+	// filesPerDir counts the content files of each content directory
+	filesPerDir := map[string]int{}
+	// The large files are chunked again while they are embedded,
+	// so their content is never held in memory
+	streamedFiles := []string{}
+	streamedChunks := 0
+	duplicates := newFileDeduplicator(config.DedupFiles)
+	now := time.Now()
+	err := walkContentDirs(config.ContentDirs, config.IgnorePatterns, func(contentDir string, path string) error {
+		convert, ok := contentFileConverters[strings.ToLower(filepath.Ext(path))]
+		if !ok {
+			return nil
+		}
+		if duplicate, err := duplicates.check(path); err != nil || duplicate {
+			return err
+		}
+		files++
+		filesPerDir[contentDir]++
+		if expired, err := isExpiredFile(path, now); err != nil || expired {
+			if expired {
+				slog.Debug("⌛ Expired content file skipped", "source", path)
+			}
+			return err
+		}
+		delimiter := config.DelimiterFor(path, delimiter)
+		if convert == nil && isStreamed(path, delimiter) {
+			fileChunks := 0
+			if err := streamContentChunks(path, delimiter, func(SnippetRecord) { fileChunks++ }); err != nil {
+				return err
+			}
+			slog.Debug("📏 Large content file chunked while reading it", "source", path, "chunks", fileChunks)
+			streamedFiles = append(streamedFiles, path)
+			streamedChunks += fileChunks
+			return nil
+		}
+		fileChunks, err := readContentChunks(path, convert, delimiter)
+		if err != nil {
+			return err
+		}
+		slog.Debug("📏 Content file chunked", "source", path, "chunks", len(fileChunks))
+		chunks = append(chunks, fileChunks...)
+		return nil
+	})
+	if err != nil {
+		failStoreInitialization("😡 Error getting content files", "error", err)
+	}
+	for _, contentDir := range config.ContentDirs {
+		slog.Info("📂 Content directory processed", "path", contentDir, "files", filesPerDir[contentDir])
+	}
+	for _, archivePath := range config.ContentArchives {
+		archiveFiles := 0
+		err := walkArchiveChunks(archivePath, config.IgnorePatterns, delimiter, func(name string, fileChunks []SnippetRecord) {
+			slog.Debug("📏 Content file chunked", "source", name, "archive", archivePath, "chunks", len(fileChunks))
+			chunks = append(chunks, fileChunks...)
+			archiveFiles++
+		})
+		if err != nil {
+			failStoreInitialization("😡 Error reading the content archive", "path", archivePath, "error", err)
+		}
+		files += archiveFiles
+		slog.Info("🗜️ Content archive processed", "path", archivePath, "files", archiveFiles)
+	}
+	slog.Info("💡 Content files processed", "files", files, "chunks", len(chunks)+streamedChunks, "streamed_files", len(streamedFiles))
+	checkContentFiles(files)
+
+	// -------------------------------------------------
+	// Create and save the embeddings from the chunks
+	// -------------------------------------------------
+	slog.Info("⏳ Creating the embeddings...")
+
+	skipped := 0
+	failures := indexFailures{}
+	progress := newIndexProgress(len(chunks)+streamedChunks, nil)
+	indexer := newChunkIndexer(ctx, config.EmbeddingBatchSize, func(idx int, chunk SnippetRecord, saved bool, err error) {
+		progress.Increment()
+		if err != nil {
+			slog.Error("😡 Error indexing the chunk", "chunk_index", idx, "source", chunk.Source, "error", err)
+			failures.add(recordContentFile(chunk))
+		} else if !saved {
+			skipped++
+		}
+	})
+	for _, chunk := range chunks {
+		indexer.add(chunk)
+	}
+	for _, path := range streamedFiles {
+		if err := streamContentChunks(path, config.DelimiterFor(path, delimiter), indexer.add); err != nil {
+			slog.Error("😡 Error reading the content file", "source", path, "error", err)
+		}
+	}
+	indexer.flush()
+
+	slog.Info("✋ Embeddings created", "records", store.Count())
+	if !failures.complete() {
+		slog.Warn("🔶 The index is incomplete, reindex to index the failed chunks", "failed_chunks", failures.Count, "sources", failures.Sources)
+	}
+	store.SetFailures(failures)
+	if config.DedupThreshold > 0 {
+		slog.Info("♊ Near-duplicate chunks skipped", "skipped", skipped, "dedup_threshold", config.DedupThreshold)
+	}
+	err = store.Persist(jsonStoreFilePath)
+	if err != nil {
+		failStoreInitialization("😡 Error saving vector store", "error", err)
+	}
+	slog.Info("💾 Vector store initialized and saved", "path", jsonStoreFilePath, "records", store.Count())
+}
+
+// checkContentFiles reports a store built from fewer than MIN_CONTENT_FILES
+// content files, most likely a wrong CONTENT_DIR or content files of an
+// unsupported extension, which would leave the store empty and never
+// healthy: it is logged, and the server exits with
+// ON_TOO_FEW_CONTENT_FILES=fail
+func checkContentFiles(files int) {
+	if files >= config.MinContentFiles {
+		return
+	}
+	msg := "Too few content files found, check CONTENT_DIR (or CONTENT_ARCHIVE), IGNORE_PATTERNS and the extensions of the content files"
+	args := []any{"files", files, "min_content_files", config.MinContentFiles, "content_dirs", config.ContentDirs,
+		"content_archives", config.ContentArchives, "extensions", slices.Sorted(maps.Keys(contentFileConverters))}
+	if config.OnTooFewContentFiles == onTooFewContentFilesFail {
+		failStoreInitialization("😡 "+msg, args...)
+	}
+	slog.Warn("🔶 "+msg, args...)
+}
+
+// readContentChunks reads a content file, converts its content to text with
+// convert (nil when it is already text), and chunks it. The chunks keep the
+// modification time of the file.
+func readContentChunks(path string, convert func(content string) string, delimiter string) ([]SnippetRecord, error) {
+	if isJSONLFile(path) {
+		return readJSONLChunks(path, delimiter)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	content, err := helpers.ReadTextFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var chunks []SnippetRecord
+	if convert == nil {
+		chunks = chunkContent(content, path, delimiter)
+	} else {
+		chunks = withoutPositions(chunkContent(convert(content), path, delimiter))
+	}
+	modifiedAt := info.ModTime()
+	for idx := range chunks {
+		chunks[idx].ModifiedAt = &modifiedAt
+	}
+	return chunks, nil
+}
+
+// fileDeduplicator finds the content files identical to a file already
+// processed, a copy or a symlink, by the hash of their content
+type fileDeduplicator struct {
+	// paths maps the hashes of the processed files to their paths
+	paths map[[sha256.Size]byte]string
+}
+
+// newFileDeduplicator creates a deduplicator, or nil when disabled:
+// a nil deduplicator finds no duplicate
+func newFileDeduplicator(enabled bool) *fileDeduplicator {
+	if !enabled {
+		return nil
+	}
+	return &fileDeduplicator{paths: map[[sha256.Size]byte]string{}}
+}
+
+// check hashes the content of a file, and reports whether a file with the
+// same content was already processed
+func (d *fileDeduplicator) check(path string) (bool, error) {
+	if d == nil {
+		return false, nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return false, err
+	}
+	var sum [sha256.Size]byte
+	copy(sum[:], hash.Sum(nil))
+
+	if first, ok := d.paths[sum]; ok {
+		slog.Info("♊ Duplicate content file skipped", "source", path, "duplicate_of", first)
+		return true, nil
+	}
+	d.paths[sum] = path
+	return false, nil
+}
+
+// isStreamed tells whether a content file is larger than STREAMING_THRESHOLD_BYTES
+// (0 disables streaming), so it is chunked while it is read. The JSON Lines
+// files are always read a line at a time.
+func isStreamed(path string, delimiter string) bool {
+	if config.StreamingThresholdBytes <= 0 || (config.ChunkStrategy != chunkStrategyRecursive && delimiter == "") || isJSONLFile(path) {
+		return false
+	}
+	info, err := os.Stat(path)
+	return err == nil && info.Size() > config.StreamingThresholdBytes
+}
+
+// indexChunk creates the embedding of a chunk, prefixed with DOCUMENT_PREFIX,
+// and saves it in the store, unless it is a near-duplicate of a stored chunk.
+// It reports whether the chunk was saved.
+func indexChunk(ctx context.Context, idx int, chunk SnippetRecord) (bool, error) {
+	embeddingVector, err := embedChunk(ctx, idx, chunk)
+	if err != nil {
+		return false, err
+	}
+	return saveChunk(ctx, idx, chunk, embeddingVector)
+}
+
+// embedChunk creates the embedding of a chunk, prefixed with DOCUMENT_PREFIX
+func embedChunk(ctx context.Context, idx int, chunk SnippetRecord) ([]float64, error) {
+	slog.Debug("🔶 Embedding chunk", "chunk_index", idx, "source", chunk.Source, "title", chunk.Title, "chunk", chunk.Prompt)
+	if err := embeddingLimiter.WaitIndex(ctx); err != nil {
+		return nil, err
+	}
+	embeddingVector, err := withRetries(ctx, config.IndexRetryPolicy(), func() ([]float64, error) {
+		start := time.Now()
+		embeddingVector, err := embedder.GenerateEmbeddingVector(ctx, config.DocumentPrefix+chunk.Prompt)
+		observeEmbedding(phaseIndex, start, err)
+		return embeddingVector, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the chunk embedding: %w", err)
+	}
+	return embeddingVector, nil
+}
+
+// saveChunk saves a chunk with its embedding in the store, unless the
+// embedding is invalid (see checkEmbedding) or the chunk is a near-duplicate
+// of a stored chunk. It reports whether the chunk was saved.
+func saveChunk(ctx context.Context, idx int, chunk SnippetRecord, embeddingVector []float64) (bool, error) {
+	if err := checkEmbedding(embeddingVector); err != nil {
+		slog.Warn("🔶 Chunk with an invalid embedding skipped", "chunk_index", idx, "source", chunk.Source,
+			"title", chunk.Title, "error", err)
+		return false, nil
+	}
+	if duplicate, ok := findDuplicate(ctx, embeddingVector); ok {
+		slog.Debug("♊ Near-duplicate chunk skipped", "chunk_index", idx, "source", chunk.Source,
+			"duplicate_of", duplicate.Id, "duplicate_source", duplicate.Source, "similarity", roundScore(duplicate.CosineSimilarity))
+		return false, nil
+	}
+
+	chunk.Embedding = embeddingVector
+	chunk.Tags = withDefaultTags(chunk.Tags)
+	if _, err := store.Save(chunk); err != nil {
+		return false, fmt.Errorf("failed to save the chunk: %w", err)
+	}
+	slog.Debug("✅ Chunk saved", "chunk_index", idx, "source", chunk.Source, "dimension", len(embeddingVector))
+	return true, nil
+}
+
+// withDefaultTags returns the tags of a chunk followed by the DEFAULT_TAGS it
+// doesn't have yet
+func withDefaultTags(tags []string) []string {
+	merged := slices.Clone(tags)
+	for _, tag := range config.DefaultTags {
+		if !slices.Contains(merged, tag) {
+			merged = append(merged, tag)
+		}
+	}
+	return merged
+}
+
+// findDuplicate returns the stored record the most similar to an embedding
+// when their cosine similarity exceeds DEDUP_THRESHOLD (0 disables deduplication)
+func findDuplicate(ctx context.Context, embedding []float64) (SnippetRecord, bool) {
+	if config.DedupThreshold <= 0 {
+		return SnippetRecord{}, false
+	}
+	similar, err := store.SearchTopNSimilarities(ctx, rag.VectorRecord{Embedding: embedding}, config.DedupThreshold, 1, nil)
+	if err != nil || len(similar) == 0 {
+		return SnippetRecord{}, false
+	}
+	return similar[0], true
+}
+
+// failStoreInitialization reports the store as failed and stops the server
+func failStoreInitialization(msg string, args ...any) {
+	setStoreState(stateFailed)
+	fatal(msg, args...)
+}
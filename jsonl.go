@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// jsonlExtension is the extension of the JSON Lines content files, whose
+// lines are snippets with their metadata instead of text to chunk
+const jsonlExtension = ".jsonl"
+
+// jsonlSnippet is a line of a JSON Lines content file
+type jsonlSnippet struct {
+	Text   string   `json:"text"`
+	Source string   `json:"source"`
+	Tags   []string `json:"tags"`
+}
+
+// isJSONLFile tells whether a content file is a JSON Lines file
+func isJSONLFile(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), jsonlExtension)
+}
+
+// readJSONLChunks reads the snippets of a JSON Lines content file, a line
+// at a time: the text of each snippet is chunked like the content of a file
+// (a short text is a single chunk), and its chunks keep the source (the path
+// of the file by default) and the tags of the snippet. The malformed lines
+// are logged and skipped.
+func readJSONLChunks(path string, delimiter string) ([]SnippetRecord, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return scanJSONLChunks(file, path, path, info.ModTime(), delimiter)
+}
+
+// scanJSONLChunks chunks the snippets of JSON Lines content read from r, like
+// readJSONLChunks: path is the default source of the snippets, and
+// contentFile the content file recorded by the chunks whose source differs.
+func scanJSONLChunks(r io.Reader, path string, contentFile string, modifiedAt time.Time, delimiter string) ([]SnippetRecord, error) {
+	chunks := []SnippetRecord{}
+	reader := bufio.NewReader(r)
+	for lineNumber := 1; ; lineNumber++ {
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if strings.TrimSpace(line) != "" {
+			snippet, parseErr := parseJSONLSnippet(line)
+			if parseErr != nil {
+				slog.Warn("🔶 Malformed JSONL line skipped", "source", path, "line", lineNumber, "error", parseErr)
+			} else {
+				source := snippet.Source
+				if source == "" {
+					source = path
+				}
+				for _, chunk := range withoutPositions(chunkContent(snippet.Text, source, delimiter)) {
+					chunk.Tags = snippet.Tags
+					if source != contentFile {
+						chunk.ContentFile = contentFile
+					}
+					chunk.ModifiedAt = &modifiedAt
+					chunks = append(chunks, chunk)
+				}
+			}
+		}
+		if err == io.EOF {
+			return chunks, nil
+		}
+	}
+}
+
+// parseJSONLSnippet parses a line of a JSON Lines content file
+func parseJSONLSnippet(line string) (jsonlSnippet, error) {
+	var snippet jsonlSnippet
+	if err := json.Unmarshal([]byte(line), &snippet); err != nil {
+		return snippet, err
+	}
+	if strings.TrimSpace(snippet.Text) == "" {
+		return snippet, errors.New(`missing "text"`)
+	}
+	return snippet, nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// keywordSearch is the fallback of the semantic search when the topic can't
+// be embedded: it returns the max records, passing the filters, containing
+// the most significant terms of the topic. The CosineSimilarity of a result
+// is the fraction of the terms it contains, not a cosine similarity.
+func keywordSearch(ctx context.Context, topic string, max int, filters ...RecordFilter) ([]SnippetRecord, error) {
+	terms := queryTerms(topic)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+
+	type match struct {
+		record      SnippetRecord
+		terms       int
+		occurrences int
+	}
+	matches := []match{}
+	now := time.Now()
+	for _, record := range store.Records() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if !matchesFilters(record, now, filters) {
+			continue
+		}
+		words := map[string]int{}
+		for _, word := range textWords(record.Title + "\n" + record.Prompt) {
+			words[word]++
+		}
+		found := match{record: record}
+		for _, term := range terms {
+			if words[term] > 0 {
+				found.terms++
+				found.occurrences += words[term]
+			}
+		}
+		if found.terms > 0 {
+			found.record.CosineSimilarity = float64(found.terms) / float64(len(terms))
+			found.record.Embedding = nil
+			matches = append(matches, found)
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].terms != matches[j].terms {
+			return matches[i].terms > matches[j].terms
+		}
+		return matches[i].occurrences > matches[j].occurrences
+	})
+	results := make([]SnippetRecord, 0, min(max, len(matches)))
+	for _, found := range matches[:min(max, len(matches))] {
+		results = append(results, found.record)
+	}
+	return results, nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// setupLogger installs the default slog logger, configured with
+// LOG_LEVEL (debug, info, warn, error) and LOG_FORMAT (text, json)
+func setupLogger(logLevel string, logFormat string) {
+	var level slog.Level
+	switch strings.ToLower(logLevel) {
+	case "debug":
+		level = slog.LevelDebug
+	case "warn", "warning":
+		level = slog.LevelWarn
+	case "error":
+		level = slog.LevelError
+	default:
+		level = slog.LevelInfo
+	}
+
+	options := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler
+	if strings.ToLower(logFormat) == "json" {
+		handler = slog.NewJSONHandler(os.Stdout, options)
+	} else {
+		handler = slog.NewTextHandler(os.Stdout, options)
+	}
+	slog.SetDefault(slog.New(handler))
+}
+
+// fatal logs an error message with its attributes and exits
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// splitErrors returns the errors joined in err by errors.Join
+func splitErrors(err error) []error {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		return joined.Unwrap()
+	}
+	return []error{err}
+}
@@ -2,27 +2,54 @@ package main
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
-	"log"
+	"errors"
+	"flag"
+	"log/slog"
+	"maps"
 	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"syscall"
+	"time"
 
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
-	"github.com/micro-agent/micro-agent-go/agent/helpers"
-	"github.com/micro-agent/micro-agent-go/agent/mu"
-	"github.com/micro-agent/micro-agent-go/agent/rag"
 	"github.com/openai/openai-go/v2" // imported as openai
 	"github.com/openai/openai-go/v2/option"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
-var store rag.MemoryVectorStore
-var embeddingAgent mu.Agent
-var embeddingsModel string
+var config *Config
+var store VectorStore
+var embedder *embeddingModel
+var reranker *llmReranker
+var expander *llmQueryExpander
+var queryEmbeddings *queryCache
+
+// searchResults caches the results of search_snippet, nil when RESULT_CACHE_TTL is 0
+var searchResults *resultCache
+var queries *queryLog
+var feedback *feedbackLog
+var embeddingLimiter *rateLimiter
 
 func main() {
-	ctx := context.Background()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var err error
+	config, err = loadConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if config == nil {
+		fatal("😡 Invalid configuration", "error", err)
+	}
+	setupLogger(config.LogLevel, config.LogFormat)
+	if config.ConfigFile != "" {
+		slog.Info("📄 Configuration file loaded", "path", config.ConfigFile)
+	}
 
 	// Create MCP server
 	s := server.NewMCPServer(
@@ -30,214 +57,415 @@ func main() {
 		"0.0.0",
 	)
 
-	baseURL := helpers.GetEnvOrDefault("MODEL_RUNNER_BASE_URL", "http://localhost:12434/engines/llama.cpp/v1/")
-	embeddingsModel = helpers.GetEnvOrDefault("EMBEDDING_MODEL", "ai/mxbai-embed-large:latest")
-	jsonStoreFilePath := helpers.GetEnvOrDefault("JSON_STORE_FILE_PATH", "rag-memory-store.json")
-	delimiter := helpers.GetEnvOrDefault("DELIMITER", "----------")
-
-	client := openai.NewClient(
-		option.WithBaseURL(baseURL),
+	clientOptions := []option.RequestOption{
+		option.WithBaseURL(config.ModelRunnerBaseURL),
 		option.WithAPIKey(""),
-	)
+	}
+	// The extra headers, e.g. for a gateway, may override the authorization header
+	headerNames := slices.Sorted(maps.Keys(config.EmbeddingHeaders))
+	for _, name := range headerNames {
+		clientOptions = append(clientOptions, option.WithHeader(name, config.EmbeddingHeaders[name]))
+	}
+	if len(headerNames) > 0 {
+		slog.Info("📨 Extra headers of the model backend requests", "headers", headerNames)
+	}
+	client := openai.NewClient(clientOptions...)
+	// The embedding calls are retried with the policy of their phase
+	// (INDEX_EMBEDDING_RETRIES or QUERY_EMBEDDING_RETRIES), not by the client
+	embeddingClient := openai.NewClient(slices.Concat(clientOptions, []option.RequestOption{option.WithMaxRetries(0)})...)
+
+	// EMBEDDER: Create an embedder to generate embeddings
+	embedder = newEmbeddingModel(config.EmbeddingModel,
+		embedderFactory(config.EmbeddingProvider, embeddingClient, config.ModelRunnerBaseURL, config.EmbeddingHeaders, config.EmbeddingTimeout)).
+		withFallbacks(config.FallbackEmbeddingModels)
+	if len(config.FallbackEmbeddingModels) > 0 {
+		slog.Info("🪂 Fallback embedding models of the search queries", "model", config.EmbeddingModel,
+			"fallbacks", config.FallbackEmbeddingModels)
+	}
 
-	// EMBEDDING AGENT: Create an embedding agent to generate embeddings
-	var err error
-	embeddingAgent, err = mu.NewAgent(ctx, "vector-agent",
-		mu.WithClient(client),
-		mu.WithEmbeddingParams(
-			openai.EmbeddingNewParams{
-				Model: embeddingsModel,
-			},
-		),
-	)
+	// Fail fast, before binding the port, on an invalid configuration
+	// or an unreachable embedding backend
 	if err != nil {
-		fmt.Println("🔶 Error creating embedding agent", err)
-		panic(err)
+		for _, problem := range splitErrors(err) {
+			slog.Error("😡 Invalid configuration", "problem", problem)
+		}
 	}
 
-	// -------------------------------------------------
-	// Create a vector store
-	// -------------------------------------------------
-	store = rag.MemoryVectorStore{
-		Records: make(map[string]rag.VectorRecord),
+	// DRY RUN: Only chunk the content files, to tune the chunking,
+	// without calling the embedding backend
+	if config.DryRun {
+		if err != nil {
+			fatal("😡 Startup validation failed, exiting")
+		}
+		if err := dryRun(os.Stdout, config.Delimiter); err != nil {
+			fatal("😡 Dry run failed", "error", err)
+		}
+		return
 	}
 
-	// Load the vector store from a file if it exists
-	err = store.Load(jsonStoreFilePath)
+	if _, probeErr := embedder.GenerateEmbeddingVector(ctx, "probe"); probeErr != nil {
+		slog.Error("😡 The embedding backend doesn't respond", "base_url", config.ModelRunnerBaseURL, "model", config.EmbeddingModel, "error", probeErr)
+		err = errors.Join(err, probeErr)
+	}
 	if err != nil {
-		if os.IsNotExist(err) {
-			log.Println("🚀 No existing vector store found, starting fresh.")
-
-			// =================================================
-			// CHUNKS:
-			// =================================================
-			contents, err := helpers.GetContentFiles(".", ".md")
-			if err != nil {
-				log.Fatalln("😡 Error getting content files:", err)
-			}
-			chunks := []string{}
-			fmt.Println("💡 Found", len(contents), "content files to process.")
-			//fmt.Println("📂 Processing content files...", contents)
-			fmt.Println("📝 Processing(Chunking) content files...")
-
-			for _, content := range contents {
-				// Determine appropriate delimiter based on min/max constraints
-				fmt.Println("📏 Using delimiter:", delimiter, "(length:", len(delimiter), ")")
-				chunks = append(chunks, rag.SplitTextWithDelimiter(content, delimiter)...)
-			}
-
-			// -------------------------------------------------
-			// Create and save the embeddings from the chunks
-			// -------------------------------------------------
-			fmt.Println("⏳ Creating the embeddings...")
-
-			for idx, chunk := range chunks {
-
-				fmt.Println("🔶 Chunk", idx, ":", chunk)
-				embeddingVector, err := embeddingAgent.GenerateEmbeddingVector(chunk)
-
-				if err != nil {
-					fmt.Println(err)
-					fmt.Println(chunk)
-				} else {
-					_, errSave := store.Save(rag.VectorRecord{
-						Prompt:    chunk,
-						Embedding: embeddingVector,
-					})
-					if errSave != nil {
-						fmt.Println("😡:", errSave)
-					}
-					fmt.Println("✅ Chunk", idx, "saved with embedding:", len(embeddingVector))
-				}
-			}
-
-			fmt.Println("✋", "Embeddings created, total of records", len(store.Records))
-			err = store.Persist(jsonStoreFilePath)
-			if err != nil {
-				log.Fatalln("😡 Error saving vector store:", err)
-			}
-			fmt.Println("✅ Vector store saved to", jsonStoreFilePath)
-			fmt.Println("💾 Vector store initialized with", len(store.Records), "records.")
-			fmt.Println()
+		fatal("😡 Startup validation failed, exiting")
+	}
 
-		} else {
-			log.Fatalln("Error loading vector store:", err)
+	// RATE LIMITER: Protect the embedding backend from the bursts of requests
+	embeddingLimiter = newRateLimiter(config.EmbeddingMaxRPS, config.EmbeddingBurst, config.EmbeddingQueueTimeout)
+	if embeddingLimiter != nil {
+		slog.Info("🚦 Embedding rate limit enabled", "max_rps", config.EmbeddingMaxRPS, "burst", config.EmbeddingBurst,
+			"queue_timeout", config.EmbeddingQueueTimeout)
+	}
+
+	// QUERY CACHE: Reuse the embeddings of repeated search queries
+	queryEmbeddings = newQueryCache(config.QueryCacheSize)
+	searchResults = newResultCache(config.ResultCacheSize, config.ResultCacheTTL)
+
+	// QUERY LOG: Record the search queries for analytics
+	queries = newQueryLog(config.QueryLogPath)
+
+	// FEEDBACK LOG: Record whether the search results were helpful
+	feedback = newFeedbackLog(config.FeedbackLogPath)
+
+	// RERANKER: Optionally rerank the search candidates with a chat model
+	if config.RerankEnabled {
+		reranker = newLLMReranker(client, config.RerankModel, config.EmbeddingTimeout)
+		slog.Info("🏅 Reranking enabled", "model", config.RerankModel)
+	}
+
+	// QUERY EXPANSION: Optionally search paraphrases of the queries too
+	if config.QueryExpansion {
+		expander = newLLMQueryExpander(client, config.QueryExpansionModel, config.EmbeddingTimeout, config.QueryExpansionVariants)
+		slog.Info("🔀 Query expansion enabled", "model", config.QueryExpansionModel, "variants", config.QueryExpansionVariants)
+	}
+
+	// SOURCE BOOSTS: Rank the trusted sources higher at equal similarity
+	for _, boost := range config.SourceBoosts {
+		slog.Info("🏷️ Source boost", "glob", boost.glob, "multiplier", boost.multiplier)
+	}
+
+	// -------------------------------------------------
+	// Create a vector store
+	// -------------------------------------------------
+	switch config.StoreBackend {
+	case storeBackendSQLite:
+		sqliteStore, err := NewSQLiteSnippetStore(config.StoreFilePath(), config.VectorQuantization)
+		if err != nil {
+			fatal("😡 Error opening the SQLite vector store", "path", config.StoreFilePath(), "error", err)
 		}
-	} else {
-		log.Println("Vector store loaded successfully, total records:", len(store.Records))
+		defer sqliteStore.Close()
+		store = sqliteStore
+	default:
+		snippetStore := NewSnippetStore(config.CompressStore, config.StoreBackup, config.StorePretty, config.VectorQuantization)
+		if config.ANNEnabled {
+			slog.Info("🧭 Approximate nearest neighbors search enabled", "min_records", config.ANNMinRecords, "ef_search", config.ANNEfSearch)
+			snippetStore.EnableANN(hnswParams{M: config.ANNM, EfConstruction: config.ANNEfConstruction, EfSearch: config.ANNEfSearch}, config.ANNMinRecords)
+		}
+		store = snippetStore
+	}
+	slog.Info("🗄️ Vector store backend", "backend", config.StoreBackend, "path", config.StoreFilePath())
+	for _, contentDir := range config.ContentDirs {
+		absoluteDir, _ := filepath.Abs(contentDir)
+		slog.Info("📂 Content directory", "path", absoluteDir)
+	}
+	for _, archivePath := range config.ContentArchives {
+		absolutePath, _ := filepath.Abs(archivePath)
+		slog.Info("🗜️ Content archive", "path", absolutePath)
 	}
 
 	// =================================================
 	// TOOLS:
 	// =================================================
+	if config.ReadOnly {
+		slog.Info("🔏 Read-only mode: the tools modifying the vector store are not registered, and the store is never written")
+	}
 	searchInDoc := mcp.NewTool("search_snippet",
 		mcp.WithDescription(`Find one or more snippets related to the topic.`),
 		mcp.WithString("topic",
 			mcp.Required(),
 			mcp.Description("Search topic or question to find relevant snippets."),
 		),
+		mcp.WithString("model",
+			mcp.Description("Embedding model of the topic, the configured model by default. It must create vectors of the dimension of the stored vectors."),
+		),
+		mcp.WithString("source_filter",
+			mcp.Description("Glob restricting the search to the snippets of the matching source files, e.g. docs/http*.md or **/go.md; a glob without a slash matches the file name. All the sources are searched by default."),
+		),
+		mcp.WithString("format",
+			mcp.Description("Format of the results: text (the default), json (the snippets with their metadata) or markdown (a numbered list of the snippets, the code fenced, for the clients rendering markdown)."),
+			mcp.Enum(resultFormatText, resultFormatJSON, resultFormatMarkdown),
+		),
+		mcp.WithNumber("min_length",
+			mcp.Description("Minimum length of the snippets in characters, e.g. to skip the one-line fragments; the shorter snippets are excluded before the ranking. No minimum by default."),
+		),
+		mcp.WithNumber("max_length",
+			mcp.Description("Maximum length of the snippets in characters, e.g. for quick-reference lookups; the longer snippets are excluded before the ranking. No maximum by default."),
+		),
+		mcp.WithBoolean("include_embeddings",
+			mcp.Description("Include the stored embedding of each snippet in the results, e.g. for a client-side reranker (json format only). The vectors make the response much larger."),
+		),
+		mcp.WithBoolean("verbose",
+			mcp.Description("Annotate each snippet with its source, its chunk_index among the chunks of its source, its offset_range and its unrounded score, followed by its whole text, to debug the chunking and the retrieval (text and json formats)."),
+		),
+		mcp.WithArray("exclude_sources",
+			mcp.Description("Globs of the source files whose snippets are excluded from the search, matched like source_filter, e.g. reference/**; they win over source_filter."),
+			mcp.WithStringItems(),
+		),
 	)
 	s.AddTool(searchInDoc, searchInDocHandler)
 
-	// Start the HTTP server
-	httpPort := os.Getenv("MCP_HTTP_PORT")
-	fmt.Println("🌍 MCP HTTP Port:", httpPort)
-	if httpPort == "" {
-		httpPort = "9090"
-	}
+	searchInDocBatch := mcp.NewTool("search_snippets_batch",
+		mcp.WithDescription(`Find snippets related to each topic of a list of topics, results are grouped per topic.`),
+		mcp.WithArray("topics",
+			mcp.Required(),
+			mcp.Description("Search topics or questions to find relevant snippets."),
+			mcp.WithStringItems(),
+		),
+		mcp.WithBoolean("dedupe",
+			mcp.Description("Return a snippet only once, for the first topic it matches."),
+		),
+	)
+	s.AddTool(searchInDocBatch, searchInDocBatchHandler)
 
-	log.Println("MCP StreamableHTTP server is running on port", httpPort)
+	searchByVector := mcp.NewTool("search_by_vector",
+		mcp.WithDescription(`Find the snippets similar to a query vector already embedded by the client, with the embedding model of the store.`),
+		mcp.WithArray("vector",
+			mcp.Required(),
+			mcp.Description("Embedding of the query, it must have the dimension of the stored vectors."),
+			mcp.WithNumberItems(),
+		),
+	)
+	s.AddTool(searchByVector, searchByVectorHandler)
 
-	// Create a custom mux to handle both MCP and health endpoints
-	mux := http.NewServeMux()
+	similarToSnippet := mcp.NewTool("similar_to_snippet",
+		mcp.WithDescription(`Find the snippets similar to a snippet already found ("more like this"), from its stored embedding, without embedding a topic. The snippet itself is not returned.`),
+		mcp.WithString("id",
+			mcp.Required(),
+			mcp.Description("ID of the snippet, from the _meta of a search result or its snippet:// URI."),
+		),
+	)
+	s.AddTool(similarToSnippet, similarToSnippetHandler)
 
-	// Add healthcheck endpoint
-	mux.HandleFunc("/health", healthCheckHandler)
+	getSource := mcp.NewTool("get_source",
+		mcp.WithDescription(`Read the whole content file a snippet comes from, when the snippet is too narrow, from the ID of the snippet or its source. Only the indexed files of the content directories and archives can be read.`),
+		mcp.WithString("id",
+			mcp.Description("ID of the snippet, from the _meta of a search result or its snippet:// URI."),
+		),
+		mcp.WithString("source",
+			mcp.Description("Source of a snippet, like snippets/go.md, instead of its ID."),
+		),
+	)
+	s.AddTool(getSource, getSourceHandler)
 
-	// Add MCP endpoint
-	httpServer := server.NewStreamableHTTPServer(s,
-		server.WithEndpointPath("/mcp"),
+	toggleSnippet := mcp.NewTool("toggle_snippet",
+		mcp.WithDescription(`Disable a snippet, excluding it from the searches without deleting it (e.g. a document under revision), or enable it again. The state is persisted.`),
+		mcp.WithString("id",
+			mcp.Required(),
+			mcp.Description("ID of the snippet, from the _meta of a search result or its snippet:// URI."),
+		),
+		mcp.WithBoolean("disabled",
+			mcp.Description("Whether the snippet is disabled; by default its state is flipped."),
+		),
 	)
+	addWriteTool(s, toggleSnippet, toggleSnippetHandler)
 
-	// Register MCP handler with the mux
-	mux.Handle("/mcp", httpServer)
+	storeStats := mcp.NewTool("store_stats",
+		mcp.WithDescription(`Get statistics about the snippets vector store: number of records, embedding model and dimension, number of source files, distribution of the chunk lengths (min, max, mean, p50, p95 in characters) and store file size.`),
+	)
+	s.AddTool(storeStats, storeStatsHandler(config.StoreFilePath()))
 
-	// Start the HTTP server with custom mux
-	log.Fatal(http.ListenAndServe(":"+httpPort, mux))
-}
+	reloadStore := mcp.NewTool("reload_store",
+		mcp.WithDescription(`Reload the vector store from its file, after it was edited or persisted by another process. Returns the new number of records, the current records are kept when the file can't be loaded.`),
+	)
+	s.AddTool(reloadStore, reloadStoreHandler(s, config.StoreFilePath()))
 
-func searchInDocHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	reindex := mcp.NewTool("reindex",
+		mcp.WithDescription(`Update the vector store with the changes of the content files: index the new files, reindex the files modified since they were indexed and remove the chunks of the deleted files. Returns the number of added, updated, removed and unchanged files.`),
+	)
+	addWriteTool(s, reindex, reindexHandler(s, config.StoreFilePath()))
+
+	if config.AllowReset {
+		resetStore := mcp.NewTool("reset_store",
+			mcp.WithDescription(`Remove all the records of the vector store and persist the empty store, e.g. to start over during development. Returns the number of removed records.`),
+			mcp.WithBoolean("confirm",
+				mcp.Required(),
+				mcp.Description("Must be true, to confirm the removal of all the records."),
+			),
+		)
+		addWriteTool(s, resetStore, resetStoreHandler(s, config.StoreFilePath()))
+	}
 
-	args := request.GetArguments()
-	topicArg, exists := args["topic"]
-	if !exists || topicArg == nil {
-		return nil, fmt.Errorf("missing required parameter 'topic'")
+	if queries != nil {
+		queryStats := mcp.NewTool("query_stats",
+			mcp.WithDescription(`Summarize the logged search queries: the most frequent ones, and the fraction and most frequent ones without results.`),
+			mcp.WithNumber("top",
+				mcp.Description("Number of most frequent queries to list, 10 by default."),
+			),
+		)
+		s.AddTool(queryStats, queryStatsHandler)
 	}
-	userQuestion, ok := topicArg.(string)
-	if !ok {
-		return nil, fmt.Errorf("parameter 'topic' must be a string")
+
+	if feedback != nil {
+		rateResult := mcp.NewTool("rate_result",
+			mcp.WithDescription(`Report whether a snippet returned for a query was helpful, to help improve the retrieval. The feedback is only recorded.`),
+			mcp.WithString("query",
+				mcp.Required(),
+				mcp.Description("Search topic or question the snippet was returned for."),
+			),
+			mcp.WithString("snippet_id",
+				mcp.Required(),
+				mcp.Description("ID of the snippet, as in its snippet:// resource URI."),
+			),
+			mcp.WithBoolean("helpful",
+				mcp.Required(),
+				mcp.Description("Whether the snippet was helpful."),
+			),
+			mcp.WithNumber("score",
+				mcp.Description("Optional usefulness score, between 0 and 1."),
+			),
+		)
+		s.AddTool(rateResult, rateResultHandler)
 	}
 
-	fmt.Println("🔍 Searching for question:", userQuestion)
+	importURL := mcp.NewTool("import_url",
+		mcp.WithDescription(`Fetch a URL (a wiki page, a raw file...), then chunk, embed and store its content with the URL as source. Returns the number of chunks imported.`),
+		mcp.WithString("url",
+			mcp.Required(),
+			mcp.Description("HTTP or HTTPS URL of the content to import, HTML pages are converted to text."),
+		),
+		mcp.WithString("expires_at",
+			mcp.Description("Optional expiration date of the imported snippets, like 2025-06-30 or 2025-06-30T18:00:00Z: they are no more searched from this date, and then removed. They never expire by default."),
+		),
+	)
+	addWriteTool(s, importURL, importURLHandler(s))
 
-	// -------------------------------------------------
-	// Search for similarities
-	// -------------------------------------------------
+	addSnippetsBulk := mcp.NewTool("add_snippets_bulk",
+		mcp.WithDescription(`Add several documents at once: each document is chunked, embedded (by batches) and stored with its source and tags, then the store is persisted once. Documents added again with the same source replace the previous ones. Returns the number of chunks added per document and in total.`),
+		mcp.WithArray("documents",
+			mcp.Required(),
+			mcp.Description("Documents to add, each with its content, its source (a name or path identifying it) and optional tags."),
+			mcp.Items(map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"content": map[string]any{"type": "string", "description": "Text of the document, chunked like a content file."},
+					"source":  map[string]any{"type": "string", "description": "Source of the document, like docs/http.md."},
+					"tags":    map[string]any{"type": "array", "items": map[string]any{"type": "string"}, "description": "Tags of the snippets of the document."},
+				},
+				"required": []string{"content", "source"},
+			}),
+		),
+	)
+	addWriteTool(s, addSnippetsBulk, addSnippetsBulkHandler(s))
 
-	fmt.Println("⏳ Searching for similarities...")
+	previewChunks := mcp.NewTool("preview_chunks",
+		mcp.WithDescription(`Preview how a content would be chunked with the current chunking settings, without embedding nor storing anything, e.g. to tune the chunking before adding documents. Returns the chunks with their titles and lengths.`),
+		mcp.WithString("content",
+			mcp.Required(),
+			mcp.Description("Text to chunk, like the content of a file."),
+		),
+		mcp.WithString("source",
+			mcp.Description("Name of the content, like docs/http.md: its extension selects the delimiter (DELIMITER_<EXT>) and the conversion (HTML). preview.md by default."),
+		),
+	)
+	s.AddTool(previewChunks, previewChunksHandler)
 
-	// -------------------------------------------------
-	// Create embedding from the user question
-	// -------------------------------------------------
-	questionEmbeddingVector, err := embeddingAgent.GenerateEmbeddingVector(userQuestion)
-	if err != nil {
-		log.Fatal("😡:", err)
-	}
-	// -------------------------------------------------
-	// Create a vector record from the user embedding
-	// -------------------------------------------------
-	questionRecord := rag.VectorRecord{Embedding: questionEmbeddingVector}
+	// =================================================
+	// PROMPTS:
+	// =================================================
+	answerWithSnippets := mcp.NewPrompt("answer_with_snippets",
+		mcp.WithPromptDescription(`Answer a question using the snippets related to it as context.`),
+		mcp.WithArgument("question",
+			mcp.RequiredArgument(),
+			mcp.ArgumentDescription("Question to answer from the snippets."),
+		),
+	)
+	s.AddPrompt(answerWithSnippets, answerWithSnippetsHandler)
 
-	threshold := helpers.StringToFloat(helpers.GetEnvOrDefault("LIMIT", "0.6"))
-	topN := helpers.StringToInt(helpers.GetEnvOrDefault("MAX_RESULTS", "2"))
+	// Start the HTTP server
+	slog.Info("🌍 MCP StreamableHTTP server is running", "port", config.HTTPPort)
 
-	similarities, err := store.SearchTopNSimilarities(questionRecord, threshold, topN)
-	if err != nil {
-		log.Fatal("😡:", err)
-	}
+	// Create a custom mux to handle both MCP and health endpoints
+	mux := http.NewServeMux()
 
-	documentsContent := "Documents:\n"
+	// Add liveness and readiness endpoints
+	mux.HandleFunc("/livez", livenessHandler)
+	mux.HandleFunc("/readyz", healthCheckHandler)
+	mux.HandleFunc("/health", healthCheckHandler)
 
-	for _, similarity := range similarities {
-		fmt.Println("✅ CosineSimilarity:", similarity.CosineSimilarity, "Chunk:", similarity.Prompt)
-		documentsContent += similarity.Prompt
-	}
-	documentsContent += "\n"
-	fmt.Println("✋", "Similarities found, total of records", len(similarities))
-	fmt.Println()
+	// Add Prometheus metrics endpoint
+	mux.Handle("/metrics", promhttp.Handler())
 
-	return mcp.NewToolResultText(documentsContent), nil
-}
+	// Add MCP endpoint
+	httpServer := server.NewStreamableHTTPServer(s,
+		server.WithEndpointPath("/mcp"),
+	)
 
-func healthCheckHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
+	// Register MCP handler with the mux,
+	// protected by a bearer token when MCP_AUTH_TOKEN is set.
+	if config.AuthToken != "" {
+		slog.Info("🔒 Bearer token authentication enabled on the MCP endpoint")
+	}
+	// CORS headers are added for browser-based clients when CORS_ALLOWED_ORIGINS is set
+	if len(config.CORSAllowedOrigins) > 0 {
+		slog.Info("🌐 CORS enabled on the MCP endpoint", "allowed_origins", config.CORSAllowedOrigins)
+	}
+	mux.Handle("/mcp", corsMiddleware(config.CORSAllowedOrigins, bearerAuthMiddleware(config.AuthToken, httpServer)))
+
+	// Reindex endpoint for the automation not speaking MCP, protected by the same token
+	if !config.ReadOnly {
+		mux.Handle("/reindex", bearerAuthMiddleware(config.AuthToken, reindexHTTPHandler(s, config.StoreFilePath())))
+	}
 
-	// Check if vector store is initialized and has records
-	if len(store.Records) == 0 {
-		w.WriteHeader(http.StatusServiceUnavailable)
-		response := map[string]interface{}{
-			"status": "unhealthy",
-			"reason": "vector store not initialized",
+	// Load or build the vector store in the background:
+	// the readiness endpoints report "initializing" until it is done,
+	// including the optional warm-up of the embedding model,
+	// then each snippet is exposed as a resource
+	go func() {
+		if config.WarmupEmbedding {
+			warmUpEmbedding(ctx)
 		}
-		json.NewEncoder(w).Encode(response)
-		return
+		initializeStore(ctx, config.StoreFilePath(), config.Delimiter, config.OnModelMismatch)
+		registerSnippetResources(s)
+	}()
+
+	// Periodically write the store to disk when it changed
+	if config.PersistInterval > 0 && !config.ReadOnly {
+		slog.Info("💾 Periodic persistence enabled", "interval", config.PersistInterval)
+		go startPeriodicPersistence(ctx, config.StoreFilePath(), config.PersistInterval)
+	}
+
+	// Periodically remove the expired records, a read-only server only skips them
+	if config.ExpirySweepInterval > 0 && !config.ReadOnly {
+		go startExpirySweep(ctx, s, config.StoreFilePath(), config.ExpirySweepInterval)
 	}
 
-	w.WriteHeader(http.StatusOK)
-	response := map[string]any{
-		"status":           "healthy",
-		"records":          len(store.Records),
-		"embeddings_model": embeddingsModel,
+	// Start the HTTP server with custom mux
+	webServer := &http.Server{
+		Addr:    ":" + config.HTTPPort,
+		Handler: mux,
+	}
+	// Serve HTTPS when a certificate and its key are provided
+	go func() {
+		var err error
+		if config.TLSCertFile != "" {
+			slog.Info("🔐 TLS enabled", "cert_file", config.TLSCertFile)
+			err = webServer.ListenAndServeTLS(config.TLSCertFile, config.TLSKeyFile)
+		} else {
+			err = webServer.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			fatal("😡 HTTP server stopped", "error", err)
+		}
+	}()
+
+	// Graceful shutdown: stop accepting requests, then flush the store
+	<-ctx.Done()
+	slog.Info("🛑 Shutting down...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := webServer.Shutdown(shutdownCtx); err != nil {
+		slog.Error("😡 Error shutting down the HTTP server", "error", err)
 	}
-	json.NewEncoder(w).Encode(response)
+	flushStore(config.StoreFilePath())
 }
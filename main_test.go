@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/micro-agent/micro-agent-go/agent/rag"
+)
+
+// fakeEmbedder embeds the texts with a function instead of a model backend
+type fakeEmbedder func(ctx context.Context, content string) ([]float64, error)
+
+func (f fakeEmbedder) GenerateEmbeddingVector(ctx context.Context, content string) ([]float64, error) {
+	return f(ctx, content)
+}
+
+// setupServer installs the state of the tool handlers for a test: the
+// default configuration, with the given environment variables, an empty
+// ready JSON store and an embedder calling embed. The previous state is
+// restored at the end of the test.
+func setupServer(t *testing.T, embed fakeEmbedder, env map[string]string) *SnippetStore {
+	t.Helper()
+	t.Setenv("CONTENT_DIR", t.TempDir())
+	for name, value := range env {
+		t.Setenv(name, value)
+	}
+	testConfig, err := loadConfig(nil)
+	if err != nil {
+		t.Fatalf("invalid test configuration: %v", err)
+	}
+
+	previousConfig, previousStore, previousEmbedder := config, store, embedder
+	previousQueryEmbeddings, previousSearchResults := queryEmbeddings, searchResults
+	previousState := storeState.Load()
+	t.Cleanup(func() {
+		config, store, embedder = previousConfig, previousStore, previousEmbedder
+		queryEmbeddings, searchResults = previousQueryEmbeddings, previousSearchResults
+		if previousState != nil {
+			storeState.Store(previousState)
+		}
+	})
+
+	config = testConfig
+	snippetStore := NewSnippetStore(false, false, false, config.VectorQuantization)
+	store = snippetStore
+	embedder = newEmbeddingModel("test-model", func(string) Embedder { return embed })
+	queryEmbeddings = newQueryCache(config.QueryCacheSize)
+	searchResults = newResultCache(config.ResultCacheSize, config.ResultCacheTTL)
+	setStoreState(stateReady)
+	return snippetStore
+}
+
+// toolRequest creates the request of a tool call with its arguments
+func toolRequest(name string, arguments map[string]any) mcp.CallToolRequest {
+	return mcp.CallToolRequest{Params: mcp.CallToolParams{Name: name, Arguments: arguments}}
+}
+
+// testRecord creates a record of a chunk and its embedding
+func testRecord(id string, source string, prompt string, embedding ...float64) SnippetRecord {
+	return SnippetRecord{
+		VectorRecord: rag.VectorRecord{Id: id, Prompt: prompt, Embedding: embedding},
+		Source:       source,
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"slices"
+	"sort"
+)
+
+// mergeOverlapping stitches the results of a same source whose chunks
+// overlap (with CHUNK_OVERLAP) or follow each other into a single passage,
+// without the repeated text, when MERGE_RESULTS is set. A passage takes the
+// place, the ID and the score of its best ranked chunk. The results without
+// positions (e.g. converted HTML content) are kept as they are.
+func mergeOverlapping(similarities []SnippetRecord) []SnippetRecord {
+	if !config.MergeResults || len(similarities) < 2 {
+		return similarities
+	}
+
+	// passage is a merged result with the rank of its best ranked chunk
+	type passage struct {
+		record SnippetRecord
+		rank   int
+	}
+	passages := []passage{}
+	bySource := map[string][]passage{}
+	for rank, similarity := range similarities {
+		if similarity.EndOffset <= similarity.StartOffset {
+			passages = append(passages, passage{record: similarity, rank: rank})
+			continue
+		}
+		bySource[similarity.Source] = append(bySource[similarity.Source], passage{record: similarity, rank: rank})
+	}
+
+	for _, chunks := range bySource {
+		sort.Slice(chunks, func(i, j int) bool {
+			return chunks[i].record.StartOffset < chunks[j].record.StartOffset
+		})
+		current := chunks[0]
+		for _, next := range chunks[1:] {
+			if next.record.StartOffset > current.record.EndOffset {
+				passages = append(passages, current)
+				current = next
+				continue
+			}
+			best := current
+			if next.rank < current.rank {
+				best = next
+			}
+			merged := stitchChunks(current.record, next.record)
+			merged.Id, merged.CosineSimilarity = best.record.Id, best.record.CosineSimilarity
+			merged.SourceBoost = best.record.SourceBoost
+			current = passage{record: merged, rank: best.rank}
+		}
+		passages = append(passages, current)
+	}
+
+	slices.SortFunc(passages, func(a, b passage) int {
+		return a.rank - b.rank
+	})
+	merged := make([]SnippetRecord, 0, len(passages))
+	for _, passage := range passages {
+		merged = append(merged, passage.record)
+	}
+	return merged
+}
+
+// stitchChunks joins two chunks of a source, the second one starting inside
+// or right after the first one, dropping the text they share
+func stitchChunks(first SnippetRecord, second SnippetRecord) SnippetRecord {
+	if second.EndOffset <= first.EndOffset {
+		return first
+	}
+	shared := first.EndOffset - second.StartOffset
+	if shared > len(second.Prompt) {
+		return first
+	}
+	first.Prompt += second.Prompt[shared:]
+	first.EndOffset = second.EndOffset
+	first.EndLine = max(first.EndLine, second.EndLine)
+	return first
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Embedding phases used as metric label values
+const (
+	phaseIndex = "index"
+	phaseQuery = "query"
+)
+
+var (
+	searchRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "mcp_snippets_search_requests_total",
+		Help: "Number of search_snippet calls, by status (ok, error, cancelled or rate_limited).",
+	}, []string{"status"})
+
+	searchDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "mcp_snippets_search_duration_seconds",
+		Help:    "Latency of search_snippet calls, embedding included.",
+		Buckets: prometheus.DefBuckets,
+	})
+
+	embeddingDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "mcp_snippets_embedding_duration_seconds",
+		Help:    "Latency of embedding generation, by phase (index or query).",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"phase"})
+
+	embeddingErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "mcp_snippets_embedding_errors_total",
+		Help: "Number of failed embedding generations, by phase (index or query).",
+	}, []string{"phase"})
+
+	queryCacheRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "mcp_snippets_query_cache_requests_total",
+		Help: "Number of lookups in the query embedding cache, by result (hit or miss).",
+	}, []string{"result"})
+
+	_ = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "mcp_snippets_query_cache_entries",
+		Help: "Number of query embeddings in the cache.",
+	}, func() float64 {
+		return float64(queryEmbeddings.Len())
+	})
+
+	resultCacheRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "mcp_snippets_result_cache_requests_total",
+		Help: "Number of lookups in the search result cache, by result (hit or miss).",
+	}, []string{"result"})
+
+	_ = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "mcp_snippets_store_records",
+		Help: "Number of records in the vector store.",
+	}, func() float64 {
+		if store == nil {
+			return 0
+		}
+		return float64(store.Count())
+	})
+)
+
+// observeEmbedding records the latency and the outcome of an embedding generation
+func observeEmbedding(phase string, start time.Time, err error) {
+	embeddingDuration.WithLabelValues(phase).Observe(time.Since(start).Seconds())
+	if err != nil {
+		embeddingErrorsTotal.WithLabelValues(phase).Inc()
+	}
+}
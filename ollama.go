@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ollamaEmbedder generates embedding vectors through the native embedding
+// API of Ollama (POST /api/embed), for EMBEDDING_PROVIDER=ollama
+type ollamaEmbedder struct {
+	url     string
+	headers map[string]string
+	model   string
+	timeout time.Duration
+}
+
+// newOllamaEmbedder creates an embedder for the given model of the Ollama
+// server at baseURL, whose /v1 path of the OpenAI-compatible API (used by the
+// reranking and the query expansion) is dropped, sending the extra headers
+// with each request; a timeout of 0 means the embedding calls have no deadline.
+func newOllamaEmbedder(baseURL string, headers map[string]string, model string, timeout time.Duration) *ollamaEmbedder {
+	return &ollamaEmbedder{
+		url:     strings.TrimSuffix(strings.TrimSuffix(baseURL, "/"), "/v1") + "/api/embed",
+		headers: headers,
+		model:   model,
+		timeout: timeout,
+	}
+}
+
+// GenerateEmbeddingVector creates the embedding of content
+func (e *ollamaEmbedder) GenerateEmbeddingVector(ctx context.Context, content string) ([]float64, error) {
+	vectors, err := e.GenerateEmbeddingVectors(ctx, []string{content})
+	if err != nil {
+		return nil, err
+	}
+	return vectors[0], nil
+}
+
+// GenerateEmbeddingVectors creates the embeddings of several contents with a
+// single request, in the order of the contents. The call is cancelled when
+// ctx is done or when the embedder timeout is exceeded.
+func (e *ollamaEmbedder) GenerateEmbeddingVectors(ctx context.Context, contents []string) ([][]float64, error) {
+	if e.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.timeout)
+		defer cancel()
+	}
+
+	body, err := json.Marshal(map[string]any{
+		"model": e.model,
+		"input": contents,
+	})
+	if err != nil {
+		return nil, err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	for name, value := range e.headers {
+		request.Header.Set(name, value)
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(response.Body, 512))
+		return nil, fmt.Errorf("embedding request failed: HTTP status %s: %s", response.Status, strings.TrimSpace(string(message)))
+	}
+	var result struct {
+		Embeddings [][]float64 `json:"embeddings"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("invalid embedding response: %w", err)
+	}
+	if len(result.Embeddings) != len(contents) {
+		return nil, fmt.Errorf("%d embeddings received for %d contents", len(result.Embeddings), len(contents))
+	}
+	return result.Embeddings, nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// backupSuffix is appended to the path of the store file to name its backup
+const backupSuffix = ".bak"
+
+// startPeriodicPersistence writes the store to storeFilePath every interval,
+// skipping the write when nothing changed since the last one.
+// It returns when ctx is done.
+func startPeriodicPersistence(ctx context.Context, storeFilePath string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			flushStore(storeFilePath)
+		}
+	}
+}
+
+// flushStore persists the store if it changed. A store that is still being
+// initialized is never written, so a partial index can't replace a good one,
+// and neither is the store of a read-only server (READ_ONLY).
+func flushStore(storeFilePath string) {
+	if !isStoreReady() || config.ReadOnly {
+		return
+	}
+	written, err := store.PersistIfDirty(storeFilePath)
+	if err != nil {
+		slog.Error("😡 Error persisting vector store", "path", storeFilePath, "error", err)
+		return
+	}
+	if written {
+		slog.Info("💾 Vector store persisted", "path", storeFilePath, "records", store.Count())
+	}
+}
+
+// writeFileAtomic writes data to a temporary file next to path, then renames
+// it over path, so path is never left partially written. With backup, the
+// previous file at path is kept at path.bak.
+func writeFileAtomic(path string, data []byte, backup bool) error {
+	tmpPath := path + ".tmp"
+	tmpFile, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = tmpFile.Write(data)
+	if err == nil {
+		err = tmpFile.Sync()
+	}
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if backup {
+		if err := backupFile(path); err != nil {
+			slog.Warn("🔶 Unable to back up the store file", "path", path, "error", err)
+		}
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+// backupFile links (or copies) the file at path to path.bak,
+// replacing the previous backup; a missing file has no backup
+func backupFile(path string) error {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+	backupPath := path + backupSuffix
+	if err := os.Remove(backupPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Link(path, backupPath); err == nil {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(backupPath, data, 0644)
+}
+
+// loadStoreBackup loads the backup of the store file when the store file
+// can't be loaded (loadErr); it returns loadErr when the backup can't be
+// loaded either. The unreadable store file is renamed with a .corrupt suffix
+// and replaced by the backup, which is kept.
+func loadStoreBackup(storeFilePath string, loadErr error) error {
+	backupPath := storeFilePath + backupSuffix
+	if err := store.Load(backupPath); err != nil {
+		if os.IsNotExist(err) {
+			return loadErr
+		}
+		return errors.Join(loadErr, fmt.Errorf("failed to load the backup %s: %w", backupPath, err))
+	}
+	slog.Warn("🩹 The vector store can't be loaded, its backup was loaded instead",
+		"path", storeFilePath, "backup", backupPath, "error", loadErr)
+	if err := os.Rename(storeFilePath, storeFilePath+".corrupt"); err != nil {
+		slog.Error("😡 Error moving the unreadable vector store aside", "path", storeFilePath, "error", err)
+		return nil
+	}
+	if err := store.Persist(storeFilePath); err != nil {
+		slog.Error("😡 Error restoring the vector store from its backup", "path", storeFilePath, "error", err)
+	}
+	return nil
+}
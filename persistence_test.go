@@ -0,0 +1,116 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// persistedStore writes a store of the given records to a new store file
+func persistedStore(t *testing.T, records ...SnippetRecord) (*SnippetStore, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "store.json")
+	snippetStore := NewSnippetStore(false, true, false, quantizationNone)
+	for _, record := range records {
+		snippetStore.Save(record)
+	}
+	if err := snippetStore.Persist(path); err != nil {
+		t.Fatalf("Persist failed: %v", err)
+	}
+	return snippetStore, path
+}
+
+// loadedIDs returns the IDs of the records of a store file
+func loadedIDs(t *testing.T, path string) map[string]bool {
+	t.Helper()
+	loaded := NewSnippetStore(false, false, false, quantizationNone)
+	if err := loaded.Load(path); err != nil {
+		t.Fatalf("Load of %s failed: %v", path, err)
+	}
+	ids := map[string]bool{}
+	for _, record := range loaded.Records() {
+		ids[record.Id] = true
+	}
+	return ids
+}
+
+func TestPersistInterruptedKeepsPreviousStore(t *testing.T) {
+	snippetStore, path := persistedStore(t, testRecord("old", "snippets/go.md", "old chunk", 1, 0))
+
+	// A crash during the write leaves a truncated temporary file
+	snippetStore.Save(testRecord("new", "snippets/go.md", "new chunk", 0, 1))
+	if err := os.WriteFile(path+".tmp", []byte(`{"schema_version": 2, "Records": {"new": {"id`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if ids := loadedIDs(t, path); !ids["old"] || ids["new"] {
+		t.Fatalf("the store file after an interrupted write holds %v, want only the previous record", ids)
+	}
+
+	// The next write replaces the leftover temporary file
+	if err := snippetStore.Persist(path); err != nil {
+		t.Fatalf("Persist after an interrupted write failed: %v", err)
+	}
+	if ids := loadedIDs(t, path); !ids["old"] || !ids["new"] {
+		t.Errorf("the store file holds %v, want the old and the new records", ids)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("the temporary file is left behind: %v", err)
+	}
+}
+
+func TestPersistFailureKeepsPreviousStore(t *testing.T) {
+	snippetStore, path := persistedStore(t, testRecord("old", "snippets/go.md", "old chunk", 1, 0))
+	previous, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The temporary file can't be created
+	snippetStore.Save(testRecord("new", "snippets/go.md", "new chunk", 0, 1))
+	if err := os.Mkdir(path+".tmp", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := snippetStore.Persist(path); err == nil {
+		t.Fatal("Persist succeeded without its temporary file")
+	}
+	current, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(current) != string(previous) {
+		t.Error("the failed write modified the store file")
+	}
+	if written, _ := snippetStore.PersistIfDirty(path); !written {
+		t.Error("the changes of the failed write are no more pending")
+	}
+}
+
+func TestLoadStoreBackupOfTruncatedStore(t *testing.T) {
+	snippetStore, path := persistedStore(t, testRecord("old", "snippets/go.md", "old chunk", 1, 0))
+	// The second write keeps the first one as the backup
+	snippetStore.Save(testRecord("new", "snippets/go.md", "new chunk", 0, 1))
+	if err := snippetStore.Persist(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(`{"schema_version": 2, "Rec`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	setupServer(t, nil, nil)
+	loadErr := store.Load(path)
+	if loadErr == nil {
+		t.Fatal("Load of a truncated store succeeded")
+	}
+	if err := loadStoreBackup(path, loadErr); err != nil {
+		t.Fatalf("loadStoreBackup failed: %v", err)
+	}
+	if _, ok := store.Get("old"); !ok || store.Count() != 1 {
+		t.Errorf("the backup holds %d records, want the record of the first write", store.Count())
+	}
+	if ids := loadedIDs(t, path); !ids["old"] {
+		t.Errorf("the store file restored from the backup holds %v", ids)
+	}
+	if _, err := os.Stat(path + ".corrupt"); err != nil {
+		t.Errorf("the truncated store was not kept aside: %v", err)
+	}
+}
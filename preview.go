@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// previewSource is the source of the previewed content when none is given
+const previewSource = "preview.md"
+
+// previewChunksHandler chunks a content with the current chunking settings,
+// like a content file of the given source (its extension selecting the
+// delimiter and the conversion), without embedding nor storing anything,
+// and returns the chunks with their titles, lengths and lines
+func previewChunksHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	content, err := request.RequireString("content")
+	if err != nil {
+		return nil, fmt.Errorf("missing required parameter 'content'")
+	}
+	source := request.GetString("source", previewSource)
+	delimiter := config.DelimiterFor(source, config.Delimiter)
+
+	chunks, err := archiveFileChunks("", source, []byte(content), time.Now(), delimiter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to chunk the content: %w", err)
+	}
+	// The blank chunks are not indexed
+	chunks = slices.DeleteFunc(chunks, func(chunk SnippetRecord) bool {
+		return strings.TrimSpace(chunk.Prompt) == ""
+	})
+	var preview strings.Builder
+	fmt.Fprintf(&preview, "Chunking: CHUNK_STRATEGY=%s CHUNK_SIZE=%d CHUNK_OVERLAP=%d SENTENCE_SNAP_CHARS=%d DELIMITER=%q\n%d chunks\n",
+		config.ChunkStrategy, config.ChunkSize, config.ChunkOverlap, config.SentenceSnapChars, delimiter, len(chunks))
+	for idx, chunk := range chunks {
+		fmt.Fprintf(&preview, "\n--- Chunk %d: %s (%d chars", idx+1, chunk.Title, utf8.RuneCountInString(chunk.Prompt))
+		if location := recordLocation(chunk); location != "" {
+			fmt.Fprintf(&preview, ", %s", location)
+		}
+		fmt.Fprintf(&preview, ") ---\n%s\n", chunk.Prompt)
+	}
+	return mcp.NewToolResultText(preview.String()), nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// indexProgress counts the embedded chunks of an indexing run and reports
+// the progress every PROGRESS_INTERVAL, and when the run completes
+type indexProgress struct {
+	mutex      sync.Mutex
+	total      int
+	done       int
+	start      time.Time
+	lastReport time.Time
+	// notify, when set, also receives the progress (e.g. MCP progress notifications)
+	notify func(done int, total int, message string)
+}
+
+// newIndexProgress starts the progress reporting of total chunks
+func newIndexProgress(total int, notify func(done int, total int, message string)) *indexProgress {
+	now := time.Now()
+	return &indexProgress{total: total, start: now, lastReport: now, notify: notify}
+}
+
+// Increment counts a processed chunk, and reports the progress when due
+func (p *indexProgress) Increment() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.done++
+	if p.done < p.total && time.Since(p.lastReport) < config.ProgressInterval {
+		return
+	}
+	p.lastReport = time.Now()
+
+	elapsed := time.Since(p.start)
+	percent := 100 * p.done / max(p.total, 1)
+	eta := time.Duration(0)
+	if p.done > 0 {
+		eta = elapsed * time.Duration(p.total-p.done) / time.Duration(p.done)
+	}
+	message := fmt.Sprintf("embedded %d/%d chunks, %d%%, ETA %s", p.done, p.total, percent, eta.Round(time.Second))
+	slog.Info("⏳ Indexing progress", "embedded", p.done, "total", p.total, "percent", percent,
+		"elapsed", elapsed.Round(time.Second), "eta", eta.Round(time.Second))
+	if p.notify != nil {
+		p.notify(p.done, p.total, message)
+	}
+}
+
+// mcpProgressNotifier returns a function sending MCP progress notifications
+// to the client of a tool call, or nil when the client didn't ask for them
+// (no progress token in the request)
+func mcpProgressNotifier(ctx context.Context, request mcp.CallToolRequest) func(done int, total int, message string) {
+	if request.Params.Meta == nil || request.Params.Meta.ProgressToken == nil {
+		return nil
+	}
+	mcpServer := server.ServerFromContext(ctx)
+	if mcpServer == nil {
+		return nil
+	}
+	token := request.Params.Meta.ProgressToken
+	return func(done int, total int, message string) {
+		err := mcpServer.SendNotificationToClient(ctx, "notifications/progress", map[string]any{
+			"progressToken": token,
+			"progress":      done,
+			"total":         total,
+			"message":       message,
+		})
+		if err != nil {
+			slog.Debug("🔶 Unable to send the progress notification", "error", err)
+		}
+	}
+}
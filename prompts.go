@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// answerWithSnippetsInstructions asks the model to answer from the retrieved snippets only
+const answerWithSnippetsInstructions = `Answer the question using only the code snippets below as context.
+If the snippets don't contain the answer, say so instead of making one up.`
+
+// answerWithSnippetsHandler retrieves the snippets related to the question,
+// like search_snippet, and returns the messages of a RAG-style answer
+func answerWithSnippetsHandler(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+	question := request.Params.Arguments["question"]
+	if question == "" {
+		return nil, fmt.Errorf("missing required argument 'question'")
+	}
+
+	if !isStoreReady() {
+		return nil, fmt.Errorf("the vector store is not ready yet, please retry later")
+	}
+
+	slog.Info("💬 Preparing the answer_with_snippets prompt", "question", question)
+	similarities, _, err := retrieveSnippets(ctx, "", question)
+	if err != nil {
+		return nil, err
+	}
+
+	snippets := noSnippetsFoundMessage(config.Limit)
+	if len(similarities) > 0 {
+		// The snippets are context for a model: no highlighting
+		snippets = formatDocuments("", similarities, false)
+	}
+
+	return mcp.NewGetPromptResult(
+		"Answer a question from the related code snippets",
+		[]mcp.PromptMessage{
+			mcp.NewPromptMessage(mcp.RoleUser, mcp.NewTextContent(answerWithSnippetsInstructions+"\n\n"+snippets)),
+			mcp.NewPromptMessage(mcp.RoleUser, mcp.NewTextContent("Question: "+question)),
+		},
+	), nil
+}
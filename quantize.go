@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// Quantizations of the stored vectors (VECTOR_QUANTIZATION)
+const (
+	quantizationNone    = "none"
+	quantizationFloat16 = "float16"
+	quantizationInt8    = "int8"
+)
+
+// quantizeVector encodes a vector with a quantization: little-endian float64
+// components without quantization, little-endian float16 components with
+// float16, and with int8 a little-endian float32 scale followed by the
+// components divided by the scale and rounded to int8, the scale mapping
+// the largest absolute component to 127
+func quantizeVector(vector []float64, quantization string) []byte {
+	switch quantization {
+	case quantizationFloat16:
+		data := make([]byte, 2*len(vector))
+		for i, value := range vector {
+			binary.LittleEndian.PutUint16(data[2*i:], float16Bits(value))
+		}
+		return data
+	case quantizationInt8:
+		maxAbs := 0.0
+		for _, value := range vector {
+			maxAbs = max(maxAbs, math.Abs(value))
+		}
+		scale := float32(maxAbs / 127)
+		data := make([]byte, 4+len(vector))
+		binary.LittleEndian.PutUint32(data, math.Float32bits(scale))
+		if scale == 0 {
+			return data
+		}
+		for i, value := range vector {
+			data[4+i] = byte(int8(max(-127, min(127, math.Round(value/float64(scale))))))
+		}
+		return data
+	}
+	return encodeEmbedding(vector)
+}
+
+// dequantizeVector decodes a vector encoded by quantizeVector
+func dequantizeVector(data []byte, quantization string) ([]float64, error) {
+	switch quantization {
+	case quantizationFloat16:
+		if len(data)%2 != 0 {
+			return nil, fmt.Errorf("a float16 vector of %d bytes is truncated", len(data))
+		}
+		vector := make([]float64, len(data)/2)
+		for i := range vector {
+			vector[i] = float16Value(binary.LittleEndian.Uint16(data[2*i:]))
+		}
+		return vector, nil
+	case quantizationInt8:
+		if len(data) < 4 {
+			return nil, fmt.Errorf("an int8 vector of %d bytes has no scale", len(data))
+		}
+		scale := float64(math.Float32frombits(binary.LittleEndian.Uint32(data)))
+		vector := make([]float64, len(data)-4)
+		for i := range vector {
+			vector[i] = float64(int8(data[4+i])) * scale
+		}
+		return vector, nil
+	}
+	if len(data)%8 != 0 {
+		return nil, fmt.Errorf("a float64 vector of %d bytes is truncated", len(data))
+	}
+	return decodeEmbedding(data), nil
+}
+
+// quantizedDimension returns the dimension of a vector encoded by
+// quantizeVector in size bytes
+func quantizedDimension(size int, quantization string) int {
+	switch quantization {
+	case quantizationFloat16:
+		return size / 2
+	case quantizationInt8:
+		return max(size-4, 0)
+	}
+	return size / 8
+}
+
+// quantizedVector returns the components of a vector once quantized and
+// dequantized, so the vectors searched in memory are the stored ones
+func quantizedVector(vector []float64, quantization string) []float64 {
+	if quantization == quantizationNone || vector == nil {
+		return vector
+	}
+	dequantized, _ := dequantizeVector(quantizeVector(vector, quantization), quantization)
+	return dequantized
+}
+
+// float16Bits converts a value to the nearest IEEE 754 half-precision
+// float, ties to even
+func float16Bits(value float64) uint16 {
+	bits := math.Float64bits(value)
+	sign := uint16(bits>>48) & 0x8000
+	exponent := int(bits>>52&0x7ff) - 1023 + 15
+	mantissa := bits & (1<<52 - 1)
+	switch {
+	case bits>>52&0x7ff == 0x7ff:
+		// Infinity, or NaN
+		if mantissa != 0 {
+			return sign | 0x7e00
+		}
+		return sign | 0x7c00
+	case exponent >= 0x1f:
+		// Too large, rounded to infinity
+		return sign | 0x7c00
+	case exponent <= 0:
+		// Subnormal, or too small and rounded to zero
+		if exponent < -10 {
+			return sign
+		}
+		return sign | roundToEven(mantissa|1<<52, uint(43-exponent))
+	}
+	// The rounding may carry into the exponent, which is still the nearest value
+	return sign | (uint16(exponent)<<10 + roundToEven(mantissa, 42))
+}
+
+// roundToEven shifts a mantissa right, rounding to the nearest, ties to even
+func roundToEven(mantissa uint64, shift uint) uint16 {
+	rounded := mantissa >> shift
+	remainder := mantissa & (1<<shift - 1)
+	halfway := uint64(1) << (shift - 1)
+	if remainder > halfway || (remainder == halfway && rounded&1 == 1) {
+		rounded++
+	}
+	return uint16(rounded)
+}
+
+// float16Value converts an IEEE 754 half-precision float to a float64
+func float16Value(half uint16) float64 {
+	sign := 1.0
+	if half&0x8000 != 0 {
+		sign = -1
+	}
+	exponent := int(half>>10) & 0x1f
+	mantissa := float64(half & 0x3ff)
+	switch exponent {
+	case 0:
+		return sign * math.Ldexp(mantissa, -24)
+	case 0x1f:
+		if mantissa != 0 {
+			return math.NaN()
+		}
+		return sign * math.Inf(1)
+	}
+	return sign * math.Ldexp(1024+mantissa, exponent-25)
+}
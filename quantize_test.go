@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"path/filepath"
+	"testing"
+
+	"github.com/micro-agent/micro-agent-go/agent/rag"
+)
+
+func TestQuantizationKeepsTopResults(t *testing.T) {
+	const (
+		records = 2000
+		queries = 50
+		topN    = 10
+	)
+	setupServer(t, nil, nil)
+	random := rand.New(rand.NewPCG(19, 23))
+	vectors := clusteredVectors(random, records+queries, 64, 20)
+
+	// The vectors are quantized when saved, then written to and read from the store file
+	stores := map[string]*SnippetStore{}
+	for _, quantization := range []string{quantizationNone, quantizationFloat16, quantizationInt8} {
+		saved := NewSnippetStore(false, false, false, quantization)
+		for idx, vector := range vectors[:records] {
+			saved.Save(testRecord(fmt.Sprintf("record-%04d", idx), "snippets/go.md", "chunk", vector...))
+		}
+		path := filepath.Join(t.TempDir(), "store.json")
+		if err := saved.Persist(path); err != nil {
+			t.Fatalf("Persist of the %s store failed: %v", quantization, err)
+		}
+		stores[quantization] = NewSnippetStore(false, false, false, quantization)
+		if err := stores[quantization].Load(path); err != nil {
+			t.Fatalf("Load of the %s store failed: %v", quantization, err)
+		}
+	}
+
+	tests := []struct {
+		quantization string
+		minOverlap   float64
+		maxScoreDiff float64
+	}{
+		{quantizationFloat16, 0.99, 0.0005},
+		{quantizationInt8, 0.95, 0.005},
+	}
+	for _, test := range tests {
+		t.Run(test.quantization, func(t *testing.T) {
+			overlap, scoreDiff := 0, 0.0
+			for _, vector := range vectors[records:] {
+				question := rag.VectorRecord{Embedding: vector}
+				exact, err := stores[quantizationNone].SearchTopNSimilarities(context.Background(), question, -1, topN, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				quantized, err := stores[test.quantization].SearchTopNSimilarities(context.Background(), question, -1, topN, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				exactScores := map[string]float64{}
+				for _, record := range exact {
+					exactScores[record.Id] = record.CosineSimilarity
+				}
+				for _, record := range quantized {
+					if score, ok := exactScores[record.Id]; ok {
+						overlap++
+						scoreDiff = max(scoreDiff, math.Abs(record.CosineSimilarity-score))
+					}
+				}
+			}
+			ratio := float64(overlap) / float64(queries*topN)
+			t.Logf("top %d overlap with the unquantized vectors: %.3f, largest score difference: %.5f", topN, ratio, scoreDiff)
+			if ratio < test.minOverlap {
+				t.Errorf("top %d overlap = %.3f, want at least %.2f", topN, ratio, test.minOverlap)
+			}
+			if scoreDiff > test.maxScoreDiff {
+				t.Errorf("largest score difference = %.5f, want at most %.3f", scoreDiff, test.maxScoreDiff)
+			}
+		})
+	}
+}
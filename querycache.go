@@ -0,0 +1,88 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+)
+
+// queryCache is a LRU cache of the embeddings of the search queries,
+// keyed by embedding model and query so a model change never returns
+// the vector of another model
+type queryCache struct {
+	mutex    sync.Mutex
+	capacity int
+	entries  map[queryCacheKey]*list.Element
+	// order lists the entries from the most to the least recently used
+	order *list.List
+}
+
+type queryCacheKey struct {
+	model string
+	query string
+}
+
+type queryCacheEntry struct {
+	key       queryCacheKey
+	embedding []float64
+}
+
+// newQueryCache creates a cache of capacity entries, or nil when capacity
+// is not positive: a nil cache stores nothing
+func newQueryCache(capacity int) *queryCache {
+	if capacity <= 0 {
+		return nil
+	}
+	return &queryCache{
+		capacity: capacity,
+		entries:  make(map[queryCacheKey]*list.Element, capacity),
+		order:    list.New(),
+	}
+}
+
+// Get returns the cached embedding of a query
+func (c *queryCache) Get(model string, query string) ([]float64, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	element, ok := c.entries[queryCacheKey{model, query}]
+	if !ok {
+		queryCacheRequestsTotal.WithLabelValues("miss").Inc()
+		return nil, false
+	}
+	queryCacheRequestsTotal.WithLabelValues("hit").Inc()
+	c.order.MoveToFront(element)
+	return element.Value.(*queryCacheEntry).embedding, true
+}
+
+// Put caches the embedding of a query, evicting the least recently used one when full
+func (c *queryCache) Put(model string, query string, embedding []float64) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	key := queryCacheKey{model, query}
+	if element, ok := c.entries[key]; ok {
+		element.Value.(*queryCacheEntry).embedding = embedding
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&queryCacheEntry{key: key, embedding: embedding})
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*queryCacheEntry).key)
+	}
+}
+
+// Len returns the number of cached embeddings
+func (c *queryCache) Len() int {
+	if c == nil {
+		return 0
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.order.Len()
+}
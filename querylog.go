@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// queryLogEntry is a line of the query log
+type queryLogEntry struct {
+	Time     time.Time `json:"time"`
+	Topic    string    `json:"topic"`
+	Results  int       `json:"results"`
+	TopScore float64   `json:"top_score"`
+}
+
+// queryLog appends the search queries to a JSONL file
+type queryLog struct {
+	mutex sync.Mutex
+	path  string
+}
+
+// newQueryLog creates the log of the queries appended to path,
+// or nil when path is empty: a nil log records nothing
+func newQueryLog(path string) *queryLog {
+	if path == "" {
+		return nil
+	}
+	return &queryLog{path: path}
+}
+
+// Record appends a query and its results to the log
+func (l *queryLog) Record(topic string, results []SnippetRecord) {
+	if l == nil {
+		return
+	}
+	entry := queryLogEntry{Time: time.Now().UTC(), Topic: topic, Results: len(results)}
+	if len(results) > 0 {
+		entry.TopScore = roundScore(results[0].CosineSimilarity)
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		slog.Error("😡 Error encoding the query log entry", "error", err)
+		return
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	file, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		slog.Error("😡 Error opening the query log", "path", l.path, "error", err)
+		return
+	}
+	defer file.Close()
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		slog.Error("😡 Error writing the query log", "path", l.path, "error", err)
+	}
+}
+
+// queryCount is the number of searches of a query
+type queryCount struct {
+	Topic string `json:"topic"`
+	Count int    `json:"count"`
+}
+
+// QuerySummary summarizes the query log
+type QuerySummary struct {
+	Queries           int          `json:"queries"`
+	ZeroResults       int          `json:"zero_results"`
+	ZeroResultsRatio  float64      `json:"zero_results_ratio"`
+	MostFrequent      []queryCount `json:"most_frequent"`
+	MostFrequentEmpty []queryCount `json:"most_frequent_without_results"`
+}
+
+// Summarize reads the log and returns the top most frequent queries (compared
+// case-insensitively), overall and among the queries without results
+func (l *queryLog) Summarize(top int) (QuerySummary, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	summary := QuerySummary{}
+	file, err := os.Open(l.path)
+	if os.IsNotExist(err) {
+		return summary, nil
+	}
+	if err != nil {
+		return summary, err
+	}
+	defer file.Close()
+
+	counts := map[string]int{}
+	emptyCounts := map[string]int{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry queryLogEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		topic := strings.ToLower(strings.TrimSpace(entry.Topic))
+		summary.Queries++
+		counts[topic]++
+		if entry.Results == 0 {
+			summary.ZeroResults++
+			emptyCounts[topic]++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return summary, err
+	}
+
+	if summary.Queries > 0 {
+		summary.ZeroResultsRatio = float64(summary.ZeroResults) / float64(summary.Queries)
+	}
+	summary.MostFrequent = topQueries(counts, top)
+	summary.MostFrequentEmpty = topQueries(emptyCounts, top)
+	return summary, nil
+}
+
+// topQueries returns the top most frequent queries
+func topQueries(counts map[string]int, top int) []queryCount {
+	queries := make([]queryCount, 0, len(counts))
+	for topic, count := range counts {
+		queries = append(queries, queryCount{Topic: topic, Count: count})
+	}
+	sort.Slice(queries, func(i, j int) bool {
+		if queries[i].Count != queries[j].Count {
+			return queries[i].Count > queries[j].Count
+		}
+		return queries[i].Topic < queries[j].Topic
+	})
+	if len(queries) > top {
+		queries = queries[:top]
+	}
+	return queries
+}
+
+// queryStatsHandler summarizes the query log:
+// the most frequent queries and the fraction without results
+func queryStatsHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	top := request.GetInt("top", 10)
+	if top <= 0 {
+		return nil, fmt.Errorf("parameter 'top' must be positive")
+	}
+
+	summary, err := queries.Summarize(top)
+	if err != nil {
+		slog.Error("😡 Error reading the query log", "path", queries.path, "error", err)
+		return nil, fmt.Errorf("failed to read the query log: %w", err)
+	}
+	summaryJSON, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode the query statistics: %w", err)
+	}
+	return mcp.NewToolResultText(string(summaryJSON)), nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// errRateLimited is the error of a search rejected because the embedding
+// backend is at its EMBEDDING_MAX_RPS limit
+var errRateLimited = errors.New("too many requests: the embedding backend is at its rate limit, retry later")
+
+// rateLimiter is a token bucket limiting the requests to the embedding
+// backend to rate per second, with bursts of up to burst requests.
+// The searches have priority: the indexing only takes a token when no
+// search is waiting, so a reindex never starves the live queries.
+type rateLimiter struct {
+	mutex  sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	// waitingSearches counts the searches waiting for a token
+	waitingSearches int
+	// queueTimeout is the longest wait of a search for a token
+	queueTimeout time.Duration
+}
+
+// newRateLimiter creates a limiter of rate requests per second, or nil when
+// rate is 0: a nil limiter never waits
+func newRateLimiter(rate float64, burst int, queueTimeout time.Duration) *rateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	return &rateLimiter{
+		rate:         rate,
+		burst:        float64(burst),
+		tokens:       float64(burst),
+		last:         time.Now(),
+		queueTimeout: queueTimeout,
+	}
+}
+
+// WaitSearch waits for a token for the embedding of a search topic, at most
+// the queue timeout, and returns errRateLimited when it waited too long
+func (l *rateLimiter) WaitSearch(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	l.mutex.Lock()
+	l.waitingSearches++
+	l.mutex.Unlock()
+	defer func() {
+		l.mutex.Lock()
+		l.waitingSearches--
+		l.mutex.Unlock()
+	}()
+
+	deadline := time.Now().Add(l.queueTimeout)
+	return l.wait(ctx, true, deadline)
+}
+
+// WaitIndex waits for a token for an embedding request of the indexing,
+// until ctx is done
+func (l *rateLimiter) WaitIndex(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	return l.wait(ctx, false, time.Time{})
+}
+
+// wait takes a token, waiting for the bucket to refill until the deadline
+// (none when zero). Without priority, the token is only taken when no
+// search is waiting.
+func (l *rateLimiter) wait(ctx context.Context, priority bool, deadline time.Time) error {
+	for {
+		l.mutex.Lock()
+		now := time.Now()
+		l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+		l.last = now
+		if l.tokens >= 1 && (priority || l.waitingSearches == 0) {
+			l.tokens--
+			l.mutex.Unlock()
+			return nil
+		}
+		delay := time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+		if delay <= 0 {
+			// A token is available, but reserved for the waiting searches
+			delay = time.Duration(float64(time.Second) / l.rate)
+		}
+		l.mutex.Unlock()
+
+		if !deadline.IsZero() && now.Add(delay).After(deadline) {
+			return fmt.Errorf("%w (EMBEDDING_MAX_RPS=%g)", errRateLimited, l.rate)
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,15 @@
+package main
+
+import (
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// addWriteTool registers a tool modifying the vector store, unless
+// READ_ONLY is set: a read-only server doesn't expose it at all
+func addWriteTool(s *server.MCPServer, tool mcp.Tool, handler server.ToolHandlerFunc) {
+	if config.ReadOnly {
+		return
+	}
+	s.AddTool(tool, handler)
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// recencyScore combines the ranking score of a record (its similarity with
+// its source boost) with the recency of its source: with RECENCY_WEIGHT w,
+// the score is (1-w) * score +
+// w * decay, where decay halves every RECENCY_HALF_LIFE since the
+// modification of the source (1 when just modified). A record without
+// modification time gets no boost.
+func recencyScore(record SnippetRecord, now time.Time) float64 {
+	weight := config.RecencyWeight
+	decay := 0.0
+	if record.ModifiedAt != nil {
+		age := max(now.Sub(*record.ModifiedAt), 0)
+		decay = math.Pow(0.5, age.Hours()/config.RecencyHalfLife.Hours())
+	}
+	return (1-weight)*rankingScore(record) + weight*decay
+}
+
+// boostRecent sorts the candidates of a search by their recency score when
+// RECENCY_WEIGHT is set, so a newer snippet may outrank a slightly more
+// similar older one. The candidates keep their cosine similarity.
+func boostRecent(candidates []SnippetRecord) []SnippetRecord {
+	if config.RecencyWeight <= 0 {
+		return candidates
+	}
+	now := time.Now()
+	scores := make(map[string]float64, len(candidates))
+	for _, candidate := range candidates {
+		scores[candidate.Id] = recencyScore(candidate, now)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return scores[candidates[i].Id] > scores[candidates[j].Id]
+	})
+	return candidates
+}
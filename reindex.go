@@ -0,0 +1,394 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// errReindexInProgress rejects a reindex requested while another one runs
+var errReindexInProgress = errors.New("a reindex is already in progress")
+
+// reindexing is set while a reindex runs
+var reindexing atomic.Bool
+
+// reindexSummary counts the content files added, updated, removed,
+// unchanged and expired by a reindex, and the chunks which couldn't be indexed
+type reindexSummary struct {
+	Added     int `json:"added"`
+	Updated   int `json:"updated"`
+	Removed   int `json:"removed"`
+	Unchanged int `json:"unchanged"`
+	Expired   int `json:"expired"`
+	Errors    int `json:"errors"`
+}
+
+// reindexContent updates the store with the changes of the content files
+// since they were indexed: the chunks of the new files are indexed, the
+// chunks of the files modified since they were indexed are replaced once the
+// new ones are embedded, and the chunks of the deleted (or now ignored) files
+// are removed. An archive of CONTENT_ARCHIVE is reindexed as a whole when it
+// changed. The content files with chunks which couldn't be indexed before are
+// indexed again, as if they were modified, and the failures of the store are
+// replaced by the ones of this reindex. The imported URLs and the documents
+// added by add_snippets_bulk are kept. The store is then persisted to
+// storeFilePath and the snippet resources are registered again. The progress
+// of the embeddings is also sent to notify, when set.
+func reindexContent(ctx context.Context, s *server.MCPServer, storeFilePath string, delimiter string,
+	notify func(done int, total int, message string)) (reindexSummary, error) {
+	if !reindexing.CompareAndSwap(false, true) {
+		return reindexSummary{}, errReindexInProgress
+	}
+	defer reindexing.Store(false)
+
+	slog.Info("🔄 Reindexing the content files...", "content_dirs", config.ContentDirs)
+	indexed := map[string][]SnippetRecord{}
+	for _, record := range store.Records() {
+		if !isImportedRecord(record) {
+			contentFile := recordContentFile(record)
+			indexed[contentFile] = append(indexed[contentFile], record)
+		}
+	}
+
+	// retried are the content files with chunks which couldn't be indexed before
+	retried := map[string]bool{}
+	for _, source := range store.Failures().Sources {
+		retried[source] = true
+	}
+
+	summary := reindexSummary{}
+	// replaced are the chunks of the modified files, removed once their new
+	// chunks are embedded
+	replaced := map[string][]SnippetRecord{}
+	// The chunks of the new and modified files are read before they are
+	// embedded, so the progress knows their total, like in buildStore: the
+	// large files are only counted, and chunked again while they are embedded
+	chunks := []SnippetRecord{}
+	streamedFiles := []string{}
+	streamedChunks := 0
+	duplicates := newFileDeduplicator(config.DedupFiles)
+	now := time.Now()
+	err := walkContentDirs(config.ContentDirs, config.IgnorePatterns, func(contentDir string, path string) error {
+		convert, ok := contentFileConverters[strings.ToLower(filepath.Ext(path))]
+		if !ok {
+			return nil
+		}
+		if duplicate, err := duplicates.check(path); err != nil || duplicate {
+			return err
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		records, known := indexed[path]
+		delete(indexed, path)
+		if known && !retried[path] && !isModifiedSince(records, info.ModTime()) {
+			summary.Unchanged++
+			return nil
+		}
+
+		// The expired files are not embedded again after the sweep removed them
+		expired, err := isExpiredFile(path, now)
+		if err != nil {
+			return err
+		}
+		if expired {
+			if err := deleteRecords(records); err != nil {
+				return fmt.Errorf("failed to remove the chunks of %s: %w", path, err)
+			}
+			slog.Debug("⌛ Expired content file skipped", "source", path)
+			summary.Expired++
+			return nil
+		}
+		replaced[path] = records
+		delimiter := config.DelimiterFor(path, delimiter)
+		if convert == nil && isStreamed(path, delimiter) {
+			err = streamContentChunks(path, delimiter, func(SnippetRecord) { streamedChunks++ })
+			streamedFiles = append(streamedFiles, path)
+		} else {
+			var fileChunks []SnippetRecord
+			fileChunks, err = readContentChunks(path, convert, delimiter)
+			chunks = append(chunks, fileChunks...)
+		}
+		if err != nil {
+			return err
+		}
+		if known {
+			slog.Info("📝 Content file updated", "source", path)
+			summary.Updated++
+		} else {
+			slog.Info("📝 Content file added", "source", path)
+			summary.Added++
+		}
+		return nil
+	})
+	for _, archivePath := range config.ContentArchives {
+		if err != nil {
+			break
+		}
+		err = reindexArchive(archivePath, indexed, replaced, retried[archivePath], &chunks, &summary, delimiter)
+	}
+
+	failures := indexFailures{}
+	failed := func(idx int, chunk SnippetRecord, err error) {
+		slog.Error("😡 Error indexing the chunk", "chunk_index", idx, "source", chunk.Source, "error", err)
+		summary.Errors++
+		failures.add(recordContentFile(chunk))
+	}
+	progress := newIndexProgress(len(chunks)+streamedChunks, notify)
+	swapper := newChunkSwapper(ctx, replaced, failed)
+	indexer := newChunkIndexer(ctx, config.EmbeddingBatchSize, func(idx int, chunk SnippetRecord, saved bool, err error) {
+		progress.Increment()
+		if err != nil {
+			failed(idx, chunk, err)
+		}
+	})
+	indexer.save = swapper.add
+	for _, chunk := range chunks {
+		indexer.add(chunk)
+	}
+	for _, path := range streamedFiles {
+		if streamErr := streamContentChunks(path, config.DelimiterFor(path, delimiter), indexer.add); streamErr != nil && err == nil {
+			err = streamErr
+		}
+	}
+	indexer.flush()
+	if swapErr := swapper.flush(); swapErr != nil && err == nil {
+		err = swapErr
+	}
+	if err == nil {
+		// The previous chunks of a cancelled reindex are kept
+		err = ctx.Err()
+	}
+	if err != nil {
+		return summary, fmt.Errorf("failed to reindex the content files: %w", err)
+	}
+
+	// The files without new chunks only lose their previous ones, and the
+	// remaining sources are no longer content files
+	for source, records := range replaced {
+		if err := deleteRecords(records); err != nil {
+			return summary, fmt.Errorf("failed to remove the chunks of %s: %w", source, err)
+		}
+	}
+	for source, records := range indexed {
+		if err := deleteRecords(records); err != nil {
+			return summary, fmt.Errorf("failed to remove the chunks of %s: %w", source, err)
+		}
+		slog.Info("🗑️ Content file removed", "source", source)
+		summary.Removed++
+	}
+
+	if !failures.complete() {
+		slog.Warn("🔶 The index is incomplete, reindex to index the failed chunks", "failed_chunks", failures.Count, "sources", failures.Sources)
+	}
+	store.SetFailures(failures)
+	flushStore(storeFilePath)
+	registerSnippetResources(s)
+	slog.Info("✅ Content files reindexed", "added", summary.Added, "updated", summary.Updated,
+		"removed", summary.Removed, "unchanged", summary.Unchanged, "expired", summary.Expired, "errors", summary.Errors, "records", store.Count())
+	return summary, nil
+}
+
+// reindexArchive indexes the content files of an archive again when it was
+// modified since they were indexed, or when retried because some of its chunks
+// couldn't be indexed, like a content file: the chunks of the archive are found
+// in indexed, by content file, and moved to replaced, and its new chunks are
+// appended to chunks
+func reindexArchive(archivePath string, indexed map[string][]SnippetRecord, replaced map[string][]SnippetRecord, retried bool,
+	chunks *[]SnippetRecord, summary *reindexSummary, delimiter string) error {
+	info, err := os.Stat(archivePath)
+	if err != nil {
+		return err
+	}
+	records, known := indexed[archivePath]
+	delete(indexed, archivePath)
+	if known && !retried && !isModifiedSince(records, info.ModTime()) {
+		summary.Unchanged++
+		return nil
+	}
+
+	replaced[archivePath] = records
+	err = walkArchiveChunks(archivePath, config.IgnorePatterns, delimiter, func(name string, fileChunks []SnippetRecord) {
+		*chunks = append(*chunks, fileChunks...)
+	})
+	if err != nil {
+		return err
+	}
+	if known {
+		slog.Info("📝 Content archive updated", "source", archivePath)
+		summary.Updated++
+	} else {
+		slog.Info("📝 Content archive added", "source", archivePath)
+		summary.Added++
+	}
+	return nil
+}
+
+// chunkSwapper replaces the chunks of the reindexed content files once their
+// new chunks are embedded, so the searches keep finding the previous chunks
+// of a file while it is embedded. The embedded chunks of a content file are
+// held until the chunks of the next file come, then the previous chunks of
+// the file are removed and the new ones saved. The chunks come file by file.
+type chunkSwapper struct {
+	ctx context.Context
+	// replaced are the previous chunks of the reindexed files, by content
+	// file, until they are swapped
+	replaced map[string][]SnippetRecord
+	// failed is called for each chunk which couldn't be saved
+	failed      func(idx int, chunk SnippetRecord, err error)
+	contentFile string
+	pending     []embeddedChunk
+}
+
+// embeddedChunk is a chunk waiting to be saved with its embedding
+type embeddedChunk struct {
+	idx             int
+	chunk           SnippetRecord
+	embeddingVector []float64
+}
+
+func newChunkSwapper(ctx context.Context, replaced map[string][]SnippetRecord, failed func(idx int, chunk SnippetRecord, err error)) *chunkSwapper {
+	return &chunkSwapper{ctx: ctx, replaced: replaced, failed: failed}
+}
+
+// add holds an embedded chunk, swapping the previous content file when the
+// chunk is of another one. It is the save function of a chunkIndexer.
+func (s *chunkSwapper) add(ctx context.Context, idx int, chunk SnippetRecord, embeddingVector []float64) (bool, error) {
+	if contentFile := recordContentFile(chunk); contentFile != s.contentFile {
+		if err := s.flush(); err != nil {
+			return false, err
+		}
+		s.contentFile = contentFile
+	}
+	s.pending = append(s.pending, embeddedChunk{idx: idx, chunk: chunk, embeddingVector: embeddingVector})
+	return true, nil
+}
+
+// flush removes the previous chunks of the held content file and saves its
+// new chunks, unless the reindex was cancelled
+func (s *chunkSwapper) flush() error {
+	pending := s.pending
+	s.pending = nil
+	if len(pending) == 0 || s.ctx.Err() != nil {
+		return nil
+	}
+	if err := deleteRecords(s.replaced[s.contentFile]); err != nil {
+		return fmt.Errorf("failed to remove the chunks of %s: %w", s.contentFile, err)
+	}
+	delete(s.replaced, s.contentFile)
+	for _, embedded := range pending {
+		if _, err := saveChunk(s.ctx, embedded.idx, embedded.chunk, embedded.embeddingVector); err != nil {
+			s.failed(embedded.idx, embedded.chunk, err)
+		}
+	}
+	return nil
+}
+
+// deleteRecords removes records from the store
+func deleteRecords(records []SnippetRecord) error {
+	for _, record := range records {
+		if err := store.Delete(record.Id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isImportedSource tells whether a source is an URL imported by import_url,
+// rather than a content file
+func isImportedSource(source string) bool {
+	return strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://")
+}
+
+// isImportedRecord tells whether a record was imported by import_url or
+// added by add_snippets_bulk, rather than indexed from a content file
+func isImportedRecord(record SnippetRecord) bool {
+	if record.ContentFile != "" {
+		return record.ContentFile == addedContentFile
+	}
+	return isImportedSource(record.Source)
+}
+
+// isModifiedSince tells whether the chunks of a content file were indexed
+// before its last modification, or without its modification time
+func isModifiedSince(records []SnippetRecord, modifiedAt time.Time) bool {
+	for _, record := range records {
+		if record.ModifiedAt == nil || !record.ModifiedAt.Equal(modifiedAt) {
+			return true
+		}
+	}
+	return false
+}
+
+// reindexHandler returns the handler of the reindex tool
+func reindexHandler(s *server.MCPServer, storeFilePath string) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if !isStoreReady() {
+			return nil, fmt.Errorf("the vector store is not ready yet, please retry later")
+		}
+		summary, err := reindexContent(ctx, s, storeFilePath, config.Delimiter, mcpProgressNotifier(ctx, request))
+		if err != nil {
+			return nil, err
+		}
+		message := fmt.Sprintf("Reindexed the content files: %d added, %d updated, %d removed, %d unchanged, %d expired",
+			summary.Added, summary.Updated, summary.Removed, summary.Unchanged, summary.Expired)
+		if summary.Errors > 0 {
+			message += fmt.Sprintf("\nWarning: %d chunks couldn't be indexed, see the server logs", summary.Errors)
+		}
+		return mcp.NewToolResultText(message), nil
+	}
+}
+
+// reindexHTTPHandler returns the handler of the POST /reindex endpoint, which
+// reindexes the content files like the reindex tool, for the automation
+// not speaking MCP, and returns the JSON summary of the reindex.
+// A reindex requested while another one runs is rejected with a 409.
+func reindexHTTPHandler(s *server.MCPServer, storeFilePath string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			json.NewEncoder(w).Encode(map[string]any{
+				"error": "method not allowed, use POST",
+			})
+			return
+		}
+		if !isStoreReady() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(map[string]any{
+				"error": "vector store not ready",
+			})
+			return
+		}
+
+		// The reindex completes even when the client disconnects
+		summary, err := reindexContent(context.WithoutCancel(r.Context()), s, storeFilePath, config.Delimiter, nil)
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, errReindexInProgress) {
+				status = http.StatusConflict
+			}
+			slog.Warn("🔶 Reindex request failed", "status", status, "error", err)
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(map[string]any{
+				"error": err.Error(),
+			})
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(summary)
+	}
+}
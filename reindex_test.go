@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// storedPrompts returns the prompts of the records of the store
+func storedPrompts(snippetStore *SnippetStore) []string {
+	prompts := []string{}
+	for _, record := range snippetStore.Records() {
+		prompts = append(prompts, record.Prompt)
+	}
+	return prompts
+}
+
+func TestReindexReplacesChunksOnceEmbedded(t *testing.T) {
+	var snippetStore *SnippetStore
+	// seen are the stored prompts while each chunk is embedded
+	seen := map[string][]string{}
+	cancelled := false
+	snippetStore = setupServer(t, func(ctx context.Context, content string) ([]float64, error) {
+		seen[content] = storedPrompts(snippetStore)
+		if cancelled {
+			return nil, context.Canceled
+		}
+		return []float64{1, float64(len(content))}, nil
+	}, map[string]string{"DEDUP_THRESHOLD": "0.5"})
+	path := filepath.Join(config.ContentDirs[0], "go.md")
+	s := server.NewMCPServer("test", "1.0.0")
+	storeFilePath := filepath.Join(t.TempDir(), "store.json")
+	reindex := func(content string, modifiedAt time.Time) error {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modifiedAt, modifiedAt); err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		if cancelled {
+			cancel()
+		}
+		_, err := reindexContent(ctx, s, storeFilePath, config.Delimiter, nil)
+		return err
+	}
+
+	modifiedAt := time.Now().Add(-time.Hour)
+	if err := reindex("# Go v1\n", modifiedAt); err != nil {
+		t.Fatalf("first reindex failed: %v", err)
+	}
+	// The new chunk is a near-duplicate of the previous one, which is removed first
+	if err := reindex("# Go v2\n", modifiedAt.Add(time.Minute)); err != nil {
+		t.Fatalf("second reindex failed: %v", err)
+	}
+	if prompts := seen["# Go v2\n"]; len(prompts) != 1 || prompts[0] != "# Go v1\n" {
+		t.Errorf("the stored chunks while the new chunk is embedded are %q, want the previous chunk", prompts)
+	}
+	if prompts := storedPrompts(snippetStore); len(prompts) != 1 || prompts[0] != "# Go v2\n" {
+		t.Errorf("the stored chunks after the reindex are %q, want the new chunk", prompts)
+	}
+
+	// A cancelled reindex keeps the previous chunks
+	cancelled = true
+	if err := reindex("# Go v3\n", modifiedAt.Add(2*time.Minute)); !errors.Is(err, context.Canceled) {
+		t.Fatalf("cancelled reindex: error = %v, want context.Canceled", err)
+	}
+	if prompts := storedPrompts(snippetStore); len(prompts) != 1 || !strings.Contains(prompts[0], "v2") {
+		t.Errorf("the stored chunks after the cancelled reindex are %q, want the previous chunk", prompts)
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// reloadStoreHandler returns the handler of the reload_store tool: the store
+// is read again from storeFilePath, e.g. after it was edited or persisted by
+// another process. The records are swapped only once the file is read, so a
+// load error keeps the current records.
+func reloadStoreHandler(s *server.MCPServer, storeFilePath string) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if !isStoreReady() {
+			return nil, fmt.Errorf("the vector store is not ready yet, please retry later")
+		}
+
+		previousCount := store.Count()
+		if err := store.Load(storeFilePath); err != nil {
+			slog.Error("😡 Error reloading the vector store, keeping the current records", "path", storeFilePath, "error", err)
+			return nil, fmt.Errorf("failed to reload the vector store, the current %d records are kept: %w", previousCount, err)
+		}
+		registerSnippetResources(s)
+
+		count := store.Count()
+		slog.Info("🔄 Vector store reloaded", "path", storeFilePath, "records", count, "previous_records", previousCount)
+		message := fmt.Sprintf("Reloaded %d records from %s (%d before)", count, storeFilePath, previousCount)
+		if model := store.Model(); model != "" && model != config.StoreModel() {
+			slog.Warn("🔶 The reloaded vector store was built with another embedding model", "store_model", model, "model", config.StoreModel())
+			message += fmt.Sprintf("\nWarning: the store was built with the embedding model %q, not %q, searches may fail", model, config.StoreModel())
+		}
+		return mcp.NewToolResultText(message), nil
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/micro-agent/micro-agent-go/agent/mu"
+	"github.com/openai/openai-go/v2"
+)
+
+const rerankSystemInstructions = `You are a relevance grader for a code snippets search engine.
+Given a question and a snippet, rate how well the snippet answers the question
+on a scale from 0 (irrelevant) to 10 (perfect answer).
+Answer with the number only.`
+
+var rerankScorePattern = regexp.MustCompile(`\d+(\.\d+)?`)
+
+// llmReranker reorders search candidates by asking a chat model
+// to grade the relevance of each query/snippet pair
+type llmReranker struct {
+	client  openai.Client
+	model   string
+	timeout time.Duration
+}
+
+// newLLMReranker creates a reranker using the given chat model;
+// a timeout of 0 means the grading calls have no deadline.
+func newLLMReranker(client openai.Client, model string, timeout time.Duration) *llmReranker {
+	return &llmReranker{
+		client:  client,
+		model:   model,
+		timeout: timeout,
+	}
+}
+
+// Rerank grades each candidate against the query and returns the topN best
+// graded ones. A candidate that can't be graded keeps its cosine similarity
+// (scaled like the grades) so a failing model degrades to the cosine order.
+func (r *llmReranker) Rerank(ctx context.Context, query string, candidates []SnippetRecord, topN int) []SnippetRecord {
+	scores := make(map[string]float64, len(candidates))
+	for _, candidate := range candidates {
+		score, err := r.grade(ctx, query, candidate.Prompt)
+		if err != nil {
+			slog.Warn("🔶 Unable to rerank the snippet, keeping its cosine similarity", "id", candidate.Id, "error", err)
+			score = candidate.CosineSimilarity
+		}
+		slog.Debug("🏅 Snippet reranked", "id", candidate.Id, "score", roundScore(candidate.CosineSimilarity), "rerank_score", roundScore(score))
+		scores[candidate.Id] = score
+	}
+
+	reranked := append([]SnippetRecord{}, candidates...)
+	sort.SliceStable(reranked, func(i, j int) bool {
+		return scores[reranked[i].Id] > scores[reranked[j].Id]
+	})
+	if len(reranked) > topN {
+		reranked = reranked[:topN]
+	}
+	return reranked
+}
+
+// grade returns the relevance of the snippet for the query, between 0 and 1
+func (r *llmReranker) grade(ctx context.Context, query string, snippet string) (float64, error) {
+	if r.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.timeout)
+		defer cancel()
+	}
+
+	rerankAgent, err := mu.NewAgent(ctx, "rerank-agent",
+		mu.WithClient(r.client),
+		mu.WithParams(openai.ChatCompletionNewParams{
+			Model:       r.model,
+			Temperature: openai.Opt(0.0),
+		}),
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	answer, err := rerankAgent.Run([]openai.ChatCompletionMessageParamUnion{
+		openai.SystemMessage(rerankSystemInstructions),
+		openai.UserMessage(fmt.Sprintf("QUESTION:\n%s\n\nSNIPPET:\n%s", query, snippet)),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	match := rerankScorePattern.FindString(answer)
+	if match == "" {
+		return 0, fmt.Errorf("no grade in the answer %q", answer)
+	}
+	grade, err := strconv.ParseFloat(match, 64)
+	if err != nil {
+		return 0, err
+	}
+	return min(grade, 10) / 10, nil
+}
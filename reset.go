@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// resetStoreHandler returns the handler of the reset_store tool, registered
+// with ALLOW_RESET: all the records are removed and the empty store is
+// persisted to storeFilePath (the previous JSON store file is kept as a
+// backup with STORE_BACKUP). The store stays ready, to be filled again by
+// the reindex tool. It requires a confirm argument set to true, and is
+// rejected while a reindex runs.
+func resetStoreHandler(s *server.MCPServer, storeFilePath string) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if !request.GetBool("confirm", false) {
+			return nil, fmt.Errorf("parameter 'confirm' must be true to remove all the records of the store")
+		}
+		if !isStoreReady() {
+			return nil, fmt.Errorf("the vector store is not ready yet, please retry later")
+		}
+		// A reindex would add records to the reset store
+		if !reindexing.CompareAndSwap(false, true) {
+			return nil, errReindexInProgress
+		}
+		defer reindexing.Store(false)
+
+		removed := store.Count()
+		store.Reset()
+		if err := store.Persist(storeFilePath); err != nil {
+			slog.Error("😡 Error persisting the reset vector store", "path", storeFilePath, "error", err)
+			return nil, fmt.Errorf("the %d records were removed, but the store file couldn't be written: %w", removed, err)
+		}
+		registerSnippetResources(s)
+
+		slog.Warn("🧹 Vector store reset", "path", storeFilePath, "removed_records", removed)
+		return mcp.NewToolResultText(fmt.Sprintf("Removed %d records, the store is empty: use the reindex tool to index the content files again", removed)), nil
+	}
+}
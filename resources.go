@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// snippetURIPrefix is the scheme of the URIs of the snippet resources
+const snippetURIPrefix = "snippet://"
+
+// registerSnippetResources exposes every record of the store as an MCP
+// resource, replacing the resources previously registered
+func registerSnippetResources(s *server.MCPServer) {
+	records := store.Records()
+	resources := make([]server.ServerResource, 0, len(records))
+	for _, record := range records {
+		resources = append(resources, server.ServerResource{
+			Resource: mcp.NewResource(
+				snippetURIPrefix+record.Id,
+				recordTitle(record),
+				mcp.WithResourceDescription(record.Source),
+				mcp.WithMIMEType("text/markdown"),
+			),
+			Handler: readSnippetResourceHandler,
+		})
+	}
+	s.SetResources(resources...)
+}
+
+// readSnippetResourceHandler returns the content of a snippet and its metadata
+func readSnippetResourceHandler(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+	uri := request.Params.URI
+	id := strings.TrimPrefix(uri, snippetURIPrefix)
+	record, ok := store.Get(id)
+	if !ok {
+		return nil, fmt.Errorf("snippet %q not found", id)
+	}
+	return []mcp.ResourceContents{
+		mcp.TextResourceContents{
+			Meta:     mcp.NewMetaFromMap(snippetMeta(record)),
+			URI:      uri,
+			MIMEType: "text/markdown",
+			Text:     record.Prompt,
+		},
+	}, nil
+}
+
+// snippetMeta returns the metadata of a snippet resource, with its position
+// in its source when it is known and its expiration date when it has one
+func snippetMeta(record SnippetRecord) map[string]any {
+	meta := map[string]any{
+		"id":     record.Id,
+		"source": record.Source,
+		"title":  recordTitle(record),
+	}
+	if record.StartLine > 0 {
+		meta["start_offset"] = record.StartOffset
+		meta["end_offset"] = record.EndOffset
+		meta["start_line"] = record.StartLine
+		meta["end_line"] = record.EndLine
+	}
+	if record.ExpiresAt != nil {
+		meta["expires_at"] = record.ExpiresAt.Format(time.RFC3339)
+	}
+	if len(record.Tags) > 0 {
+		meta["tags"] = record.Tags
+	}
+	if record.Disabled {
+		meta["disabled"] = true
+	}
+	return meta
+}
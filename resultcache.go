@@ -0,0 +1,166 @@
+package main
+
+import (
+	"container/list"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// resultCache is a LRU cache of the results of the search_snippet calls,
+// so a repeated search skips the embedding, the expansion and the reranking.
+// The entries expire after the TTL, and the whole cache is dropped when the
+// records of the store change.
+type resultCache struct {
+	mutex    sync.Mutex
+	capacity int
+	ttl      time.Duration
+	entries  map[resultCacheKey]*list.Element
+	// order lists the entries from the most to the least recently used
+	order *list.List
+	// version is the version of the store the cached results were computed from
+	version uint64
+}
+
+// resultCacheKey identifies a search by its normalized topic and its parameters
+type resultCacheKey struct {
+	model          string
+	topic          string
+	sourceFilter   string
+	excludeSources string
+	minLength      int
+	maxLength      int
+	threshold      float64
+	topN           int
+}
+
+type resultCacheEntry struct {
+	key          resultCacheKey
+	similarities []SnippetRecord
+	expiresAt    time.Time
+}
+
+// newResultCacheKey returns the key of a search, the topic is trimmed and its
+// whitespace runs are collapsed
+func newResultCacheKey(model string, topic string, sourceFilter string, excludeSources []string, minLength int, maxLength int,
+	threshold float64, topN int) resultCacheKey {
+	return resultCacheKey{
+		model:          model,
+		topic:          strings.Join(strings.Fields(topic), " "),
+		sourceFilter:   sourceFilter,
+		excludeSources: strings.Join(excludeSources, "\x00"),
+		minLength:      minLength,
+		maxLength:      maxLength,
+		threshold:      threshold,
+		topN:           topN,
+	}
+}
+
+// newResultCache creates a cache of capacity entries expiring after ttl, or
+// nil when ttl or capacity is not positive: a nil cache stores nothing
+func newResultCache(capacity int, ttl time.Duration) *resultCache {
+	if capacity <= 0 || ttl <= 0 {
+		return nil
+	}
+	return &resultCache{
+		capacity: capacity,
+		ttl:      ttl,
+		entries:  make(map[resultCacheKey]*list.Element, capacity),
+		order:    list.New(),
+	}
+}
+
+// Get returns the cached results of a search, unless they expired or the
+// store changed since they were cached
+func (c *resultCache) Get(key resultCacheKey) ([]SnippetRecord, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.invalidateIfStale()
+	element, ok := c.entries[key]
+	if !ok || time.Now().After(element.Value.(*resultCacheEntry).expiresAt) {
+		if ok {
+			c.remove(element)
+		}
+		resultCacheRequestsTotal.WithLabelValues("miss").Inc()
+		return nil, false
+	}
+	resultCacheRequestsTotal.WithLabelValues("hit").Inc()
+	c.order.MoveToFront(element)
+	return slices.Clone(element.Value.(*resultCacheEntry).similarities), true
+}
+
+// Put caches the results of a search computed from the given version of the
+// store, evicting the least recently used entry when full
+func (c *resultCache) Put(key resultCacheKey, version uint64, similarities []SnippetRecord) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.invalidateIfStale()
+	// The store changed during the search
+	if version != c.version {
+		return
+	}
+	entry := &resultCacheEntry{key: key, similarities: slices.Clone(similarities), expiresAt: time.Now().Add(c.ttl)}
+	// The results are not served once one of their records expired
+	for _, record := range similarities {
+		if record.ExpiresAt != nil && record.ExpiresAt.Before(entry.expiresAt) {
+			entry.expiresAt = *record.ExpiresAt
+		}
+	}
+	if element, ok := c.entries[key]; ok {
+		element.Value = entry
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.order.PushFront(entry)
+	if c.order.Len() > c.capacity {
+		c.remove(c.order.Back())
+	}
+}
+
+// Clear drops all the cached results
+func (c *resultCache) Clear() {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	clear(c.entries)
+	c.order.Init()
+}
+
+// Len returns the number of cached results
+func (c *resultCache) Len() int {
+	if c == nil {
+		return 0
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.order.Len()
+}
+
+// invalidateIfStale drops all the entries when the store changed since they
+// were cached; it must be called with the lock held
+func (c *resultCache) invalidateIfStale() {
+	version := store.Version()
+	if version == c.version {
+		return
+	}
+	if c.order.Len() > 0 {
+		clear(c.entries)
+		c.order.Init()
+	}
+	c.version = version
+}
+
+// remove drops an entry; it must be called with the lock held
+func (c *resultCache) remove(element *list.Element) {
+	c.order.Remove(element)
+	delete(c.entries, element.Value.(*resultCacheEntry).key)
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// snippetsResult returns the response of a search: the header, then each
+// snippet as its own text content, with its metadata, its resource URI and
+// (unless found byKeywords) its rounded similarity in the _meta of the content.
+// With COMBINED_RESULTS, for the clients reading only the first text content,
+// the header and the snippets are concatenated into a single text.
+func snippetsResult(header string, topic string, similarities []SnippetRecord, byKeywords bool) *mcp.CallToolResult {
+	if config.CombinedResults {
+		return mcp.NewToolResultText(header + formatDocuments(topic, similarities, byKeywords))
+	}
+
+	snippets, omitted := formatSnippets(topic, similarities, byKeywords)
+	before, after := resultPreamble()
+	contents := make([]mcp.Content, 0, len(snippets)+3)
+	contents = append(contents, mcp.NewTextContent(header+before))
+	for idx, snippet := range snippets {
+		meta := snippetMeta(similarities[idx])
+		meta["uri"] = snippetURIPrefix + similarities[idx].Id
+		if !byKeywords {
+			meta["score"] = roundScore(similarities[idx].CosineSimilarity)
+			meta["below_threshold"] = isBelowThreshold(similarities[idx])
+		}
+		contents = append(contents, mcp.TextContent{
+			Meta: mcp.NewMetaFromMap(meta),
+			Type: "text",
+			Text: strings.TrimLeft(snippet, "\n"),
+		})
+	}
+	if omitted > 0 {
+		contents = append(contents, mcp.NewTextContent(omittedSnippetsNote(omitted)))
+	}
+	if after != "" {
+		contents = append(contents, mcp.NewTextContent(after))
+	}
+	return &mcp.CallToolResult{Content: contents}
+}
+
+// verboseResult returns the response of a search for the diagnosis of the
+// chunking and the retrieval: the header, then each snippet as its own text
+// content, annotated with its source, its chunk_index among the chunks of its
+// source, its offset_range in the source and its unrounded score (unless found
+// byKeywords), followed by its whole text. The records without positions
+// (converted or JSON Lines content) have neither chunk_index nor offset_range.
+func verboseResult(header string, similarities []SnippetRecord, byKeywords bool) *mcp.CallToolResult {
+	indexes := chunkIndexes(similarities)
+	contents := make([]mcp.Content, 0, len(similarities)+1)
+	contents = append(contents, mcp.NewTextContent(header))
+	for idx, similarity := range similarities {
+		meta := snippetMeta(similarity)
+		meta["uri"] = snippetURIPrefix + similarity.Id
+		annotation := fmt.Sprintf("Result %d\nsource: %s\n", idx+1, similarity.Source)
+		if chunkIndex, ok := indexes[similarity.Id]; ok {
+			annotation += fmt.Sprintf("chunk_index: %d\noffset_range: %d-%d\n", chunkIndex, similarity.StartOffset, similarity.EndOffset)
+			meta["chunk_index"] = chunkIndex
+		}
+		if !byKeywords {
+			annotation += "score: " + strconv.FormatFloat(similarity.CosineSimilarity, 'f', -1, 64) + "\n"
+			meta["score"] = similarity.CosineSimilarity
+		}
+		contents = append(contents, mcp.TextContent{
+			Meta: mcp.NewMetaFromMap(meta),
+			Type: "text",
+			Text: annotation + "---\n" + similarity.Prompt,
+		})
+	}
+	if config.CombinedResults {
+		texts := make([]string, 0, len(contents))
+		for _, content := range contents {
+			texts = append(texts, content.(mcp.TextContent).Text)
+		}
+		return mcp.NewToolResultText(strings.Join(texts, "\n\n"))
+	}
+	return &mcp.CallToolResult{Content: contents}
+}
+
+// chunkIndexes returns the index of each record with a position among the
+// stored chunks of its source, ordered by their offsets, by record ID
+func chunkIndexes(similarities []SnippetRecord) map[string]int {
+	offsets := map[string][]int{}
+	for _, similarity := range similarities {
+		if similarity.EndOffset > similarity.StartOffset {
+			offsets[similarity.Source] = nil
+		}
+	}
+	for _, record := range store.Records() {
+		if _, ok := offsets[record.Source]; ok && record.EndOffset > record.StartOffset {
+			offsets[record.Source] = append(offsets[record.Source], record.StartOffset)
+		}
+	}
+	for _, starts := range offsets {
+		slices.Sort(starts)
+	}
+	indexes := make(map[string]int, len(similarities))
+	for _, similarity := range similarities {
+		if similarity.EndOffset > similarity.StartOffset {
+			indexes[similarity.Id], _ = slices.BinarySearch(offsets[similarity.Source], similarity.StartOffset)
+		}
+	}
+	return indexes
+}
+
+// Formats of the search_snippet results
+const (
+	resultFormatText     = "text"
+	resultFormatJSON     = "json"
+	resultFormatMarkdown = "markdown"
+)
+
+// keptSnippets returns the similarities kept in the response, without the
+// lowest scored ones dropped to fit MAX_RESULT_CHARS, and their number
+func keptSnippets(topic string, similarities []SnippetRecord, byKeywords bool) ([]SnippetRecord, int) {
+	_, omitted := formatSnippets(topic, similarities, byKeywords)
+	return similarities[:len(similarities)-omitted], omitted
+}
+
+// markdownResult returns the response of a search as a markdown document:
+// the header, then a numbered list of the snippets, each with its title in
+// bold, its similarity (unless found byKeywords) and its source as a link,
+// the snippets looking like code being fenced
+func markdownResult(header string, topic string, similarities []SnippetRecord, byKeywords bool) *mcp.CallToolResult {
+	kept, omitted := keptSnippets(topic, similarities, byKeywords)
+	var document strings.Builder
+	document.WriteString(strings.ReplaceAll(strings.TrimSpace(header), "\n", "  \n") + "\n\n")
+	for idx, similarity := range kept {
+		location := recordLocation(similarity)
+		if location == "" {
+			location = similarity.Source
+		}
+		fmt.Fprintf(&document, "%d. **%s**", idx+1, markdownEscaper.Replace(recordTitle(similarity)))
+		if !byKeywords {
+			fmt.Fprintf(&document, " — similarity %s", formatScore(similarity.CosineSimilarity))
+			if isBelowThreshold(similarity) {
+				document.WriteString(" (below threshold)")
+			}
+		}
+		fmt.Fprintf(&document, " — [%s](<%s>)\n\n", markdownEscaper.Replace(location), similarity.Source)
+
+		text := strings.Trim(truncateText(similarity.Prompt, config.MaxChunkChars), "\n")
+		if looksLikeCode(text) {
+			fence := strings.Repeat("`", max(3, longestBacktickRun(text)+1))
+			text = fence + "\n" + text + "\n" + fence
+		}
+		// The snippet is indented under its list item
+		for _, line := range strings.Split(text, "\n") {
+			if line != "" {
+				document.WriteString("   " + line)
+			}
+			document.WriteString("\n")
+		}
+		document.WriteString("\n")
+	}
+	if omitted > 0 {
+		document.WriteString("_" + strings.TrimSpace(omittedSnippetsNote(omitted)) + "_\n")
+	}
+	return mcp.NewToolResultText(document.String())
+}
+
+// markdownEscaper escapes the characters of a text which markdown would
+// render as formatting or links
+var markdownEscaper = strings.NewReplacer("\\", "\\\\", "*", "\\*", "_", "\\_", "[", "\\[", "]", "\\]", "`", "\\`")
+
+// looksLikeCode tells whether a snippet is code rather than prose or
+// markdown: it has no fenced block of its own, and at least a third of its
+// lines are indented or end like a statement of a programming language
+func looksLikeCode(text string) bool {
+	if regions, _ := scanFences(text, fenceState{}); len(regions) > 0 {
+		return false
+	}
+	lines, codeLines := 0, 0
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+		lines++
+		if strings.HasPrefix(line, "\t") || strings.HasPrefix(line, "    ") ||
+			strings.ContainsAny(trimmed[len(trimmed)-1:], ";{}()") {
+			codeLines++
+		}
+	}
+	return lines > 0 && codeLines*3 >= lines
+}
+
+// longestBacktickRun returns the length of the longest run of backticks of
+// a text, so the fence of the text is longer
+func longestBacktickRun(text string) int {
+	longest, run := 0, 0
+	for _, r := range text {
+		if r == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	return longest
+}
+
+// jsonSearchResponse is the response of a search in the json format
+type jsonSearchResponse struct {
+	EmbeddingModel     string           `json:"embedding_model"`
+	EmbeddingDimension int              `json:"embedding_dimension"`
+	Note               string           `json:"note,omitempty"`
+	Results            []map[string]any `json:"results"`
+	Omitted            int              `json:"omitted,omitempty"`
+}
+
+// jsonResult returns the response of a search as a JSON document: the
+// embedding model, a note when the search fell back to keywords or found
+// nothing, and the snippets with their metadata, their resource URI, their
+// text and (unless found byKeywords) their rounded similarity. When verbose,
+// the snippets also have their chunk_index and their offset_range, like
+// with verboseResult, and their unrounded score. With includeEmbeddings, the
+// snippets have their stored embedding, for the client-side reranking.
+func jsonResult(model string, note string, topic string, similarities []SnippetRecord, byKeywords bool, verbose bool,
+	includeEmbeddings bool) (*mcp.CallToolResult, error) {
+	kept, omitted := keptSnippets(topic, similarities, byKeywords)
+	var indexes map[string]int
+	if verbose {
+		indexes = chunkIndexes(kept)
+	}
+	response := jsonSearchResponse{
+		EmbeddingModel:     embedderFor(model).model,
+		EmbeddingDimension: store.Dimension(),
+		Note:               strings.TrimSpace(note),
+		Results:            make([]map[string]any, 0, len(kept)),
+		Omitted:            omitted,
+	}
+	for _, similarity := range kept {
+		result := snippetMeta(similarity)
+		result["uri"] = snippetURIPrefix + similarity.Id
+		result["text"] = truncateText(strings.TrimLeft(similarity.Prompt, "\n"), config.MaxChunkChars)
+		if !byKeywords {
+			result["score"] = roundScore(similarity.CosineSimilarity)
+			result["below_threshold"] = isBelowThreshold(similarity)
+		}
+		if verbose {
+			if chunkIndex, ok := indexes[similarity.Id]; ok {
+				result["chunk_index"] = chunkIndex
+				result["offset_range"] = []int{similarity.StartOffset, similarity.EndOffset}
+			}
+			if !byKeywords {
+				result["score"] = similarity.CosineSimilarity
+			}
+		}
+		if includeEmbeddings {
+			result["embedding"] = similarity.Embedding
+		}
+		response.Results = append(response.Results, result)
+	}
+	responseJSON, err := json.MarshalIndent(response, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode the search results: %w", err)
+	}
+	return mcp.NewToolResultText(string(responseJSON)), nil
+}
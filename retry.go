@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// maxRetryBackoff caps the wait between two attempts of an embedding call
+const maxRetryBackoff = 30 * time.Second
+
+// retryPolicy is how a failed embedding call is retried: up to retries
+// more times, waiting backoff before the first retry, doubled before each
+// next one
+type retryPolicy struct {
+	phase   string
+	retries int
+	backoff time.Duration
+}
+
+// withRetries calls fn until it succeeds, or it failed as many times as the
+// policy allows, or ctx is done, and returns its last result
+func withRetries[T any](ctx context.Context, policy retryPolicy, fn func() (T, error)) (T, error) {
+	backoff := policy.backoff
+	for attempt := 1; ; attempt++ {
+		result, err := fn()
+		if err == nil || attempt > policy.retries || ctx.Err() != nil {
+			return result, err
+		}
+		slog.Warn("🔁 Embedding call failed, retrying", "phase", policy.phase, "attempt", attempt,
+			"retries", policy.retries, "backoff", backoff, "error", err)
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return result, err
+		case <-timer.C:
+		}
+		backoff = min(backoff*2, maxRetryBackoff)
+	}
+}
@@ -0,0 +1,508 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/micro-agent/micro-agent-go/agent/rag"
+)
+
+func searchInDocHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+
+	args := request.GetArguments()
+	topicArg, exists := args["topic"]
+	if !exists || topicArg == nil {
+		return nil, fmt.Errorf("missing required parameter 'topic'")
+	}
+	userQuestion, ok := topicArg.(string)
+	if !ok {
+		return nil, fmt.Errorf("parameter 'topic' must be a string")
+	}
+	userQuestion, err := preprocessTopic(userQuestion)
+	if err != nil {
+		return nil, fmt.Errorf("parameter 'topic': %w", err)
+	}
+
+	format := request.GetString("format", resultFormatText)
+	if format != resultFormatText && format != resultFormatJSON && format != resultFormatMarkdown {
+		return nil, fmt.Errorf("parameter 'format': %q must be text, json or markdown", format)
+	}
+	verbose := request.GetBool("verbose", false)
+	if verbose && format == resultFormatMarkdown {
+		return nil, fmt.Errorf("parameter 'verbose': only the text and json formats can be verbose")
+	}
+	includeEmbeddings := request.GetBool("include_embeddings", false)
+	if includeEmbeddings && format != resultFormatJSON {
+		return nil, fmt.Errorf("parameter 'include_embeddings': the embeddings are only included with the json format")
+	}
+
+	if !isStoreReady() {
+		return nil, fmt.Errorf("the vector store is not ready yet, please retry later")
+	}
+
+	var filters []RecordFilter
+	if glob := request.GetString("source_filter", ""); glob != "" {
+		filter, err := sourceFilter(glob, config.ContentDirs)
+		if err != nil {
+			return nil, fmt.Errorf("parameter 'source_filter': %w", err)
+		}
+		filters = append(filters, filter)
+	}
+	// The excluded sources win over the source filter, as all the filters must pass
+	excludeSources := request.GetStringSlice("exclude_sources", nil)
+	if len(excludeSources) > 0 {
+		filter, err := excludeSourcesFilter(excludeSources, config.ContentDirs)
+		if err != nil {
+			return nil, fmt.Errorf("parameter 'exclude_sources': %w", err)
+		}
+		filters = append(filters, filter)
+	}
+
+	minLength, maxLength := request.GetInt("min_length", 0), request.GetInt("max_length", 0)
+	if minLength < 0 || maxLength < 0 || (maxLength > 0 && maxLength < minLength) {
+		return nil, fmt.Errorf("parameters 'min_length' and 'max_length': %d and %d must not be negative, and max_length must not be below min_length",
+			minLength, maxLength)
+	}
+	if minLength > 0 || maxLength > 0 {
+		filters = append(filters, lengthFilter(minLength, maxLength))
+	}
+
+	slog.Info("🔍 Searching for question", "topic", userQuestion, "model", request.GetString("model", ""),
+		"source_filter", request.GetString("source_filter", ""), "exclude_sources", excludeSources,
+		"min_length", minLength, "max_length", maxLength)
+	searchStart := time.Now()
+	status := "error"
+	defer func() {
+		if ctx.Err() != nil {
+			status = "cancelled"
+		}
+		searchRequestsTotal.WithLabelValues(status).Inc()
+		searchDuration.Observe(time.Since(searchStart).Seconds())
+	}()
+
+	model := request.GetString("model", "")
+	threshold, topN := searchSettings()
+	cacheKey := newResultCacheKey(model, userQuestion, request.GetString("source_filter", ""), excludeSources,
+		minLength, maxLength, threshold, topN)
+	similarities, cached := searchResults.Get(cacheKey)
+	servedBy := embedderFor(model).model
+	if cached {
+		slog.Debug("📦 Search results served from the cache", "topic", userQuestion)
+	} else {
+		version := store.Version()
+		requested := servedBy
+		similarities, servedBy, err = retrieveSnippets(ctx, model, userQuestion, filters...)
+		// The results of a fallback model are not kept once the model is back
+		if err == nil && servedBy == requested {
+			searchResults.Put(cacheKey, version, similarities)
+		}
+	}
+	var embeddingErr error
+	if errors.Is(err, errTopicEmbedding) {
+		// The server stays useful while the embedding model is unavailable
+		slog.Warn("🔶 Semantic search unavailable, searching by keywords", "topic", userQuestion, "error", err)
+		embeddingErr = err
+		similarities, err = keywordSearch(ctx, userQuestion, topN, filters...)
+		if err != nil {
+			err = searchError(ctx, userQuestion, err)
+		}
+	}
+	if err != nil {
+		if errors.Is(err, errRateLimited) {
+			status = "rate_limited"
+		}
+		return nil, err
+	}
+	similarities = mergeOverlapping(similarities)
+	queries.Record(userQuestion, similarities)
+	logResultSources(userQuestion, similarities)
+
+	header := searchMetadata(servedBy)
+	note := ""
+	if embeddingErr != nil {
+		header = keywordFallbackNote(embeddingErr)
+		note = header
+	}
+	status = "ok"
+	if len(similarities) == 0 {
+		if embeddingErr != nil {
+			note += "No snippets found containing the terms of the topic.\n"
+		} else {
+			note = noSnippetsFoundMessage(threshold)
+		}
+	}
+	switch {
+	case format == resultFormatJSON:
+		return jsonResult(servedBy, note, userQuestion, similarities, embeddingErr != nil, verbose, includeEmbeddings)
+	case len(similarities) == 0:
+		if embeddingErr != nil {
+			return mcp.NewToolResultText(note), nil
+		}
+		return mcp.NewToolResultText(header + note), nil
+	case verbose:
+		return verboseResult(header, similarities, embeddingErr != nil), nil
+	case format == resultFormatMarkdown:
+		return markdownResult(header, userQuestion, similarities, embeddingErr != nil), nil
+	}
+	return snippetsResult(header, userQuestion, similarities, embeddingErr != nil), nil
+}
+
+func searchInDocBatchHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+
+	topics, err := request.RequireStringSlice("topics")
+	if err != nil {
+		return nil, fmt.Errorf("parameter 'topics' must be an array of strings: %w", err)
+	}
+	if len(topics) == 0 {
+		return nil, fmt.Errorf("parameter 'topics' must not be empty")
+	}
+	for idx, topic := range topics {
+		if topics[idx], err = preprocessTopic(topic); err != nil {
+			return nil, fmt.Errorf("parameter 'topics': %w", err)
+		}
+	}
+	dedupe := request.GetBool("dedupe", false)
+
+	if !isStoreReady() {
+		return nil, fmt.Errorf("the vector store is not ready yet, please retry later")
+	}
+
+	slog.Info("🔍 Searching for questions", "topics", topics, "dedupe", dedupe)
+
+	// Embed all the topics (and their paraphrases) first,
+	// so the store is read-locked only once
+	topicQuestions := make([][]rag.VectorRecord, 0, len(topics))
+	topicModels := make([]string, 0, len(topics))
+	questionRecords := []rag.VectorRecord{}
+	for _, topic := range topics {
+		questions, servedBy, err := expandTopic(ctx, "", topic)
+		if err != nil {
+			return nil, err
+		}
+		topicQuestions = append(topicQuestions, questions)
+		topicModels = append(topicModels, servedBy)
+		questionRecords = append(questionRecords, questions...)
+	}
+
+	threshold, topN := searchSettings()
+
+	results, err := store.SearchTopNSimilaritiesBatch(ctx, questionRecords, threshold, candidatesCount(topN), config.SourceBoosts)
+	if err != nil {
+		return nil, searchError(ctx, strings.Join(topics, ", "), err)
+	}
+
+	seen := map[string]bool{}
+	documentsContent := searchMetadata("")
+	for idx, questions := range topicQuestions {
+		similarities := boostRecent(mergeByMaxScore(results[:len(questions)], candidatesCount(topN)))
+		results = results[len(questions):]
+		similarities = rerank(ctx, topics[idx], similarities, topN)
+		similarities, err = withMinResults(ctx, questions[0], similarities)
+		if err != nil {
+			return nil, searchError(ctx, topics[idx], err)
+		}
+		if dedupe {
+			unique := []SnippetRecord{}
+			for _, similarity := range similarities {
+				if !seen[similarity.Id] {
+					seen[similarity.Id] = true
+					unique = append(unique, similarity)
+				}
+			}
+			similarities = unique
+		}
+		similarities = mergeOverlapping(similarities)
+		queries.Record(topics[idx], similarities)
+		logResultSources(topics[idx], similarities)
+		slog.Info("✋ Similarities found", "topic", topics[idx], "results", len(similarities), "model", topicModels[idx])
+		topicHeader := "Topic: " + topics[idx] + "\n"
+		if topicModels[idx] != embedder.model {
+			topicHeader += "Embedding model: " + topicModels[idx] + "\n"
+		}
+		if len(similarities) == 0 {
+			documentsContent += topicHeader + noSnippetsFoundMessage(threshold) + "\n"
+			continue
+		}
+		documentsContent += topicHeader + formatDocuments(topics[idx], similarities, false) + "\n"
+	}
+
+	return mcp.NewToolResultText(documentsContent), nil
+}
+
+// retrieveSnippets returns the snippets most related to a topic and the
+// name of the model which embedded it: the topic (and its paraphrases with
+// QUERY_EXPANSION) is embedded with model (the configured model when empty,
+// or one of its fallbacks), searched in the records passing the filters and
+// the candidates are reranked
+func retrieveSnippets(ctx context.Context, model string, topic string, filters ...RecordFilter) ([]SnippetRecord, string, error) {
+	// -------------------------------------------------
+	// Create a vector record from the user question
+	// -------------------------------------------------
+	questions, servedBy, err := expandTopic(ctx, model, topic)
+	if err != nil {
+		return nil, "", err
+	}
+
+	threshold, topN := searchSettings()
+
+	results, err := store.SearchTopNSimilaritiesBatch(ctx, questions, threshold, candidatesCount(topN), config.SourceBoosts, filters...)
+	if err != nil {
+		return nil, "", searchError(ctx, topic, err)
+	}
+	similarities := boostRecent(mergeByMaxScore(results, candidatesCount(topN)))
+	similarities = rerank(ctx, topic, similarities, topN)
+	similarities, err = withMinResults(ctx, questions[0], similarities, filters...)
+	if err != nil {
+		return nil, "", searchError(ctx, topic, err)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, "", searchError(ctx, topic, err)
+	}
+
+	slog.Info("✋ Similarities found", "topic", topic, "results", len(similarities), "model", servedBy)
+	return similarities, servedBy, nil
+}
+
+// expandTopic returns the vector record of a topic, followed by the vector
+// records of its paraphrases when QUERY_EXPANSION is enabled, and the name of
+// the model which embedded the topic; the paraphrases are embedded with the
+// same model. A paraphrase that can't be embedded is skipped.
+func expandTopic(ctx context.Context, model string, topic string) ([]rag.VectorRecord, string, error) {
+	questionRecord, servedBy, err := embedTopic(ctx, model, topic)
+	if err != nil {
+		return nil, "", err
+	}
+	questions := []rag.VectorRecord{questionRecord}
+	if expander == nil {
+		return questions, servedBy, nil
+	}
+
+	paraphrases := expander.Expand(ctx, topic)
+	for _, paraphrase := range paraphrases {
+		paraphraseRecord, _, err := embedTopic(ctx, servedBy, paraphrase)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, "", err
+			}
+			slog.Warn("🔶 Unable to embed the paraphrase, skipping it", "topic", topic, "paraphrase", paraphrase, "error", err)
+			continue
+		}
+		questions = append(questions, paraphraseRecord)
+	}
+	slog.Info("🔀 Query expanded", "topic", topic, "paraphrases", len(questions)-1)
+	return questions, servedBy, nil
+}
+
+// errTopicEmbedding is the error of a search whose topic couldn't be embedded
+var errTopicEmbedding = errors.New("failed to create the embedding of the topic")
+
+// embedTopic creates the vector record of a search topic, prefixed with
+// QUERY_PREFIX, with the embedder of model, reusing the embedding of an
+// identical topic from the query cache. When the model fails, the topic is
+// embedded with its fallback models, in order, skipping the ones whose vectors
+// don't have the dimension of the stored vectors. It returns the name of the model which embedded the topic.
+// It fails when the vectors of the model don't have the dimension of the
+// stored vectors.
+func embedTopic(ctx context.Context, model string, topic string) (rag.VectorRecord, string, error) {
+	topicEmbedder := embedderFor(model)
+	embeddingVector, err := embedQuery(ctx, topicEmbedder, topic)
+	if errors.Is(err, errTopicEmbedding) {
+		for _, fallback := range topicEmbedder.fallbacks {
+			slog.Warn("🪂 Embedding model unavailable, embedding the query with a fallback model", "topic", topic,
+				"model", topicEmbedder.model, "fallback", fallback.model)
+			fallbackVector, fallbackErr := embedQuery(ctx, fallback, topic)
+			if fallbackErr == nil {
+				fallbackErr = checkQueryDimension(fallback, fallbackVector)
+			}
+			if fallbackErr == nil {
+				slog.Warn("🪂 Query embedded with a fallback model", "topic", topic, "model", fallback.model)
+				return rag.VectorRecord{Embedding: fallbackVector}, fallback.model, nil
+			}
+			if ctx.Err() != nil || errors.Is(fallbackErr, errRateLimited) {
+				return rag.VectorRecord{}, "", fallbackErr
+			}
+			slog.Warn("🔶 Fallback embedding model unusable", "topic", topic, "model", fallback.model, "error", fallbackErr)
+		}
+	}
+	if err != nil {
+		return rag.VectorRecord{}, "", err
+	}
+	if err := checkQueryDimension(topicEmbedder, embeddingVector); err != nil {
+		return rag.VectorRecord{}, "", err
+	}
+	slog.Debug("🧭 Query embedded", "topic", topic, "model", topicEmbedder.model)
+	return rag.VectorRecord{Embedding: embeddingVector}, topicEmbedder.model, nil
+}
+
+// embedQuery creates the embedding of a search topic, prefixed with
+// QUERY_PREFIX, with an embedder, reusing the embedding of an identical topic
+// from the query cache
+func embedQuery(ctx context.Context, topicEmbedder *embeddingModel, topic string) ([]float64, error) {
+	if embeddingVector, ok := queryEmbeddings.Get(topicEmbedder.model, topic); ok {
+		slog.Debug("⚡️ Query embedding found in the cache", "topic", topic, "model", topicEmbedder.model)
+		return embeddingVector, nil
+	}
+	if err := embeddingLimiter.WaitSearch(ctx); err != nil {
+		if ctx.Err() != nil {
+			return nil, searchError(ctx, topic, ctx.Err())
+		}
+		slog.Warn("🚦 Search rejected by the embedding rate limiter", "topic", topic)
+		return nil, err
+	}
+	embeddingVector, err := withRetries(ctx, config.QueryRetryPolicy(), func() ([]float64, error) {
+		start := time.Now()
+		embeddingVector, err := topicEmbedder.GenerateEmbeddingVector(ctx, config.QueryPrefix+topic)
+		observeEmbedding(phaseQuery, start, err)
+		return embeddingVector, err
+	})
+	if ctx.Err() != nil {
+		return nil, searchError(ctx, topic, ctx.Err())
+	}
+	if err != nil {
+		slog.Error("😡 Error creating the question embedding", "topic", topic, "model", topicEmbedder.model, "error", err)
+		return nil, fmt.Errorf("%w with the model %q: %w", errTopicEmbedding, topicEmbedder.model, err)
+	}
+	if err := checkEmbedding(embeddingVector); err != nil {
+		slog.Error("😡 Invalid question embedding", "topic", topic, "model", topicEmbedder.model, "error", err)
+		return nil, fmt.Errorf("the embedding model %q returned an unusable vector for the topic, try rephrasing it: %w", topicEmbedder.model, err)
+	}
+	queryEmbeddings.Put(topicEmbedder.model, topic, embeddingVector)
+	if topicEmbedder != embedder {
+		modelEmbedders.LoadOrStore(topicEmbedder.model, topicEmbedder)
+	}
+	return embeddingVector, nil
+}
+
+// checkQueryDimension fails when the vector of a query, created by an
+// embedder, doesn't have the dimension of the stored vectors
+func checkQueryDimension(topicEmbedder *embeddingModel, embeddingVector []float64) error {
+	if dimension := store.Dimension(); dimension > 0 && len(embeddingVector) != dimension {
+		return fmt.Errorf("the embedding model %q creates vectors of dimension %d, but the stored vectors have dimension %d: use a model compatible with %q",
+			topicEmbedder.model, len(embeddingVector), dimension, store.Model())
+	}
+	return nil
+}
+
+// withMinResults completes the results of a search having less than
+// MIN_RESULTS results with the most similar records, passing the filters,
+// below the similarity threshold, after the results above it
+func withMinResults(ctx context.Context, question rag.VectorRecord, similarities []SnippetRecord, filters ...RecordFilter) ([]SnippetRecord, error) {
+	if len(similarities) >= config.MinResults {
+		return similarities, nil
+	}
+	// A cosine similarity is never below -1
+	closest, err := store.SearchTopNSimilarities(ctx, question, -1, config.MinResults, config.SourceBoosts, filters...)
+	if err != nil {
+		return nil, err
+	}
+	found := make(map[string]bool, len(similarities))
+	for _, similarity := range similarities {
+		found[similarity.Id] = true
+	}
+	relaxed := 0
+	for _, record := range closest {
+		if len(similarities) >= config.MinResults {
+			break
+		}
+		if !found[record.Id] {
+			similarities = append(similarities, record)
+			relaxed++
+		}
+	}
+	slog.Info("🪜 Results below the similarity threshold added", "added", relaxed, "min_results", config.MinResults)
+	return similarities, nil
+}
+
+// isBelowThreshold reports whether a result was added by MIN_RESULTS
+// although its similarity is below the threshold
+func isBelowThreshold(similarity SnippetRecord) bool {
+	threshold, _ := searchSettings()
+	return similarity.CosineSimilarity < threshold
+}
+
+// searchError logs and wraps the error of a search,
+// a search cancelled by the client is not logged as an error
+func searchError(ctx context.Context, topic string, err error) error {
+	if ctx.Err() != nil {
+		slog.Info("🛑 Search cancelled", "topic", topic, "reason", ctx.Err())
+		return fmt.Errorf("search cancelled: %w", ctx.Err())
+	}
+	slog.Error("😡 Error searching similarities", "topic", topic, "error", err)
+	return fmt.Errorf("failed to search similarities: %w", err)
+}
+
+// searchSettings returns the similarity threshold and the maximum number of results
+func searchSettings() (float64, int) {
+	return config.Limit, config.MaxResults
+}
+
+// candidatesCount returns how many candidates to fetch from the store to
+// return topN results: reranking and the recency boost pick them in a larger
+// candidate set
+func candidatesCount(topN int) int {
+	if reranker == nil && config.RecencyWeight <= 0 {
+		return topN
+	}
+	return topN * max(config.RerankCandidatesFactor, 1)
+}
+
+// Behaviours when a search topic exceeds MAX_QUERY_CHARS
+const (
+	onLongQueryTruncate = "truncate"
+	onLongQueryFail     = "fail"
+)
+
+// preprocessTopic trims a search topic and collapses its whitespace runs, so
+// pasted text embeds like typed text, then truncates it to MAX_QUERY_CHARS
+// characters (0 disables the limit), or rejects it with ON_LONG_QUERY=fail,
+// before it overflows the context of the embedding model
+func preprocessTopic(topic string) (string, error) {
+	topic = strings.Join(strings.Fields(topic), " ")
+	if topic == "" {
+		return "", errors.New("the topic is empty")
+	}
+	if config.MaxQueryChars <= 0 {
+		return topic, nil
+	}
+	length := utf8.RuneCountInString(topic)
+	if length <= config.MaxQueryChars {
+		return topic, nil
+	}
+	if config.OnLongQuery == onLongQueryFail {
+		return "", fmt.Errorf("the topic has %d characters, more than the %d allowed (MAX_QUERY_CHARS)", length, config.MaxQueryChars)
+	}
+	slog.Warn("✂️ Search topic truncated", "chars", length, "max_query_chars", config.MaxQueryChars)
+	return string([]rune(topic)[:config.MaxQueryChars]), nil
+}
+
+// rerank reorders the candidates with the reranker, when it is enabled,
+// and keeps the topN best ones
+func rerank(ctx context.Context, topic string, candidates []SnippetRecord, topN int) []SnippetRecord {
+	if reranker == nil || len(candidates) == 0 {
+		return candidates[:min(topN, len(candidates))]
+	}
+	return reranker.Rerank(ctx, topic, candidates, topN)
+}
+
+// resultSource is the source of a returned snippet, with its score
+type resultSource struct {
+	Source string  `json:"source"`
+	Score  float64 `json:"score"`
+}
+
+// logResultSources logs, in a single entry, the sources of the snippets
+// returned for a query with their rounded scores, to see which files
+// answered it when debugging the retrieval
+func logResultSources(topic string, similarities []SnippetRecord) {
+	sources := make([]resultSource, 0, len(similarities))
+	for _, similarity := range similarities {
+		sources = append(sources, resultSource{Source: similarity.Source, Score: roundScore(similarity.CosineSimilarity)})
+	}
+	slog.Info("📚 Result sources", "topic", topic, "sources", sources)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/micro-agent/micro-agent-go/agent/rag"
+)
+
+func TestSearchTopNSimilaritiesStopsWhenCancelled(t *testing.T) {
+	const records = 20 * cancellationCheckInterval
+	snippetStore := setupServer(t, nil, nil)
+	for idx := range records {
+		snippetStore.Save(testRecord(fmt.Sprintf("record-%05d", idx), "snippets/go.md", "chunk", 1, float64(idx)))
+	}
+	question := rag.VectorRecord{Embedding: []float64{1, 1}}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := snippetStore.SearchTopNSimilarities(cancelled, question, 0, 5, nil); !errors.Is(err, context.Canceled) {
+		t.Fatalf("search with a cancelled context: error = %v, want context.Canceled", err)
+	}
+	if _, err := snippetStore.SearchTopNSimilaritiesBatch(cancelled, []rag.VectorRecord{question, question}, 0, 5, nil); !errors.Is(err, context.Canceled) {
+		t.Fatalf("batch search with a cancelled context: error = %v, want context.Canceled", err)
+	}
+
+	// Cancelled during the scan, the search stops before scoring all the records
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	scored := 0
+	cancelDuringScan := func(record SnippetRecord) bool {
+		if scored++; scored == 10 {
+			cancel()
+		}
+		return true
+	}
+	if _, err := snippetStore.SearchTopNSimilarities(ctx, question, 0, 5, nil, cancelDuringScan); !errors.Is(err, context.Canceled) {
+		t.Fatalf("search cancelled during the scan: error = %v, want context.Canceled", err)
+	}
+	if scored >= records {
+		t.Errorf("the cancelled search scored all the %d records", records)
+	}
+}
+
+func TestSearchHandlerReturnsWhenCancelled(t *testing.T) {
+	// The embedding backend hangs until the client goes away
+	embedded := make(chan struct{})
+	snippetStore := setupServer(t, func(ctx context.Context, content string) ([]float64, error) {
+		close(embedded)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}, nil)
+	snippetStore.Save(testRecord("hello", "snippets/go.md", "## Hello\nfmt.Println(\"hello\")", 1, 0))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-embedded
+		cancel()
+	}()
+	done := make(chan error, 1)
+	go func() {
+		_, err := searchInDocHandler(ctx, toolRequest("search_snippet", map[string]any{"topic": "hello world"}))
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("searchInDocHandler() error = %v, want context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("searchInDocHandler() didn't return after the cancellation")
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// sentenceSnapper moves the boundary between two consecutive chunks which
+// touch or overlap (the size-based cuts of the recursive splitter) to the
+// nearest sentence end or paragraph break within tolerance characters, so the
+// chunks end on complete sentences. A boundary is never moved inside a fenced
+// code block.
+// The chunks separated by a delimiter are kept as they are.
+type sentenceSnapper struct {
+	tolerance  int
+	emit       func(chunk textSpan)
+	pending    textSpan
+	hasPending bool
+	// fence is the fence state at the start of the pending chunk
+	fence fenceState
+}
+
+func newSentenceSnapper(tolerance int, emit func(chunk textSpan)) *sentenceSnapper {
+	return &sentenceSnapper{tolerance: tolerance, emit: emit}
+}
+
+// snapSentences returns the snapper of SENTENCE_SNAP_CHARS (0 disables it)
+// passing the snapped chunks to emit
+func snapSentences(emit func(chunk textSpan)) *sentenceSnapper {
+	return newSentenceSnapper(config.SentenceSnapChars, emit)
+}
+
+// add receives the next chunk, and emits the previous one
+// once its end was snapped
+func (s *sentenceSnapper) add(next textSpan) {
+	if s.tolerance <= 0 {
+		s.emit(next)
+		return
+	}
+	if !s.hasPending {
+		s.pending, s.hasPending = next, true
+		return
+	}
+	previous := s.pending
+	if next.start > previous.start && next.start <= previous.end() && next.end() > previous.end() {
+		// The text of both chunks, starting at previous.start
+		union := previous.text + next.text[previous.end()-next.start:]
+		regions, _ := scanFences(union, s.fence)
+		end := s.snap(union, previous.end()-previous.start, regions)
+		start := min(s.snap(union, next.start-previous.start, regions), end)
+		if start > 0 && strings.TrimSpace(union[:end]) != "" && strings.TrimSpace(union[start:]) != "" {
+			previous.text = union[:end]
+			next = textSpan{
+				text:  union[start:],
+				start: previous.start + start,
+				line:  previous.line + strings.Count(union[:start], "\n"),
+			}
+		}
+		_, s.fence = scanFences(union[:next.start-previous.start], s.fence)
+	} else {
+		_, s.fence = scanFences(previous.text, s.fence)
+	}
+	s.emit(previous)
+	s.pending = next
+}
+
+// flush emits the last chunk
+func (s *sentenceSnapper) flush() {
+	if s.hasPending {
+		s.emit(s.pending)
+		s.hasPending = false
+	}
+}
+
+// snap returns the sentence boundary of text the nearest to boundary, within
+// tolerance characters and outside of the fenced regions, or boundary when
+// there is none
+func (s *sentenceSnapper) snap(text string, boundary int, regions []fenceRegion) int {
+	isCandidate := func(i int) bool {
+		return i > 0 && i < len(text) && !insideFence(regions, i) &&
+			(isFenceEdge(regions, i) || isSentenceBoundary(text, i))
+	}
+	if isCandidate(boundary) {
+		return boundary
+	}
+	before, after := boundary, boundary
+	for distance := 0; distance < s.tolerance; distance++ {
+		if before > 0 {
+			_, size := utf8.DecodeLastRuneInString(text[:before])
+			before -= size
+			if isCandidate(before) {
+				return before
+			}
+		}
+		if after < len(text) {
+			_, size := utf8.DecodeRuneInString(text[after:])
+			after += size
+			if isCandidate(after) {
+				return after
+			}
+		}
+	}
+	return boundary
+}
+
+// isSentenceBoundary tells whether the byte offset i of text starts a
+// sentence or a markdown block: it follows a sentence end (".", "?" or "!")
+// and whitespace, or a blank line, or it starts a heading, a list item,
+// a quote or a table row, or the line after a heading
+func isSentenceBoundary(text string, i int) bool {
+	if isSpace(text[i]) || !isSpace(text[i-1]) {
+		return false
+	}
+	before := strings.TrimRight(text[:i], " \t\r\n")
+	if before != "" && strings.ContainsRune(".?!", rune(before[len(before)-1])) {
+		return true
+	}
+	if text[i-1] != '\n' {
+		return false
+	}
+	if strings.Count(text[len(before):i], "\n") >= 2 {
+		return true
+	}
+	previousLine := before[strings.LastIndexByte(before, '\n')+1:]
+	return markdownHeading(previousLine) != "" || markdownBlockStart.MatchString(text[i:])
+}
+
+// markdownBlockStart matches the start of a heading, a list item, a quote or a table row
+var markdownBlockStart = regexp.MustCompile(`^(#{1,6}\s|[-*+]\s|\d+[.)]\s|>|\|)`)
+
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\r' || b == '\n'
+}
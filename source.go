@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// errSourceFound stops the walk of an archive once the source is read
+var errSourceFound = errors.New("source found")
+
+// getSourceHandler returns the whole content file of a snippet, found by
+// the ID of the snippet or by its source, so an agent can read the full
+// document around a too narrow snippet
+func getSourceHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	id := request.GetString("id", "")
+	source := request.GetString("source", "")
+	if (id == "") == (source == "") {
+		return nil, fmt.Errorf("one of the parameters 'id' or 'source' is required")
+	}
+
+	if !isStoreReady() {
+		return nil, fmt.Errorf("the vector store is not ready yet, please retry later")
+	}
+	record, ok := sourceRecord(id, source)
+	if !ok {
+		if id != "" {
+			return nil, fmt.Errorf("no snippet with the ID %q", id)
+		}
+		return nil, fmt.Errorf("no indexed snippet comes from the source %q", source)
+	}
+
+	slog.Info("📖 Reading the source of a snippet", "id", id, "source", record.Source)
+	content, err := readRecordSource(record)
+	if err != nil {
+		slog.Warn("🔶 Unable to read the source of a snippet", "source", record.Source, "error", err)
+		return nil, fmt.Errorf("failed to read the source %q: %w", record.Source, err)
+	}
+	return mcp.NewToolResultText(fmt.Sprintf("Source: %s\n\n%s", record.Source, content)), nil
+}
+
+// sourceRecord returns the record of the given ID, or else a record of the
+// given source
+func sourceRecord(id string, source string) (SnippetRecord, bool) {
+	if id != "" {
+		return store.Get(id)
+	}
+	for _, record := range store.Records() {
+		if record.Source == source {
+			return record, true
+		}
+	}
+	return SnippetRecord{}, false
+}
+
+// readRecordSource reads the content file of a record from disk: the file of
+// its content archive, or else its source file (the JSON Lines file of the
+// snippets of a JSON Lines content file). The file must be inside a content
+// directory (after resolving the symbolic links) and not ignored, so the
+// tool never reads another file, and at most MAX_SOURCE_BYTES long. The added
+// and imported snippets have no content file.
+func readRecordSource(record SnippetRecord) ([]byte, error) {
+	if isImportedRecord(record) {
+		return nil, fmt.Errorf("%q was added or imported, it has no content file", record.Source)
+	}
+	if record.ContentFile != "" && isContentArchive(record.ContentFile) {
+		if !slices.Contains(config.ContentArchives, record.ContentFile) {
+			return nil, fmt.Errorf("%q is not a content archive", record.ContentFile)
+		}
+		if isIgnoredArchiveFile(newIgnoreMatcher(config.IgnorePatterns), record.Source) {
+			return nil, fmt.Errorf("%q is ignored", record.Source)
+		}
+		content, err := readArchiveFile(record.ContentFile, record.Source)
+		if err == nil && int64(len(content)) > config.MaxSourceBytes {
+			return nil, fmt.Errorf("%q exceeds %d bytes", record.Source, config.MaxSourceBytes)
+		}
+		return content, err
+	}
+
+	contentFile := recordContentFile(record)
+	resolved, err := filepath.EvalSymlinks(contentFile)
+	if err != nil {
+		return nil, err
+	}
+	for _, contentDir := range config.ContentDirs {
+		root, err := filepath.EvalSymlinks(contentDir)
+		if err != nil || !isNestedDir(resolved, root) {
+			continue
+		}
+		ignored, err := loadIgnoreMatcher(contentDir, config.IgnorePatterns)
+		if err != nil {
+			return nil, err
+		}
+		absoluteRoot, err := filepath.Abs(root)
+		if err != nil {
+			return nil, err
+		}
+		absolutePath, err := filepath.Abs(resolved)
+		if err != nil {
+			return nil, err
+		}
+		relativePath, err := filepath.Rel(absoluteRoot, absolutePath)
+		if err != nil {
+			return nil, err
+		}
+		if isIgnoredArchiveFile(ignored, filepath.ToSlash(relativePath)) {
+			return nil, fmt.Errorf("%q is ignored", contentFile)
+		}
+		return readSourceFile(resolved)
+	}
+	return nil, fmt.Errorf("%q is not a file of the content directories", contentFile)
+}
+
+// readSourceFile reads a content file, failing when it exceeds MAX_SOURCE_BYTES
+func readSourceFile(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	content, err := io.ReadAll(io.LimitReader(file, config.MaxSourceBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(content)) > config.MaxSourceBytes {
+		return nil, fmt.Errorf("%q exceeds %d bytes", path, config.MaxSourceBytes)
+	}
+	return content, nil
+}
+
+// readArchiveFile reads the content of a file of a content archive
+func readArchiveFile(archivePath string, name string) ([]byte, error) {
+	var found []byte
+	err := walkArchiveFiles(archivePath, func(fileName string) bool {
+		return fileName == name
+	}, func(_ string, content []byte) error {
+		found = content
+		return errSourceFound
+	})
+	if errors.Is(err, errSourceFound) {
+		return found, nil
+	}
+	if err == nil {
+		err = fmt.Errorf("%q is not in the archive %q", name, archivePath)
+	}
+	return nil, err
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadRecordSource(t *testing.T) {
+	setupServer(t, nil, map[string]string{"IGNORE_PATTERNS": "secret/", "MAX_SOURCE_BYTES": "100"})
+	contentDir := config.ContentDirs[0]
+	outside := filepath.Join(t.TempDir(), "credentials.md")
+	files := map[string]string{
+		filepath.Join(contentDir, "go.md"):            "# Go\nfmt.Println()\n",
+		filepath.Join(contentDir, "handbook.jsonl"):   `{"text": "Deploy on Fridays", "source": "Handbook, chapter 2"}` + "\n",
+		filepath.Join(contentDir, "secret", "key.md"): "# Key\n",
+		filepath.Join(contentDir, "large.md"):         "# Large\n" + strings.Repeat("x", 100),
+		outside:                                       "# Credentials\n",
+	}
+	for path, content := range files {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(outside, filepath.Join(contentDir, "link.md")); err != nil {
+		t.Fatal(err)
+	}
+
+	jsonlRecord := func(source string) SnippetRecord {
+		record := testRecord("jsonl", source, "Deploy on Fridays", 1, 0)
+		record.ContentFile = filepath.Join(contentDir, "handbook.jsonl")
+		return record
+	}
+	addedRecord := testRecord("added", filepath.Join(contentDir, "go.md"), "# Go", 1, 0)
+	addedRecord.ContentFile = addedContentFile
+
+	tests := []struct {
+		name    string
+		record  SnippetRecord
+		content string
+	}{
+		{name: "content file", record: testRecord("go", filepath.Join(contentDir, "go.md"), "# Go", 1, 0), content: files[filepath.Join(contentDir, "go.md")]},
+		{name: "JSON Lines snippet", record: jsonlRecord("Handbook, chapter 2"), content: files[filepath.Join(contentDir, "handbook.jsonl")]},
+		// The source of a JSON Lines snippet is free text, never read
+		{name: "JSON Lines snippet sourced at another file", record: jsonlRecord(filepath.Join(contentDir, "go.md")), content: files[filepath.Join(contentDir, "handbook.jsonl")]},
+		{name: "added snippet", record: addedRecord},
+		{name: "imported snippet", record: testRecord("imported", "https://example.com/go.md", "# Go", 1, 0)},
+		{name: "file exceeding MAX_SOURCE_BYTES", record: testRecord("large", filepath.Join(contentDir, "large.md"), "# Large", 1, 0)},
+		{name: "ignored file", record: testRecord("ignored", filepath.Join(contentDir, "secret", "key.md"), "# Key", 1, 0)},
+		{name: "file outside the content directories", record: testRecord("outside", outside, "# Credentials", 1, 0)},
+		{name: "symbolic link to a file outside", record: testRecord("link", filepath.Join(contentDir, "link.md"), "# Credentials", 1, 0)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			content, err := readRecordSource(test.record)
+			if test.content == "" {
+				if err == nil {
+					t.Fatalf("readRecordSource() read %q, want an error", content)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readRecordSource() failed: %v", err)
+			}
+			if string(content) != test.content {
+				t.Errorf("readRecordSource() = %q, want %q", content, test.content)
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/micro-agent/micro-agent-go/agent/rag"
+)
+
+// Chunking strategies
+const (
+	chunkStrategyDelimiter     = "delimiter"
+	chunkStrategyAutoDelimiter = "autodelimiter"
+	chunkStrategyRecursive     = "recursive"
+)
+
+// recursiveSeparators are tried in order by the recursive splitter:
+// paragraphs, lines, sentences, words, and characters last
+var recursiveSeparators = []string{"\n\n", "\n", ". ", "! ", "? ", " ", ""}
+
+// textSpan is a part of a text, with the byte offset and the line
+// (starting at 1) where it starts
+type textSpan struct {
+	text  string
+	start int
+	line  int
+}
+
+// end returns the byte offset following the span
+func (span textSpan) end() int {
+	return span.start + len(span.text)
+}
+
+// splitRecursive splits a text into chunks of at most chunkSize characters,
+// cutting at the first separator of the list which keeps the pieces under
+// the size, like the recursive character text splitter of LangChain.
+// Consecutive chunks share up to chunkOverlap characters. A fenced code block
+// is never split, even when it is larger than chunkSize.
+func splitRecursive(text string, chunkSize int, chunkOverlap int) []textSpan {
+	chunks := []textSpan{}
+	splitWithSeparators(textSpan{text: text, line: 1}, recursiveSeparators, chunkSize, chunkOverlap, func(chunk textSpan) {
+		chunks = append(chunks, chunk)
+	})
+	return chunks
+}
+
+func splitWithSeparators(span textSpan, separators []string, chunkSize int, chunkOverlap int, emit func(chunk textSpan)) {
+	separator := separators[len(separators)-1]
+	remaining := []string{}
+	for idx, candidate := range separators {
+		if candidate == "" || strings.Contains(span.text, candidate) {
+			separator = candidate
+			remaining = separators[idx+1:]
+			break
+		}
+	}
+
+	splitter := newPieceSplitter(remaining, chunkSize, chunkOverlap, emit)
+	for _, piece := range glueFencedPieces(span, splitKeepingSeparator(span, separator)) {
+		splitter.add(piece)
+	}
+	splitter.flush()
+}
+
+// splitKeepingSeparator splits a text after each separator, so the pieces
+// concatenate back to the text; an empty separator splits the characters
+func splitKeepingSeparator(span textSpan, separator string) []textSpan {
+	var texts []string
+	if separator == "" {
+		texts = strings.Split(span.text, "")
+	} else {
+		texts = strings.SplitAfter(span.text, separator)
+	}
+	pieces := make([]textSpan, 0, len(texts))
+	start, line := span.start, span.line
+	for _, text := range texts {
+		pieces = append(pieces, textSpan{text: text, start: start, line: line})
+		start += len(text)
+		line += strings.Count(text, "\n")
+	}
+	return pieces
+}
+
+// pieceSplitter merges the consecutive pieces of a text into chunks, and
+// splits the pieces larger than the chunk size with the remaining separators.
+// The pieces are added one by one, so a text can be split while it is read.
+type pieceSplitter struct {
+	remaining    []string
+	chunkSize    int
+	chunkOverlap int
+	emit         func(chunk textSpan)
+	// current are the pieces of the next chunk, of currentSize characters
+	current     []textSpan
+	currentSize int
+}
+
+func newPieceSplitter(remaining []string, chunkSize int, chunkOverlap int, emit func(chunk textSpan)) *pieceSplitter {
+	return &pieceSplitter{remaining: remaining, chunkSize: chunkSize, chunkOverlap: chunkOverlap, emit: emit}
+}
+
+// add appends a piece to the next chunk, starting each chunk with the last
+// pieces of the previous one, up to chunkOverlap characters
+func (p *pieceSplitter) add(piece textSpan) {
+	pieceSize := utf8.RuneCountInString(piece.text)
+	if pieceSize > p.chunkSize {
+		p.flush()
+		if len(p.remaining) > 0 {
+			splitWithSeparators(piece, p.remaining, p.chunkSize, p.chunkOverlap, p.emit)
+		} else {
+			p.emit(piece)
+		}
+		return
+	}
+
+	if p.currentSize+pieceSize > p.chunkSize && len(p.current) > 0 {
+		p.emitChunk(joinSpans(p.current))
+		// Keep the tail of the chunk as the overlap of the next one
+		for len(p.current) > 0 && (p.currentSize > p.chunkOverlap || p.currentSize+pieceSize > p.chunkSize) {
+			p.currentSize -= utf8.RuneCountInString(p.current[0].text)
+			p.current = p.current[1:]
+		}
+	}
+	p.current = append(p.current, piece)
+	p.currentSize += pieceSize
+}
+
+// flush emits the pending pieces as a chunk, without overlap with the next one
+func (p *pieceSplitter) flush() {
+	p.emitChunk(joinSpans(p.current))
+	p.current = nil
+	p.currentSize = 0
+}
+
+// emitChunk emits a chunk unless it is blank
+func (p *pieceSplitter) emitChunk(chunk textSpan) {
+	if strings.TrimSpace(chunk.text) == "" {
+		return
+	}
+	p.emit(chunk)
+}
+
+// joinSpans concatenates consecutive spans
+func joinSpans(spans []textSpan) textSpan {
+	if len(spans) == 0 {
+		return textSpan{}
+	}
+	var text strings.Builder
+	for _, span := range spans {
+		text.WriteString(span.text)
+	}
+	return textSpan{text: text.String(), start: spans[0].start, line: spans[0].line}
+}
+
+// splitDelimited splits a text at each delimiter, like
+// rag.SplitTextWithDelimiter, except inside the fenced code blocks
+func splitDelimited(text string, delimiter string) []textSpan {
+	texts := rag.SplitTextWithDelimiter(text, delimiter)
+	parts := make([]textSpan, 0, len(texts))
+	fences := fenceTracker{}
+	partStart, line := 0, 1
+	offset := 0
+	for idx, partText := range texts {
+		fences.write(partText)
+		end := offset + len(partText)
+		offset = end + len(delimiter)
+		if idx < len(texts)-1 && fences.open() {
+			// The delimiter is inside a fenced code block, keep it in the part
+			fences.write(delimiter)
+			continue
+		}
+		parts = append(parts, textSpan{text: text[partStart:end], start: partStart, line: line})
+		line += strings.Count(text[partStart:min(offset, len(text))], "\n")
+		fences.write(delimiter)
+		partStart = offset
+	}
+	return parts
+}
@@ -0,0 +1,386 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"math"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/micro-agent/micro-agent-go/agent/rag"
+	_ "modernc.org/sqlite"
+)
+
+// sqliteSchema creates the tables of the SQLite store. The embedding of a
+// record is a blob of little-endian float64, stored with its L2 norm, the
+// other fields are JSON.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS records (
+	id        TEXT PRIMARY KEY,
+	source    TEXT NOT NULL DEFAULT '',
+	record    TEXT NOT NULL,
+	embedding BLOB NOT NULL,
+	norm      REAL
+);
+CREATE INDEX IF NOT EXISTS records_source ON records (source);
+CREATE TABLE IF NOT EXISTS meta (
+	key   TEXT PRIMARY KEY,
+	value TEXT NOT NULL
+);
+`
+
+// SQLiteSnippetStore is a vector store backed by a SQLite database: records
+// are inserted and deleted one by one, and searches scan the stored vectors,
+// so the store is never loaded nor rewritten as a whole
+type SQLiteSnippetStore struct {
+	db *sql.DB
+	// model and failures are written to the meta table on persist
+	model    atomic.Value
+	failures atomic.Value
+	dirty    atomic.Bool
+	version  atomic.Uint64
+	// quantization is the quantization of the stored vectors: the one of
+	// the loaded database, or else the configured one
+	quantization           atomic.Value
+	configuredQuantization string
+}
+
+// NewSQLiteSnippetStore opens (or creates) the SQLite store at storeFilePath,
+// whose new vectors are quantized with quantization
+func NewSQLiteSnippetStore(storeFilePath string, quantization string) (*SQLiteSnippetStore, error) {
+	db, err := sql.Open("sqlite", "file:"+storeFilePath+"?_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, fmt.Errorf("unable to open the SQLite store: %w", err)
+	}
+	// SQLite allows a single writer
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("unable to create the SQLite store schema: %w", err)
+	}
+	// The stores created before the norm column compute the missing norms
+	// while searching, until their records are saved again
+	var hasNorm bool
+	err = db.QueryRow(`SELECT COUNT(*) > 0 FROM pragma_table_info('records') WHERE name = 'norm'`).Scan(&hasNorm)
+	if err == nil && !hasNorm {
+		_, err = db.Exec(`ALTER TABLE records ADD COLUMN norm REAL`)
+	}
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("unable to add the norm column to the SQLite store: %w", err)
+	}
+	s := &SQLiteSnippetStore{db: db, configuredQuantization: quantization}
+	s.model.Store("")
+	s.failures.Store(indexFailures{})
+	s.quantization.Store(quantization)
+	return s, nil
+}
+
+// Load reads the embedding model of the store. A store that was never
+// persisted (e.g. the indexing was interrupted) is emptied and reported as
+// not existing, so it is built again; unless it is reloaded, then its
+// records are kept.
+func (s *SQLiteSnippetStore) Load(storeFilePath string) error {
+	var model string
+	err := s.db.QueryRow(`SELECT value FROM meta WHERE key = 'model'`).Scan(&model)
+	if err == sql.ErrNoRows {
+		if s.Model() != "" {
+			return &fs.PathError{Op: "load", Path: storeFilePath, Err: fs.ErrNotExist}
+		}
+		if _, err := s.db.Exec(`DELETE FROM records`); err != nil {
+			return err
+		}
+		return &fs.PathError{Op: "load", Path: storeFilePath, Err: fs.ErrNotExist}
+	}
+	if err != nil {
+		return err
+	}
+	failures := indexFailures{}
+	var failuresJSON string
+	err = s.db.QueryRow(`SELECT value FROM meta WHERE key = 'failed_chunks'`).Scan(&failuresJSON)
+	if err == nil {
+		err = json.Unmarshal([]byte(failuresJSON), &failures)
+	}
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("unable to read the failed chunks of the SQLite store: %w", err)
+	}
+	// The vectors keep the quantization of the database until it is rebuilt
+	quantization := quantizationNone
+	err = s.db.QueryRow(`SELECT value FROM meta WHERE key = 'quantization'`).Scan(&quantization)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("unable to read the vector quantization of the SQLite store: %w", err)
+	}
+	if quantization != s.configuredQuantization {
+		slog.Warn("🔶 The SQLite store keeps its vector quantization until it is rebuilt (FORCE_REINDEX)",
+			"store_quantization", quantization, "quantization", s.configuredQuantization)
+	}
+	s.quantization.Store(quantization)
+	s.model.Store(model)
+	s.failures.Store(failures)
+	s.dirty.Store(false)
+	s.version.Add(1)
+	return nil
+}
+
+// Persist records the embedding model of the store, the chunks which
+// couldn't be indexed and the quantization of the vectors, the records
+// themselves are written when they are saved
+func (s *SQLiteSnippetStore) Persist(storeFilePath string) error {
+	s.dirty.Store(false)
+	failuresJSON, err := json.Marshal(s.Failures())
+	if err == nil {
+		_, err = s.db.Exec(`INSERT INTO meta (key, value) VALUES ('model', ?), ('failed_chunks', ?), ('quantization', ?)
+			ON CONFLICT (key) DO UPDATE SET value = excluded.value`, s.Model(), string(failuresJSON), s.vectorQuantization())
+	}
+	if err != nil {
+		s.dirty.Store(true)
+		return err
+	}
+	return nil
+}
+
+// PersistIfDirty records the embedding model when it changed
+func (s *SQLiteSnippetStore) PersistIfDirty(storeFilePath string) (bool, error) {
+	if !s.dirty.Load() {
+		return false, nil
+	}
+	return true, s.Persist(storeFilePath)
+}
+
+// Save inserts (or replaces) a vector record,
+// generating a new UUID for it when it has no ID
+func (s *SQLiteSnippetStore) Save(record SnippetRecord) (SnippetRecord, error) {
+	if record.Id == "" {
+		record.Id = uuid.New().String()
+	}
+	// The returned vector is the stored one
+	record.Embedding = quantizedVector(record.Embedding, s.vectorQuantization())
+	fields := record
+	fields.Embedding = nil
+	fields.CosineSimilarity = 0
+	recordJSON, err := json.Marshal(fields)
+	if err != nil {
+		return record, err
+	}
+	_, err = s.db.Exec(`INSERT OR REPLACE INTO records (id, source, record, embedding, norm) VALUES (?, ?, ?, ?, ?)`,
+		record.Id, record.Source, string(recordJSON), quantizeVector(record.Embedding, s.vectorQuantization()), vectorNorm(record.Embedding))
+	s.version.Add(1)
+	return record, err
+}
+
+// Delete removes the record with the given ID
+func (s *SQLiteSnippetStore) Delete(id string) error {
+	_, err := s.db.Exec(`DELETE FROM records WHERE id = ?`, id)
+	s.version.Add(1)
+	return err
+}
+
+// Get returns the record with the given ID
+func (s *SQLiteSnippetStore) Get(id string) (SnippetRecord, bool) {
+	records, err := s.query(`SELECT record, embedding, norm FROM records WHERE id = ?`, id)
+	if err != nil {
+		slog.Error("😡 Error reading the SQLite store", "id", id, "error", err)
+	}
+	if len(records) == 0 {
+		return SnippetRecord{}, false
+	}
+	return records[0], true
+}
+
+// Records returns all the records, sorted by source and ID
+func (s *SQLiteSnippetStore) Records() []SnippetRecord {
+	records, err := s.query(`SELECT record, embedding, norm FROM records ORDER BY source, id`)
+	if err != nil {
+		slog.Error("😡 Error reading the SQLite store", "error", err)
+	}
+	return records
+}
+
+// SearchTopNSimilarities returns the max most similar records above the limit
+func (s *SQLiteSnippetStore) SearchTopNSimilarities(ctx context.Context, question rag.VectorRecord, limit float64, max int, boosts []sourceBoost, filters ...RecordFilter) ([]SnippetRecord, error) {
+	results, err := s.SearchTopNSimilaritiesBatch(ctx, []rag.VectorRecord{question}, limit, max, boosts, filters...)
+	if err != nil {
+		return nil, err
+	}
+	return results[0], nil
+}
+
+// SearchTopNSimilaritiesBatch runs SearchTopNSimilarities for each question
+// while scanning the stored vectors only once
+func (s *SQLiteSnippetStore) SearchTopNSimilaritiesBatch(ctx context.Context, questions []rag.VectorRecord, limit float64, max int, boosts []sourceBoost, filters ...RecordFilter) ([][]SnippetRecord, error) {
+	candidates := make([]*topNRecords, len(questions))
+	questionNorms := make([]float64, len(questions))
+	for idx, question := range questions {
+		candidates[idx] = newTopNRecords(max)
+		questionNorms[idx] = vectorNorm(question.Embedding)
+	}
+	now := time.Now()
+	err := s.scan(ctx, `SELECT record, embedding, norm FROM records`, func(record SnippetRecord, norm float64) {
+		if !matchesFilters(record, now, filters) {
+			return
+		}
+		for idx, question := range questions {
+			similarity := cosineSimilarityWithNorms(question.Embedding, record.Embedding, questionNorms[idx], norm)
+			if similarity >= limit {
+				record.CosineSimilarity = similarity
+				record.SourceBoost = sourceBoostOf(boosts, record)
+				candidates[idx].add(record)
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	results := make([][]SnippetRecord, 0, len(questions))
+	for _, best := range candidates {
+		results = append(results, best.sorted())
+	}
+	return results, nil
+}
+
+// Model returns the embedding model of the stored vectors ("" when unknown)
+func (s *SQLiteSnippetStore) Model() string {
+	return s.model.Load().(string)
+}
+
+// SetModel records the embedding model used to create the stored vectors
+func (s *SQLiteSnippetStore) SetModel(model string) {
+	s.model.Store(model)
+	s.dirty.Store(true)
+}
+
+// Failures returns the chunks which couldn't be indexed
+func (s *SQLiteSnippetStore) Failures() indexFailures {
+	return s.failures.Load().(indexFailures)
+}
+
+// SetFailures records the chunks which couldn't be indexed
+func (s *SQLiteSnippetStore) SetFailures(failures indexFailures) {
+	s.failures.Store(failures)
+	s.dirty.Store(true)
+}
+
+// Reset removes all the records from the store, and the failures
+func (s *SQLiteSnippetStore) Reset() {
+	s.SetFailures(indexFailures{})
+	s.quantization.Store(s.configuredQuantization)
+	if _, err := s.db.Exec(`DELETE FROM records`); err != nil {
+		slog.Error("😡 Error resetting the SQLite store", "error", err)
+	}
+	s.version.Add(1)
+}
+
+// Version returns the number of changes of the records
+func (s *SQLiteSnippetStore) Version() uint64 {
+	return s.version.Load()
+}
+
+// Count returns the number of records in the store
+func (s *SQLiteSnippetStore) Count() int {
+	var count int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM records`).Scan(&count); err != nil {
+		slog.Error("😡 Error counting the records of the SQLite store", "error", err)
+	}
+	return count
+}
+
+// Dimension returns the dimension of the stored vectors, 0 when the store is empty
+func (s *SQLiteSnippetStore) Dimension() int {
+	var embeddingBytes int
+	err := s.db.QueryRow(`SELECT LENGTH(embedding) FROM records LIMIT 1`).Scan(&embeddingBytes)
+	if err != nil && err != sql.ErrNoRows {
+		slog.Error("😡 Error reading the dimension of the SQLite store", "error", err)
+	}
+	return quantizedDimension(embeddingBytes, s.vectorQuantization())
+}
+
+// Stats computes the statistics of the store
+func (s *SQLiteSnippetStore) Stats() StoreStats {
+	var stats StoreStats
+	var embeddingBytes sql.NullInt64
+	err := s.db.QueryRow(`SELECT COUNT(*), COUNT(DISTINCT NULLIF(source, '')), MAX(LENGTH(embedding)) FROM records`).
+		Scan(&stats.Records, &stats.Sources, &embeddingBytes)
+	if err != nil {
+		slog.Error("😡 Error computing the statistics of the SQLite store", "error", err)
+	}
+	stats.EmbeddingDimension = quantizedDimension(int(embeddingBytes.Int64), s.vectorQuantization())
+	return stats
+}
+
+// vectorQuantization returns the quantization of the stored vectors
+func (s *SQLiteSnippetStore) vectorQuantization() string {
+	return s.quantization.Load().(string)
+}
+
+// Close closes the database
+func (s *SQLiteSnippetStore) Close() error {
+	return s.db.Close()
+}
+
+// query returns the records selected by a query on the (record, embedding, norm) columns
+func (s *SQLiteSnippetStore) query(query string, args ...any) ([]SnippetRecord, error) {
+	records := []SnippetRecord{}
+	err := s.scan(context.Background(), query, func(record SnippetRecord, norm float64) {
+		records = append(records, record)
+	}, args...)
+	return records, err
+}
+
+// scan calls fn with each record selected by a query on the (record, embedding,
+// norm) columns and the norm of its vector, until ctx is done
+func (s *SQLiteSnippetStore) scan(ctx context.Context, query string, fn func(record SnippetRecord, norm float64), args ...any) error {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	quantization := s.vectorQuantization()
+
+	for rows.Next() {
+		var recordJSON string
+		var embedding []byte
+		var norm sql.NullFloat64
+		if err := rows.Scan(&recordJSON, &embedding, &norm); err != nil {
+			return err
+		}
+		var record SnippetRecord
+		if err := json.Unmarshal([]byte(recordJSON), &record); err != nil {
+			return err
+		}
+		if record.Embedding, err = dequantizeVector(embedding, quantization); err != nil {
+			return fmt.Errorf("invalid vector of the record %s: %w", record.Id, err)
+		}
+		if !norm.Valid {
+			norm.Float64 = vectorNorm(record.Embedding)
+		}
+		fn(record, norm.Float64)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// encodeEmbedding serializes a vector as little-endian float64
+func encodeEmbedding(embedding []float64) []byte {
+	data := make([]byte, 8*len(embedding))
+	for i, value := range embedding {
+		binary.LittleEndian.PutUint64(data[8*i:], math.Float64bits(value))
+	}
+	return data
+}
+
+// decodeEmbedding deserializes a vector encoded by encodeEmbedding
+func decodeEmbedding(data []byte) []float64 {
+	embedding := make([]float64, len(data)/8)
+	for i := range embedding {
+		embedding[i] = math.Float64frombits(binary.LittleEndian.Uint64(data[8*i:]))
+	}
+	return embedding
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"path/filepath"
+	"testing"
+
+	"github.com/micro-agent/micro-agent-go/agent/rag"
+)
+
+func TestSQLiteStoreSearchesWithStoredNorms(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.db")
+
+	// A database created before the norm column
+	db, err := sql.Open("sqlite", "file:"+path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`CREATE TABLE records (id TEXT PRIMARY KEY, source TEXT NOT NULL DEFAULT '', record TEXT NOT NULL, embedding BLOB NOT NULL);
+		INSERT INTO records (id, source, record, embedding) VALUES ('old', 'snippets/go.md', '{"id": "old"}', ?)`,
+		encodeEmbedding([]float64{3, 4}))
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	snippetStore, err := NewSQLiteSnippetStore(path, quantizationNone)
+	if err != nil {
+		t.Fatalf("NewSQLiteSnippetStore failed: %v", err)
+	}
+	defer snippetStore.Close()
+	if _, err := snippetStore.Save(testRecord("new", "snippets/go.md", "chunk", 0, 2)); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	var norm float64
+	if err := snippetStore.db.QueryRow(`SELECT norm FROM records WHERE id = 'new'`).Scan(&norm); err != nil || norm != 2 {
+		t.Errorf("the stored norm is %g (%v), want 2", norm, err)
+	}
+	results, err := snippetStore.SearchTopNSimilarities(context.Background(), rag.VectorRecord{Embedding: []float64{0, 1}}, 0, 2, nil)
+	if err != nil {
+		t.Fatalf("search failed: %v", err)
+	}
+	want := map[string]float64{"new": 1, "old": 0.8}
+	if len(results) != len(want) {
+		t.Fatalf("the search returned %d records, want %d", len(results), len(want))
+	}
+	for _, result := range results {
+		if math.Abs(result.CosineSimilarity-want[result.Id]) > 1e-9 {
+			t.Errorf("the similarity of %s is %g, want %g", result.Id, result.CosineSimilarity, want[result.Id])
+		}
+	}
+}
@@ -6,4 +6,4 @@ export MCP_HTTP_PORT=9090
 export LIMIT=0.6
 export MAX_RESULTS=2
 export JSON_STORE_FILE_PATH=store/rag-memory-store.json
-go run main.go
+go run .
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"unicode/utf8"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// storeStatsHandler returns the handler of the store_stats tool,
+// reporting the state of the store persisted at storeFilePath
+func storeStatsHandler(storeFilePath string) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		stats := store.Stats()
+		failures := store.Failures()
+		if failures.Sources == nil {
+			failures.Sources = []string{}
+		}
+
+		var storeFileSize int64
+		if info, err := os.Stat(storeFilePath); err == nil {
+			storeFileSize = info.Size()
+		}
+
+		response := map[string]any{
+			"state":               storeState.Load().(string),
+			"records":             stats.Records,
+			"embedding_model":     config.EmbeddingModel,
+			"embedding_dimension": stats.EmbeddingDimension,
+			"sources":             stats.Sources,
+			"chunk_lengths":       computeChunkLengths(store.Records()),
+			"store_file_path":     storeFilePath,
+			"store_file_size":     storeFileSize,
+			"index_complete":      failures.complete(),
+			"failed_chunks":       failures.Count,
+			"failed_sources":      failures.Sources,
+		}
+		responseJSON, err := json.MarshalIndent(response, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode the store statistics: %w", err)
+		}
+		return mcp.NewToolResultText(string(responseJSON)), nil
+	}
+}
+
+// chunkLengths is the distribution of the lengths of the stored chunks, in
+// characters, which exposes a chunking misconfiguration (tiny or huge chunks)
+type chunkLengths struct {
+	Min  int     `json:"min"`
+	Max  int     `json:"max"`
+	Mean float64 `json:"mean"`
+	P50  int     `json:"p50"`
+	P95  int     `json:"p95"`
+}
+
+// computeChunkLengths computes the distribution of the lengths of the
+// chunks of records, all zero when there is no record
+func computeChunkLengths(records []SnippetRecord) chunkLengths {
+	if len(records) == 0 {
+		return chunkLengths{}
+	}
+	lengths := make([]int, 0, len(records))
+	total := 0
+	for _, record := range records {
+		length := utf8.RuneCountInString(record.Prompt)
+		lengths = append(lengths, length)
+		total += length
+	}
+	slices.Sort(lengths)
+	return chunkLengths{
+		Min:  lengths[0],
+		Max:  lengths[len(lengths)-1],
+		Mean: math.Round(float64(total)/float64(len(lengths))*10) / 10,
+		P50:  percentile(lengths, 50),
+		P95:  percentile(lengths, 95),
+	}
+}
+
+// percentile returns the nearest-rank percentile of sorted values
+func percentile(sorted []int, p float64) int {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	return sorted[max(rank, 1)-1]
+}
@@ -0,0 +1,712 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"math"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/micro-agent/micro-agent-go/agent/rag"
+)
+
+// SnippetRecord is a vector record enriched with the metadata of its chunk
+type SnippetRecord struct {
+	rag.VectorRecord
+	// Source is the path of the content file the chunk comes from
+	Source string `json:"source,omitempty"`
+	// Title is the nearest markdown heading of the chunk, or its first line
+	Title string `json:"title,omitempty"`
+	// StartOffset and EndOffset are the byte offsets of the chunk in its
+	// source, StartLine and EndLine its first and last lines (starting at 1).
+	// They are 0 when unknown, e.g. for converted HTML content.
+	StartOffset int `json:"start_offset,omitempty"`
+	EndOffset   int `json:"end_offset,omitempty"`
+	StartLine   int `json:"start_line,omitempty"`
+	EndLine     int `json:"end_line,omitempty"`
+	// ExpiresAt is the date from which the record is no more searched and
+	// is removed, nil when it never expires
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// ModifiedAt is the modification time of the source when it was
+	// indexed, nil when unknown
+	ModifiedAt *time.Time `json:"modified_at,omitempty"`
+	// Tags are the tags of the snippets of a JSON Lines content file
+	Tags []string `json:"tags,omitempty"`
+	// ContentFile is the path of the content file of the chunk when it is
+	// not its source, e.g. for the snippets of a JSON Lines content file,
+	// or addedContentFile for the documents added by add_snippets_bulk
+	ContentFile string `json:"content_file,omitempty"`
+	// Disabled excludes the record from the searches without deleting it,
+	// until it is enabled again (with the toggle_snippet tool)
+	Disabled bool `json:"disabled,omitempty"`
+	// SourceBoost is the SOURCE_BOOSTS multiplier of a search result, which
+	// ranks it (see rankingScore) without changing its cosine similarity;
+	// 0 when the record wasn't searched by similarity. It is not persisted.
+	SourceBoost float64 `json:"-"`
+}
+
+// recordContentFile returns the content file of a record: its source,
+// unless the record comes from a JSON Lines content file
+func recordContentFile(record SnippetRecord) string {
+	if record.ContentFile != "" {
+		return record.ContentFile
+	}
+	return record.Source
+}
+
+// currentStoreSchemaVersion is the version of the persisted store layout.
+// Bump it, and add a migration to storeMigrations, when the layout changes.
+const currentStoreSchemaVersion = 2
+
+// storeFile is the layout of the persisted JSON store
+type storeFile struct {
+	// SchemaVersion is absent (0) in the stores written before versioning
+	SchemaVersion int `json:"schema_version"`
+	// Model is the embedding model used to create the vectors
+	Model string `json:"model,omitempty"`
+	// FailedChunks are the chunks which couldn't be indexed, nil when the
+	// index is complete
+	FailedChunks *indexFailures `json:"failed_chunks,omitempty"`
+	// Quantization is the VECTOR_QUANTIZATION of the vectors, which are then
+	// stored quantized in Vectors, by record ID, instead of the embeddings
+	// of the records ("" when they are not quantized)
+	Quantization string            `json:"quantization,omitempty"`
+	Vectors      map[string][]byte `json:"vectors,omitempty"`
+	Records      map[string]SnippetRecord
+}
+
+// indexFailures counts the chunks which couldn't be indexed (e.g. their
+// embedding failed) and lists their content files, so a partial index is
+// reported until a reindex indexes them
+type indexFailures struct {
+	Count   int      `json:"count"`
+	Sources []string `json:"sources"`
+}
+
+// add records a chunk of contentFile which couldn't be indexed
+func (f *indexFailures) add(contentFile string) {
+	f.Count++
+	if !slices.Contains(f.Sources, contentFile) {
+		f.Sources = append(f.Sources, contentFile)
+	}
+}
+
+// complete tells whether no chunk failed to be indexed
+func (f indexFailures) complete() bool {
+	return f.Count == 0
+}
+
+// storeMigrations[v] upgrades a store file from schema version v to v+1
+var storeMigrations = []func(file *storeFile) error{
+	migrateStoreV0,
+	migrateStoreV1,
+}
+
+// migrateStoreV0 upgrades the rag.MemoryVectorStore layout: records may lack
+// their ID (it is the key of the map) and have no source
+func migrateStoreV0(file *storeFile) error {
+	for id, record := range file.Records {
+		if record.Id == "" {
+			record.Id = id
+		}
+		record.CosineSimilarity = 0
+		file.Records[id] = record
+	}
+	return nil
+}
+
+// migrateStoreV1 upgrades a store without quantized vectors, which is
+// unchanged: version 2 only tells the older versions they can't read it
+func migrateStoreV1(file *storeFile) error {
+	return nil
+}
+
+// migrateStoreFile upgrades a store file to the current schema version,
+// and reports whether it was migrated
+func migrateStoreFile(file *storeFile) (bool, error) {
+	if file.SchemaVersion > currentStoreSchemaVersion {
+		return false, fmt.Errorf("unsupported store schema version %d, the newest supported version is %d",
+			file.SchemaVersion, currentStoreSchemaVersion)
+	}
+	migrated := false
+	for file.SchemaVersion < currentStoreSchemaVersion {
+		if err := storeMigrations[file.SchemaVersion](file); err != nil {
+			return migrated, fmt.Errorf("failed to migrate the store from schema version %d: %w", file.SchemaVersion, err)
+		}
+		file.SchemaVersion++
+		migrated = true
+	}
+	return migrated, nil
+}
+
+// VectorStore is the storage of the snippet records and their embeddings.
+// SnippetStore keeps them in memory and persists them to a JSON file,
+// SQLiteSnippetStore writes them incrementally to a SQLite database.
+type VectorStore interface {
+	// Load reads the records, it returns an error satisfying os.IsNotExist
+	// when the store has not been built yet
+	Load(storeFilePath string) error
+	// Persist writes the pending changes of the store
+	Persist(storeFilePath string) error
+	// PersistIfDirty writes the pending changes, if any, and reports whether it wrote them
+	PersistIfDirty(storeFilePath string) (bool, error)
+	Save(record SnippetRecord) (SnippetRecord, error)
+	Delete(id string) error
+	Get(id string) (SnippetRecord, bool)
+	Records() []SnippetRecord
+	// SearchTopNSimilarities only scores the records passing the filters, and
+	// ranks them by their similarity multiplied by their source boost; it
+	// returns ctx.Err() when ctx is done before the end of the scan
+	SearchTopNSimilarities(ctx context.Context, question rag.VectorRecord, limit float64, max int, boosts []sourceBoost, filters ...RecordFilter) ([]SnippetRecord, error)
+	SearchTopNSimilaritiesBatch(ctx context.Context, questions []rag.VectorRecord, limit float64, max int, boosts []sourceBoost, filters ...RecordFilter) ([][]SnippetRecord, error)
+	Model() string
+	SetModel(model string)
+	// Failures returns the chunks which couldn't be indexed by the last
+	// build or reindex, persisted with the store
+	Failures() indexFailures
+	SetFailures(failures indexFailures)
+	// Reset removes all the records, and the failures
+	Reset()
+	Count() int
+	// Dimension returns the dimension of the stored vectors, 0 when the store is empty
+	Dimension() int
+	Stats() StoreStats
+	// Version is incremented by each change of the records, so the results
+	// computed from the records can tell they are stale
+	Version() uint64
+}
+
+// Backends of the vector store
+const (
+	storeBackendJSON   = "json"
+	storeBackendSQLite = "sqlite"
+)
+
+// SnippetStore is an in-memory vector store guarded by a read/write lock so
+// the store can be built in the background while health checks and searches run.
+// It tracks whether it changed since it was last loaded or persisted.
+type SnippetStore struct {
+	mutex    sync.RWMutex
+	model    string
+	failures indexFailures
+	records  map[string]SnippetRecord
+	// norms caches the L2 norms of the stored vectors, by record ID, so a
+	// search only computes the dot products
+	norms   map[string]float64
+	dirty   atomic.Bool
+	version atomic.Uint64
+	// serializes the writes of the store file
+	persistMutex sync.Mutex
+	// compress gzips the store file, as does a .gz extension
+	compress bool
+	// backup keeps the previous store file as a .bak file
+	backup bool
+	// quantization is the VECTOR_QUANTIZATION of the persisted vectors
+	quantization string
+	// pretty indents the JSON of the store file, which is compact otherwise
+	pretty bool
+	// ann indexes the records for the approximate searches, nil when disabled
+	ann *hnswIndex
+	// annParams are the settings of ann
+	annParams hnswParams
+	// annMinRecords is the number of records from which ann is searched
+	annMinRecords int
+}
+
+// NewSnippetStore creates an empty SnippetStore, persisted as gzipped JSON
+// when compress is true, as indented JSON when pretty is true, keeping a
+// backup of the previous store file when backup is true, with its vectors
+// quantized with quantization
+func NewSnippetStore(compress bool, backup bool, pretty bool, quantization string) *SnippetStore {
+	return &SnippetStore{
+		records:      make(map[string]SnippetRecord),
+		norms:        make(map[string]float64),
+		compress:     compress,
+		backup:       backup,
+		pretty:       pretty,
+		quantization: quantization,
+	}
+}
+
+// Load reads the vector records from a JSON file, gzipped or not
+func (s *SnippetStore) Load(storeFilePath string) error {
+	data, err := os.ReadFile(storeFilePath)
+	if err != nil {
+		return err
+	}
+	if bytes.HasPrefix(data, gzipMagic) {
+		if data, err = gunzip(data); err != nil {
+			return fmt.Errorf("failed to decompress the store: %w", err)
+		}
+	}
+
+	var file storeFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return err
+	}
+	if file.Records == nil {
+		file.Records = make(map[string]SnippetRecord)
+	}
+	migrated, err := migrateStoreFile(&file)
+	if err != nil {
+		return err
+	}
+	if err := dequantizeStoreFile(&file); err != nil {
+		return err
+	}
+	// The vectors of a store quantized otherwise are quantized again, and
+	// written back like a migrated store
+	requantized := cmp.Or(file.Quantization, quantizationNone) != s.quantization
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.model = file.Model
+	s.failures = indexFailures{}
+	if file.FailedChunks != nil {
+		s.failures = *file.FailedChunks
+	}
+	s.records = file.Records
+	s.norms = make(map[string]float64, len(file.Records))
+	for id, record := range s.records {
+		if requantized {
+			record.Embedding = quantizedVector(record.Embedding, s.quantization)
+			s.records[id] = record
+		}
+		s.norms[id] = vectorNorm(record.Embedding)
+	}
+	s.rebuildANN()
+	s.version.Add(1)
+	// A migrated store is written back in the current layout on the next persist
+	s.dirty.Store(migrated || requantized)
+	return nil
+}
+
+// Persist saves the vector records to a JSON file, compact unless pretty
+// printing is enabled, gzipped when compression is enabled or the file has a .gz extension.
+// The file is replaced atomically, so an interrupted write keeps the previous one.
+func (s *SnippetStore) Persist(storeFilePath string) error {
+	s.persistMutex.Lock()
+	defer s.persistMutex.Unlock()
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	// No Save can run while the read lock is held
+	s.dirty.Store(false)
+
+	content := storeFile{
+		SchemaVersion: currentStoreSchemaVersion,
+		Model:         s.model,
+		Records:       s.records,
+	}
+	if s.quantization != quantizationNone {
+		content.Quantization = s.quantization
+		content.Records, content.Vectors = quantizeRecords(s.records, s.quantization)
+	}
+	if !s.failures.complete() {
+		content.FailedChunks = &s.failures
+	}
+	var storeJSON []byte
+	var err error
+	if s.pretty {
+		storeJSON, err = json.MarshalIndent(content, "", "  ")
+	} else {
+		storeJSON, err = json.Marshal(content)
+	}
+	if err == nil && (s.compress || strings.HasSuffix(storeFilePath, ".gz")) {
+		storeJSON, err = gzipData(storeJSON)
+	}
+	if err == nil {
+		err = writeFileAtomic(storeFilePath, storeJSON, s.backup)
+	}
+	if err != nil {
+		s.dirty.Store(true)
+		return err
+	}
+	return nil
+}
+
+// quantizeRecords returns copies of the records without their embeddings,
+// and their quantized embeddings by record ID
+func quantizeRecords(records map[string]SnippetRecord, quantization string) (map[string]SnippetRecord, map[string][]byte) {
+	withoutEmbeddings := make(map[string]SnippetRecord, len(records))
+	vectors := make(map[string][]byte, len(records))
+	for id, record := range records {
+		vectors[id] = quantizeVector(record.Embedding, quantization)
+		record.Embedding = nil
+		withoutEmbeddings[id] = record
+	}
+	return withoutEmbeddings, vectors
+}
+
+// dequantizeStoreFile restores the embeddings of the records of a store
+// file whose vectors are quantized, whatever the current VECTOR_QUANTIZATION
+func dequantizeStoreFile(file *storeFile) error {
+	if file.Quantization == "" {
+		return nil
+	}
+	if !slices.Contains([]string{quantizationFloat16, quantizationInt8}, file.Quantization) {
+		return fmt.Errorf("unsupported vector quantization %q", file.Quantization)
+	}
+	for id, record := range file.Records {
+		vector, ok := file.Vectors[id]
+		if !ok {
+			return fmt.Errorf("the record %s has no vector", id)
+		}
+		embedding, err := dequantizeVector(vector, file.Quantization)
+		if err != nil {
+			return fmt.Errorf("invalid vector of the record %s: %w", id, err)
+		}
+		record.Embedding = embedding
+		file.Records[id] = record
+	}
+	file.Vectors = nil
+	return nil
+}
+
+// PersistIfDirty saves the vector records only when the store changed since
+// the last load or write, and reports whether it wrote the file
+func (s *SnippetStore) PersistIfDirty(storeFilePath string) (bool, error) {
+	if !s.dirty.Load() {
+		return false, nil
+	}
+	return true, s.Persist(storeFilePath)
+}
+
+// gzipMagic starts the gzipped files
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// gzipData compresses data
+func gzipData(data []byte) ([]byte, error) {
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// gunzip decompresses gzipped data
+func gunzip(data []byte) ([]byte, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+// Save adds (or overwrites) a vector record,
+// generating a new UUID for it when it has no ID
+func (s *SnippetStore) Save(record SnippetRecord) (SnippetRecord, error) {
+	if record.Id == "" {
+		record.Id = uuid.New().String()
+	}
+	// The searched vector is the persisted one
+	record.Embedding = quantizedVector(record.Embedding, s.quantization)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.records[record.Id] = record
+	s.norms[record.Id] = vectorNorm(record.Embedding)
+	if s.ann != nil {
+		// The previous vector of a record saved again stays in the graph
+		s.ann.insert(record.Id, record.Embedding)
+		if s.ann.needsRebuild() {
+			s.rebuildANN()
+		}
+	}
+	s.version.Add(1)
+	s.dirty.Store(true)
+	return record, nil
+}
+
+// cancellationCheckInterval is the number of scored records between two
+// checks of the cancellation of a search
+const cancellationCheckInterval = 1024
+
+// SearchTopNSimilarities returns the max most similar records above the limit
+func (s *SnippetStore) SearchTopNSimilarities(ctx context.Context, question rag.VectorRecord, limit float64, max int, boosts []sourceBoost, filters ...RecordFilter) ([]SnippetRecord, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.searchTopNSimilarities(ctx, question, limit, max, boosts, filters, time.Now())
+}
+
+// SearchTopNSimilaritiesBatch runs SearchTopNSimilarities for each question
+// while holding the read lock only once
+func (s *SnippetStore) SearchTopNSimilaritiesBatch(ctx context.Context, questions []rag.VectorRecord, limit float64, max int, boosts []sourceBoost, filters ...RecordFilter) ([][]SnippetRecord, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	results := make([][]SnippetRecord, 0, len(questions))
+	now := time.Now()
+	for _, question := range questions {
+		records, err := s.searchTopNSimilarities(ctx, question, limit, max, boosts, filters, now)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, records)
+	}
+	return results, nil
+}
+
+// searchTopNSimilarities skips the records expired at now; it must be called
+// with the read lock held
+func (s *SnippetStore) searchTopNSimilarities(ctx context.Context, question rag.VectorRecord, limit float64, max int, boosts []sourceBoost,
+	filters []RecordFilter, now time.Time) ([]SnippetRecord, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	// The filtered searches scan all the records, the records passing
+	// the filters may not be among the nearest neighbors
+	if s.ann != nil && len(filters) == 0 && len(s.records) >= s.annMinRecords {
+		return s.searchANN(question, limit, max, boosts, now), nil
+	}
+	best := newTopNRecords(max)
+	questionNorm := vectorNorm(question.Embedding)
+	scored := 0
+	for id, record := range s.records {
+		if scored++; scored%cancellationCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		if !matchesFilters(record, now, filters) {
+			continue
+		}
+		similarity := cosineSimilarityWithNorms(question.Embedding, record.Embedding, questionNorm, s.norms[id])
+		if similarity >= limit {
+			record.CosineSimilarity = similarity
+			record.SourceBoost = sourceBoostOf(boosts, record)
+			best.add(record)
+		}
+	}
+	return best.sorted(), nil
+}
+
+// Delete removes the record with the given ID
+func (s *SnippetStore) Delete(id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.records[id]; ok {
+		delete(s.records, id)
+		delete(s.norms, id)
+		if s.ann != nil {
+			s.ann.remove(id)
+			if s.ann.needsRebuild() {
+				s.rebuildANN()
+			}
+		}
+		s.version.Add(1)
+		s.dirty.Store(true)
+	}
+	return nil
+}
+
+// Get returns the record with the given ID
+func (s *SnippetStore) Get(id string) (SnippetRecord, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	record, ok := s.records[id]
+	return record, ok
+}
+
+// Records returns a snapshot of all the records, sorted by source and ID
+func (s *SnippetStore) Records() []SnippetRecord {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	records := make([]SnippetRecord, 0, len(s.records))
+	for _, record := range s.records {
+		records = append(records, record)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Source != records[j].Source {
+			return records[i].Source < records[j].Source
+		}
+		return records[i].Id < records[j].Id
+	})
+	return records
+}
+
+// Model returns the embedding model of the stored vectors ("" when unknown)
+func (s *SnippetStore) Model() string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.model
+}
+
+// SetModel records the embedding model used to create the stored vectors
+func (s *SnippetStore) SetModel(model string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.model = model
+	s.dirty.Store(true)
+}
+
+// Failures returns the chunks which couldn't be indexed
+func (s *SnippetStore) Failures() indexFailures {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.failures
+}
+
+// SetFailures records the chunks which couldn't be indexed
+func (s *SnippetStore) SetFailures(failures indexFailures) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.failures = failures
+	s.dirty.Store(true)
+}
+
+// Reset removes all the records from the store, and the failures
+func (s *SnippetStore) Reset() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.failures = indexFailures{}
+	s.records = make(map[string]SnippetRecord)
+	s.norms = make(map[string]float64)
+	s.rebuildANN()
+	s.version.Add(1)
+	s.dirty.Store(true)
+}
+
+// Version returns the number of changes of the records
+func (s *SnippetStore) Version() uint64 {
+	return s.version.Load()
+}
+
+// Count returns the number of records in the store
+func (s *SnippetStore) Count() int {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return len(s.records)
+}
+
+// Dimension returns the dimension of the stored vectors, 0 when the store is empty
+func (s *SnippetStore) Dimension() int {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	for _, record := range s.records {
+		return len(record.Embedding)
+	}
+	return 0
+}
+
+// StoreStats describes the content of the store
+type StoreStats struct {
+	Records            int `json:"records"`
+	EmbeddingDimension int `json:"embedding_dimension"`
+	Sources            int `json:"sources"`
+}
+
+// Stats computes the statistics of the store
+func (s *SnippetStore) Stats() StoreStats {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	stats := StoreStats{Records: len(s.records)}
+	sources := map[string]bool{}
+	for _, record := range s.records {
+		if stats.EmbeddingDimension == 0 {
+			stats.EmbeddingDimension = len(record.Embedding)
+		}
+		if record.Source != "" {
+			sources[record.Source] = true
+		}
+	}
+	stats.Sources = len(sources)
+	return stats
+}
+
+// EnableANN indexes the records in an HNSW graph, searched instead of
+// scoring all the records once the store holds minRecords records
+func (s *SnippetStore) EnableANN(params hnswParams, minRecords int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.ann = newHNSWIndex(params)
+	s.annParams = params
+	s.annMinRecords = minRecords
+	s.rebuildANN()
+}
+
+// rebuildANN indexes the current records in a new HNSW graph, when ANN is
+// enabled; it must be called with the write lock held
+func (s *SnippetStore) rebuildANN() {
+	if s.ann == nil {
+		return
+	}
+	start := time.Now()
+	s.ann = newHNSWIndex(s.annParams)
+	// The records are indexed in a stable order, to build the same graph
+	ids := slices.Sorted(maps.Keys(s.records))
+	for _, id := range ids {
+		s.ann.insert(id, s.records[id].Embedding)
+	}
+	if len(ids) == 0 {
+		return
+	}
+	slog.Info("🧭 ANN index built", "records", len(ids), "duration", time.Since(start).Round(time.Millisecond))
+	// The recall is estimated with exact scans, which would block the
+	// searches and the changes under the write lock
+	go s.logANNRecall(s.ann)
+}
+
+// logANNRecall logs the recall of an ANN index estimated against the exact
+// scan, unless the index was replaced in the meantime
+func (s *SnippetStore) logANNRecall(index *hnswIndex) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if s.ann != index {
+		return
+	}
+	recall := index.estimateRecall(annRecallSamples, 10)
+	slog.Info("🧭 ANN index recall", "records", index.len(), "estimated_recall_at_10", math.Round(recall*1000)/1000)
+}
+
+// annRecallSamples is the number of stored vectors searched to estimate the
+// recall of the ANN index, compared with the exact scan
+const annRecallSamples = 20
+
+// annBoostOverfetch multiplies the number of nearest neighbors ranked by an
+// ANN search when SOURCE_BOOSTS is set
+const annBoostOverfetch = 4
+
+// searchANN returns the max records the most similar to the question above
+// the limit, found by the ANN index and ranked with the source boosts,
+// without the records expired at now; it must be called with the read lock held
+func (s *SnippetStore) searchANN(question rag.VectorRecord, limit float64, max int, boosts []sourceBoost, now time.Time) []SnippetRecord {
+	var records []SnippetRecord
+	// All the explored candidates are ranked, not only the max first ones of
+	// the graph, so the ties at the cut are sorted like the exact scan
+	count := s.annParams.EfSearch
+	if max > count {
+		count = max
+	}
+	if len(boosts) > 0 {
+		// A boosted neighbor may outrank more similar ones found further
+		count *= annBoostOverfetch
+	}
+	for _, result := range s.ann.search(question.Embedding, count, s.annParams.EfSearch) {
+		record := s.records[result.id]
+		if result.similarity < limit || !matchesFilters(record, now, nil) {
+			continue
+		}
+		record.CosineSimilarity = result.similarity
+		record.SourceBoost = sourceBoostOf(boosts, record)
+		records = append(records, record)
+	}
+	// The ties are sorted by ID, the boosted neighbors are ranked again
+	return getTopNRecords(records, max)
+}
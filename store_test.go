@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// v0Store is a store written before the schema versioning, in the
+// rag.MemoryVectorStore layout: no schema_version, a record without its ID
+// and a leftover cosine similarity
+const v0Store = `{
+  "Records": {
+    "first": {"id": "first", "prompt": "## Hello\nfmt.Println(\"hello\")", "embedding": [1, 0, 0], "CosineSimilarity": 0.8},
+    "second": {"prompt": "## Bye\nfmt.Println(\"bye\")", "embedding": [0, 1, 0]}
+  }
+}`
+
+func TestLoadMigratesV0Store(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.json")
+	if err := os.WriteFile(path, []byte(v0Store), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	snippetStore := NewSnippetStore(false, false, false, quantizationNone)
+	if err := snippetStore.Load(path); err != nil {
+		t.Fatalf("Load of a v0 store failed: %v", err)
+	}
+	if count := snippetStore.Count(); count != 2 {
+		t.Fatalf("Count() = %d, want 2", count)
+	}
+	second, ok := snippetStore.records["second"]
+	if !ok {
+		t.Fatal("the record without ID is missing")
+	}
+	if second.Id != "second" {
+		t.Errorf("the record without ID got the ID %q, want its key %q", second.Id, "second")
+	}
+	if !slices.Equal(second.Embedding, []float64{0, 1, 0}) {
+		t.Errorf("the embedding of the record is %v, want [0 1 0]", second.Embedding)
+	}
+	if first := snippetStore.records["first"]; first.CosineSimilarity != 0 {
+		t.Errorf("the persisted cosine similarity was kept: %g", first.CosineSimilarity)
+	}
+
+	// The migrated store is written back in the current layout
+	written, err := snippetStore.PersistIfDirty(path)
+	if err != nil {
+		t.Fatalf("PersistIfDirty failed: %v", err)
+	}
+	if !written {
+		t.Fatal("the migrated store was not written back")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var file storeFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		t.Fatalf("the written store is not valid JSON: %v", err)
+	}
+	if file.SchemaVersion != currentStoreSchemaVersion {
+		t.Errorf("schema_version = %d, want %d", file.SchemaVersion, currentStoreSchemaVersion)
+	}
+	if file.Records["second"].Id != "second" {
+		t.Errorf("the written record has the ID %q, want %q", file.Records["second"].Id, "second")
+	}
+
+	// Loading the migrated store again changes nothing
+	reloaded := NewSnippetStore(false, false, false, quantizationNone)
+	if err := reloaded.Load(path); err != nil {
+		t.Fatalf("Load of the migrated store failed: %v", err)
+	}
+	if written, _ := reloaded.PersistIfDirty(path); written {
+		t.Error("a store in the current layout was migrated again")
+	}
+	if count := reloaded.Count(); count != 2 {
+		t.Errorf("Count() after the reload = %d, want 2", count)
+	}
+}
+
+func TestLoadRejectsNewerSchemaVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.json")
+	if err := os.WriteFile(path, []byte(`{"schema_version": 99, "Records": {}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewSnippetStore(false, false, false, quantizationNone).Load(path); err == nil {
+		t.Fatal("Load of a store written by a newer version succeeded")
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+)
+
+// streamContentChunks chunks a content file while reading it, instead of
+// reading it whole, and calls fn with each record as soon as it is produced.
+// The records are the ones chunkContent produces for the whole content.
+// The recursive strategy buffers a paragraph at a time, and the delimiter
+// strategy a chunk at a time.
+func streamContentChunks(path string, delimiter string, fn func(record SnippetRecord)) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if config.ChunkStrategy == chunkStrategyAutoDelimiter {
+		// The whole file is read a first time to find its delimiter
+		if delimiter, err = detectFileDelimiter(path, delimiter); err != nil {
+			return err
+		}
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	modifiedAt := info.ModTime()
+	// The frontmatter is skipped, like chunkContent does
+	front := readFrontmatter(file, path)
+	if _, err := file.Seek(int64(front.length), io.SeekStart); err != nil {
+		return err
+	}
+	reader := bufio.NewReader(file)
+	recorder := chunkRecorder{source: path, expiresAt: front.expiresAt, modifiedAt: &modifiedAt, offset: front.length, lines: front.lines}
+	snapper := snapSentences(func(part textSpan) {
+		fn(recorder.record(part))
+	})
+	if config.ChunkStrategy == chunkStrategyRecursive {
+		err = streamRecursive(reader, config.ChunkSize, config.ChunkOverlap, snapper.add)
+	} else {
+		err = streamDelimited(reader, delimiter, snapper.add)
+	}
+	if err != nil {
+		return err
+	}
+	snapper.flush()
+	return nil
+}
+
+// streamRecursive splits a text read from reader like splitRecursive: the
+// text is split into paragraphs, as splitRecursive does for a text containing
+// a blank line, except inside the fenced code blocks. A text without blank
+// lines is a single paragraph, which splitRecursive splits with the next separators.
+func streamRecursive(reader *bufio.Reader, chunkSize int, chunkOverlap int, emit func(chunk textSpan)) error {
+	splitter := newPieceSplitter(recursiveSeparators[1:], chunkSize, chunkOverlap, emit)
+	var paragraph strings.Builder
+	fences := fenceTracker{}
+	start, line := 0, 1
+	for {
+		text, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		paragraph.WriteString(text)
+		fences.write(text)
+		if (strings.HasSuffix(paragraph.String(), "\n\n") && !fences.open()) || err == io.EOF {
+			piece := textSpan{text: paragraph.String(), start: start, line: line}
+			splitter.add(piece)
+			start = piece.end()
+			line += strings.Count(piece.text, "\n")
+			paragraph.Reset()
+		}
+		if err == io.EOF {
+			splitter.flush()
+			return nil
+		}
+	}
+}
+
+// streamDelimited splits a text read from reader like splitDelimited
+func streamDelimited(reader *bufio.Reader, delimiter string, emit func(part textSpan)) error {
+	lastByte := delimiter[len(delimiter)-1]
+	var part strings.Builder
+	fences := fenceTracker{}
+	// written is the length of the part written to the fence tracker
+	written := 0
+	start, line := 0, 1
+	for {
+		text, err := reader.ReadString(lastByte)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		part.WriteString(text)
+		current := part.String()
+		if err == io.EOF {
+			emit(textSpan{text: current, start: start, line: line})
+			return nil
+		}
+		// A delimiter overlapping the previous one is not a delimiter
+		delimiterStart := len(current) - len(delimiter)
+		if !strings.HasSuffix(current, delimiter) || delimiterStart < written {
+			continue
+		}
+		fences.write(current[written:delimiterStart])
+		inFence := fences.open()
+		fences.write(delimiter)
+		written = len(current)
+		if inFence {
+			// The delimiter is inside a fenced code block, keep it in the part
+			continue
+		}
+		emit(textSpan{text: current[:delimiterStart], start: start, line: line})
+		start += len(current)
+		line += strings.Count(current, "\n")
+		part.Reset()
+		written = 0
+	}
+}
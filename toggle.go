@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// toggleSnippetHandler disables a snippet, so the searches skip it while it
+// stays in the store, or enables it again. Without the disabled parameter,
+// the state of the snippet is flipped.
+func toggleSnippetHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	id, err := request.RequireString("id")
+	if err != nil {
+		return nil, fmt.Errorf("missing required parameter 'id'")
+	}
+
+	if !isStoreReady() {
+		return nil, fmt.Errorf("the vector store is not ready yet, please retry later")
+	}
+	record, ok := store.Get(id)
+	if !ok {
+		return nil, fmt.Errorf("no snippet with the ID %q", id)
+	}
+
+	record.Disabled = request.GetBool("disabled", !record.Disabled)
+	if _, err := store.Save(record); err != nil {
+		return nil, fmt.Errorf("failed to save the snippet: %w", err)
+	}
+	flushStore(config.StoreFilePath())
+
+	state := "enabled"
+	if record.Disabled {
+		state = "disabled, it is excluded from the searches"
+	}
+	slog.Info("🔘 Snippet toggled", "id", id, "source", record.Source, "disabled", record.Disabled)
+	return mcp.NewToolResultText(fmt.Sprintf("Snippet %q (%s) %s", recordTitle(record), id, state)), nil
+}
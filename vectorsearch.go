@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/micro-agent/micro-agent-go/agent/rag"
+)
+
+// searchByVectorHandler searches the snippets similar to a query vector
+// computed by the client, skipping the embedding of a topic
+func searchByVectorHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	vector, err := request.RequireFloatSlice("vector")
+	if err != nil {
+		return nil, fmt.Errorf("parameter 'vector' must be an array of numbers: %w", err)
+	}
+	if err := checkEmbedding(vector); err != nil {
+		return nil, fmt.Errorf("parameter 'vector': %w", err)
+	}
+
+	if !isStoreReady() {
+		return nil, fmt.Errorf("the vector store is not ready yet, please retry later")
+	}
+	if dimension := store.Dimension(); dimension > 0 && len(vector) != dimension {
+		return nil, fmt.Errorf("parameter 'vector' has dimension %d, but the stored vectors have dimension %d: embed the query with %q or a compatible model",
+			len(vector), dimension, store.Model())
+	}
+
+	slog.Info("🔍 Searching for vector", "dimension", len(vector))
+	searchStart := time.Now()
+	status := "error"
+	defer func() {
+		if ctx.Err() != nil {
+			status = "cancelled"
+		}
+		searchRequestsTotal.WithLabelValues(status).Inc()
+		searchDuration.Observe(time.Since(searchStart).Seconds())
+	}()
+
+	threshold, topN := searchSettings()
+	similarities, err := store.SearchTopNSimilarities(ctx, rag.VectorRecord{Embedding: vector}, threshold, topN, config.SourceBoosts)
+	if err != nil {
+		return nil, searchError(ctx, "vector", err)
+	}
+	slog.Info("✋ Similarities found", "topic", "vector", "results", len(similarities))
+
+	status = "ok"
+	header := fmt.Sprintf("Embedding dimension: %d\n\n", len(vector))
+	if len(similarities) == 0 {
+		return mcp.NewToolResultText(header + noSnippetsFoundMessage(threshold)), nil
+	}
+	return mcp.NewToolResultText(header + formatDocuments("", similarities, false)), nil
+}
+
+// similarToSnippetHandler searches the snippets similar to a stored snippet,
+// with its stored embedding as the query vector, without the snippet itself
+func similarToSnippetHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	id, err := request.RequireString("id")
+	if err != nil {
+		return nil, fmt.Errorf("missing required parameter 'id'")
+	}
+
+	if !isStoreReady() {
+		return nil, fmt.Errorf("the vector store is not ready yet, please retry later")
+	}
+	record, ok := store.Get(id)
+	if !ok {
+		return nil, fmt.Errorf("no snippet with the ID %q", id)
+	}
+
+	slog.Info("🔍 Searching for similar snippets", "id", id, "source", record.Source)
+	searchStart := time.Now()
+	status := "error"
+	defer func() {
+		if ctx.Err() != nil {
+			status = "cancelled"
+		}
+		searchRequestsTotal.WithLabelValues(status).Inc()
+		searchDuration.Observe(time.Since(searchStart).Seconds())
+	}()
+
+	// One more result, as the snippet is the most similar to itself
+	threshold, topN := searchSettings()
+	found, err := store.SearchTopNSimilarities(ctx, rag.VectorRecord{Embedding: record.Embedding}, threshold, topN+1, config.SourceBoosts)
+	if err != nil {
+		return nil, searchError(ctx, id, err)
+	}
+	similarities := make([]SnippetRecord, 0, topN)
+	for _, similarity := range found {
+		if similarity.Id != id && len(similarities) < topN {
+			similarities = append(similarities, similarity)
+		}
+	}
+	slog.Info("✋ Similarities found", "topic", id, "results", len(similarities))
+
+	status = "ok"
+	header := fmt.Sprintf("Snippets similar to: %s\n\n", recordTitle(record))
+	if len(similarities) == 0 {
+		return mcp.NewToolResultText(header + noSnippetsFoundMessage(threshold)), nil
+	}
+	return mcp.NewToolResultText(header + formatDocuments("", similarities, false)), nil
+}
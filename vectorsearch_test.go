@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// resultText returns the text of the result of a tool call
+func resultText(t *testing.T, result *mcp.CallToolResult) string {
+	t.Helper()
+	if len(result.Content) != 1 {
+		t.Fatalf("the result has %d contents, want 1", len(result.Content))
+	}
+	content, ok := result.Content[0].(mcp.TextContent)
+	if !ok {
+		t.Fatalf("the result content is a %T, want a text", result.Content[0])
+	}
+	return content.Text
+}
+
+func TestSearchByVectorRoundTrip(t *testing.T) {
+	vectors := map[string][]float64{
+		"goroutines": {0.12, 0.53, 0.31, 0.77, 0.08, 0.19},
+		"channels":   {0.45, 0.22, 0.61, 0.05, 0.33, 0.27},
+		"generics":   {0.38, 0.14, 0.09, 0.21, 0.68, 0.41},
+	}
+	snippetStore := setupServer(t, func(_ context.Context, content string) ([]float64, error) {
+		// The topic is embedded close to the channels snippet
+		return []float64{0.4, 0.25, 0.6, 0.1, 0.3, 0.2}, nil
+	}, map[string]string{"LIMIT": "0", "MAX_RESULTS": "3"})
+	for id, vector := range vectors {
+		snippetStore.Save(testRecord(id, "snippets/"+id+".md", "## About "+id, vector...))
+	}
+
+	// The stored vectors are returned in the json results
+	result, err := searchInDocHandler(context.Background(), toolRequest("search_snippet", map[string]any{
+		"topic": "how to send values between goroutines", "format": "json", "include_embeddings": true,
+	}))
+	if err != nil {
+		t.Fatalf("searchInDocHandler() failed: %v", err)
+	}
+	var response struct {
+		Results []struct {
+			ID        string    `json:"id"`
+			Embedding []float64 `json:"embedding"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal([]byte(resultText(t, result)), &response); err != nil {
+		t.Fatalf("the json results don't parse: %v", err)
+	}
+	if len(response.Results) != len(vectors) {
+		t.Fatalf("the search returned %d results, want %d", len(response.Results), len(vectors))
+	}
+	for _, found := range response.Results {
+		if !slices.Equal(found.Embedding, vectors[found.ID]) {
+			t.Errorf("the embedding of %s is %v, want the stored %v", found.ID, found.Embedding, vectors[found.ID])
+		}
+	}
+
+	// Each returned vector, sent back like a JSON argument, finds its snippet first
+	for _, found := range response.Results {
+		var arguments map[string]any
+		data, _ := json.Marshal(map[string]any{"vector": found.Embedding})
+		if err := json.Unmarshal(data, &arguments); err != nil {
+			t.Fatal(err)
+		}
+		result, err := searchByVectorHandler(context.Background(), toolRequest("search_by_vector", arguments))
+		if err != nil {
+			t.Fatalf("searchByVectorHandler() failed: %v", err)
+		}
+		text := resultText(t, result)
+		first := len(text)
+		firstID := ""
+		for id := range vectors {
+			if position := strings.Index(text, "## About "+id); position >= 0 && position < first {
+				first, firstID = position, id
+			}
+		}
+		if firstID != found.ID {
+			t.Errorf("the vector of %s found %q first:\n%s", found.ID, firstID, text)
+		}
+		if !strings.Contains(text, "Similarity: 1") {
+			t.Errorf("the vector of %s didn't find itself with a similarity of 1:\n%s", found.ID, text)
+		}
+	}
+}